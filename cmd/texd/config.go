@@ -16,6 +16,8 @@ const (
 	defaultCompileTimeout     = time.Minute
 	defaultRetentionPoolSize  = 100 * units.MiB
 	defaultRetentionPoolItems = 1000
+	defaultWorkspaceIdle      = 10 * time.Minute
+	defaultWorkspaceQuota     = 50 * units.MiB
 )
 
 // config holds all command-line configuration.
@@ -26,16 +28,30 @@ type config struct {
 	queueTimeout   time.Duration
 	maxJobSize     string // human-readable size
 	compileTimeout time.Duration
+	workspaces     int
+	workspaceIdle  time.Duration
+	workspaceQuota string // human-readable size
 
 	// TeX options
 	engine      string
-	shellEscape int // 0=default, 1=enable, -1=disable
+	engines     []string // custom engine definitions (name=flags)
+	shellEscape int      // 0=default, 1=enable, -1=disable
+	transcode   bool     // transcode TeX and data files to UTF-8 (--detect-encoding)
+	noPkgCheck  bool     // only warn about unknown packages (--no-package-check)
+	magic       string   // allowed magic comment keys ("all", "none", or a list)
+	tools       string   // allowed auxiliary tools ("all", "none", or a list)
+	envVars     string   // allowed environment variables ("all", "none", or a list)
 	jobDir      string
 	keepJobs    int
+	profiles    []string // render profile definitions (name=params)
+	signingKeys []string // signing key definitions (name=params)
+	apiKeys     []string // API key definitions (name=params)
+	errorCodes  []string // custom error patterns (code=params)
 
 	// Docker options
-	pull   bool
-	images []string // remaining args after flag parsing
+	pull         bool
+	images       []string // remaining args after flag parsing
+	imageEngines []string // engine restrictions (image=name,...)
 
 	// Reference store
 	storageDSN  string
@@ -46,6 +62,10 @@ type config struct {
 	// Misc
 	logLevel    string
 	showVersion bool
+
+	// doctor subcommand
+	doctor     bool
+	doctorJSON bool
 }
 
 // defaultConfig returns a config with default values.
@@ -56,8 +76,14 @@ func defaultConfig() *config {
 		queueTimeout:   defaultQueueTimeout,
 		maxJobSize:     units.BytesSize(float64(defaultMaxJobSize)),
 		compileTimeout: defaultCompileTimeout,
+		workspaces:     0,
+		workspaceIdle:  defaultWorkspaceIdle,
+		workspaceQuota: units.BytesSize(float64(defaultWorkspaceQuota)),
 		engine:         tex.DefaultEngine.Name(),
 		shellEscape:    0,
+		magic:          "all",
+		tools:          "all",
+		envVars:        "all",
 		jobDir:         "",
 		keepJobs:       service.KeepJobsNever,
 		pull:           false,
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	osexec "os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/digineo/texd/exec"
+	"github.com/digineo/texd/refstore"
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+	"github.com/docker/go-units"
+)
+
+// errChecksFailed is returned by runDoctor, if at least one check failed.
+var errChecksFailed = errors.New("environment checks failed")
+
+// swapped in tests.
+var (
+	lookPath        = osexec.LookPath
+	localExecutor   = exec.LocalExec
+	newDockerClient = exec.NewDockerClient
+)
+
+// doctorDocument is compiled once per engine and image.
+const doctorDocument = `\documentclass{article}
+\begin{document}
+texd doctor
+\end{document}
+`
+
+type checkStatus string
+
+const (
+	checkPass checkStatus = "pass"
+	checkFail checkStatus = "fail"
+	checkSkip checkStatus = "skip"
+)
+
+type checkResult struct {
+	Name    string      `json:"name"`
+	Status  checkStatus `json:"status"`
+	Message string      `json:"message,omitempty"`
+	Fix     string      `json:"fix,omitempty"`
+}
+
+type doctorReport struct {
+	Mode   string        `json:"mode"`
+	OK     bool          `json:"ok"`
+	Checks []checkResult `json:"checks"`
+}
+
+func (r *doctorReport) pass(name, message string) {
+	r.Checks = append(r.Checks, checkResult{Name: name, Status: checkPass, Message: message})
+}
+
+func (r *doctorReport) fail(name string, err error, fix string) {
+	r.OK = false
+	r.Checks = append(r.Checks, checkResult{Name: name, Status: checkFail, Message: err.Error(), Fix: fix})
+}
+
+func (r *doctorReport) skip(name, reason string) {
+	r.Checks = append(r.Checks, checkResult{Name: name, Status: checkSkip, Message: reason})
+}
+
+// runDoctor checks the environment implied by cfg (job directory, TeX
+// installation or Docker setup, reference store), and compiles a small
+// test document with each supported engine in each configured image.
+// The report is written to w, either as text or as JSON.
+func runDoctor(cfg *config, log xlog.Logger, w io.Writer) error {
+	report := diagnose(cfg, log)
+
+	var err error
+	if cfg.doctorJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = report.print(w)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	if !report.OK {
+		return errChecksFailed
+	}
+	return nil
+}
+
+func diagnose(cfg *config, log xlog.Logger) *doctorReport { //nolint:funlen
+	report := &doctorReport{Mode: "local", OK: true}
+	if len(cfg.images) > 0 {
+		report.Mode = "container"
+	}
+	canCompile := true
+
+	// same configuration as the server (see configureTeX), but continue
+	// on failures to report all of them
+	for _, s := range texSettings {
+		summary, err := s.apply(cfg)
+		switch {
+		case err != nil:
+			canCompile = canCompile && !s.required
+			report.fail(s.check, err, s.fix)
+		case summary != "":
+			report.pass(s.check, summary)
+		}
+	}
+
+	if _, err := units.FromHumanSize(cfg.maxJobSize); err != nil {
+		report.fail("max job size", err, "use a size like 50MiB with --max-job-size")
+	} else {
+		report.pass("max job size", cfg.maxJobSize)
+	}
+
+	if cfg.storageDSN != "" {
+		diagnoseRefStore(cfg, report)
+	}
+
+	executor := localExecutor
+	images := []string{""}
+	var (
+		imageEngines map[string][]string
+		probe        exec.Prober
+	)
+	if report.Mode == "local" {
+		for _, compiler := range usedCompilers() {
+			if path, err := lookPath(compiler); err != nil {
+				canCompile = false
+				report.fail(compiler, err, fmt.Sprintf(
+					"install a TeX distribution including %s and add it to $PATH, or pass Docker images to run in container mode",
+					compiler))
+			} else {
+				report.pass(compiler, path)
+			}
+		}
+	} else {
+		cli, err := newDockerClient(log, tex.JobBaseDir())
+		switch {
+		case errors.Is(err, exec.ErrMissingWorkdirVolume):
+			canCompile = false
+			report.fail("docker", err,
+				"mount the job directory as volume or bind mount at the same path into the texd container")
+		case err != nil:
+			canCompile = false
+			report.fail("docker", err,
+				"check DOCKER_HOST, and make sure the texd user may access the Docker socket (e.g. by adding it to the docker group)")
+		default:
+			report.pass("docker", "connected")
+			images, err = cli.SetImages(context.Background(), cfg.pull, cfg.images...)
+			if err != nil {
+				canCompile = false
+				report.fail("images", err, "check the image names and your registry access, or pull the images manually")
+			} else {
+				report.pass("images", fmt.Sprint(images))
+				executor = cli.Executor
+				probe = cli.Probe
+			}
+			if imageEngines, err = parseImageEngines(cfg.imageEngines, images); err != nil {
+				report.fail("image engines", err, "check the restrictions given with --image-engines")
+			}
+		}
+	}
+
+	if len(cfg.signingKeys) > 0 {
+		switch {
+		case report.Mode == "local":
+			diagnoseSigning(report, nil, nil)
+		case probe == nil:
+			report.skip("pyhanko", "previous checks failed")
+		default:
+			diagnoseSigning(report, probe, images)
+		}
+	}
+
+	for _, image := range images {
+		engines, ok := imageEngines[image]
+		if !ok {
+			engines = tex.SupportedEngines()
+		}
+		for _, name := range engines {
+			check := "compile " + name
+			if image != "" {
+				check += " in " + image
+			}
+			if !canCompile {
+				report.skip(check, "previous checks failed")
+				continue
+			}
+			if err := compileTestDocument(cfg, log, executor, name, image); err != nil {
+				report.fail(check, err, "inspect the compilation output, the engine or some base packages might be missing")
+			} else {
+				report.pass(check, "ok")
+			}
+		}
+	}
+
+	return report
+}
+
+// usedCompilers returns the names of compilers used by any supported
+// engine. The names match the executable names.
+func usedCompilers() (names []string) {
+	for _, name := range tex.SupportedEngines() {
+		engine, _ := tex.ParseEngine(name)
+		if c := engine.Compiler().Name(); !slices.Contains(names, c) {
+			names = append(names, c)
+		}
+	}
+	return names
+}
+
+func diagnoseRefStore(cfg *config, report *doctorReport) {
+	const name = "reference store"
+
+	rp, err := createRetentionPolicy(cfg.retPolicy, cfg.retPolItems, cfg.retPolSize)
+	if err != nil {
+		report.fail(name, err, "check --retention-policy, --rp-access-items and --rp-access-size")
+		return
+	}
+	adapter, err := refstore.NewStore(cfg.storageDSN, rp)
+	if err != nil {
+		report.fail(name, err, "check the DSN given with --reference-store")
+		return
+	}
+	if p, ok := adapter.(refstore.Pinger); ok {
+		if err := p.Ping(); err != nil {
+			report.fail(name, err, "make sure the storage backend is running and reachable from this host")
+			return
+		}
+	}
+	report.pass(name, cfg.storageDSN)
+}
+
+// diagnoseSigning checks whether pyHanko (required for --signing-key) is
+// installed in each image, or locally if probe is nil.
+func diagnoseSigning(report *doctorReport, probe exec.Prober, images []string) {
+	const fix = "install pyHanko (e.g. with pip install pyhanko), it is not part of TeX Live"
+	if probe == nil {
+		if path, err := lookPath("pyhanko"); err != nil {
+			report.fail("pyhanko", err, fix)
+		} else {
+			report.pass("pyhanko", path)
+		}
+		return
+	}
+	for _, image := range images {
+		check := "pyhanko in " + image
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		out, err := probe(ctx, image, []string{"pyhanko", "--version"})
+		cancel()
+		if err != nil {
+			report.fail(check, err, fix+", extend the image accordingly")
+		} else {
+			report.pass(check, strings.TrimSpace(string(out)))
+		}
+	}
+}
+
+func compileTestDocument(cfg *config, log xlog.Logger, executor func(exec.Document) exec.Exec, name, image string) error {
+	engine, err := tex.ParseEngine(name)
+	if err != nil {
+		return err
+	}
+
+	doc := tex.NewDocument(log, engine, image)
+	defer func() { _ = doc.Cleanup() }()
+
+	if err := doc.AddFile("input.tex", doctorDocument); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if cfg.compileTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.compileTimeout)
+		defer cancel()
+	}
+	if err := executor(doc).Run(ctx, log); err != nil {
+		var catErr *tex.ErrWithCategory
+		if errors.As(err, &catErr) {
+			if output, ok := catErr.Extra()["output"]; ok && output != "" {
+				return fmt.Errorf("%w\n%v", err, output)
+			}
+		}
+		return err
+	}
+
+	pdf, err := doc.GetResult()
+	if err != nil {
+		return err
+	}
+	return pdf.Close()
+}
+
+func (r *doctorReport) print(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "Mode: %s\n\n", r.Mode); err != nil {
+		return err
+	}
+	for _, c := range r.Checks {
+		if _, err := fmt.Fprintf(w, "[%s] %s: %s\n", c.Status, c.Name, c.Message); err != nil {
+			return err
+		}
+		if c.Fix != "" {
+			if _, err := fmt.Fprintf(w, "       fix: %s\n", c.Fix); err != nil {
+				return err
+			}
+		}
+	}
+
+	summary := "\nAll checks passed.\n"
+	if !r.OK {
+		summary = "\nSome checks failed.\n"
+	}
+	_, err := io.WriteString(w, summary)
+	return err
+}
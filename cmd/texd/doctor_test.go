@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/digineo/texd/exec"
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func swapDoctorDeps(t *testing.T, path string, pathErr error, executor func(exec.Document) exec.Exec) {
+	t.Helper()
+
+	origLookPath, origExecutor := lookPath, localExecutor
+	t.Cleanup(func() {
+		lookPath, localExecutor = origLookPath, origExecutor
+		_ = tex.SetJobBaseDir("")
+		_ = tex.SetDefaultEngine("xelatex")
+	})
+
+	lookPath = func(string) (string, error) { return path, pathErr }
+	localExecutor = executor
+}
+
+func TestDiagnose_local(t *testing.T) {
+	swapDoctorDeps(t, "/usr/bin/latexmk", nil, exec.Mock(false, "%PDF-1.5"))
+
+	report := diagnose(defaultConfig(), xlog.NewDiscard())
+	require.True(t, report.OK, "%+v", report.Checks)
+	assert.Equal(t, "local", report.Mode)
+
+	names := make([]string, 0, len(report.Checks))
+	for _, c := range report.Checks {
+		assert.Equal(t, checkPass, c.Status, c.Name)
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{
+		"job directory",
+		"default engine",
+		"max job size",
+		"latexmk",
+		"compile xelatex",
+		"compile pdflatex",
+		"compile lualatex",
+	}, names)
+}
+
+func TestDiagnose_compileFailure(t *testing.T) {
+	swapDoctorDeps(t, "/usr/bin/latexmk", nil, exec.Mock(true, "! Emergency stop."))
+
+	report := diagnose(defaultConfig(), xlog.NewDiscard())
+	require.False(t, report.OK)
+
+	last := report.Checks[len(report.Checks)-1]
+	assert.Equal(t, "compile lualatex", last.Name)
+	assert.Equal(t, checkFail, last.Status)
+	assert.Equal(t, "compilation failed", last.Message)
+	assert.NotEmpty(t, last.Fix)
+}
+
+func TestDiagnose_missingLatexmk(t *testing.T) {
+	swapDoctorDeps(t, "", errors.New("not found"), exec.Mock(false, "%PDF-1.5"))
+
+	cfg := defaultConfig()
+	cfg.engine = "dings"
+	cfg.storageDSN = "unknown://"
+
+	report := diagnose(cfg, xlog.NewDiscard())
+	require.False(t, report.OK)
+
+	status := make(map[string]checkStatus)
+	for _, c := range report.Checks {
+		status[c.Name] = c.Status
+	}
+	assert.Equal(t, map[string]checkStatus{
+		"job directory":    checkPass,
+		"default engine":   checkFail,
+		"max job size":     checkPass,
+		"reference store":  checkFail,
+		"latexmk":          checkFail,
+		"compile xelatex":  checkSkip,
+		"compile pdflatex": checkSkip,
+		"compile lualatex": checkSkip,
+	}, status)
+}
+
+func TestDiagnose_configuration(t *testing.T) {
+	swapDoctorDeps(t, "/usr/bin/latexmk", nil, exec.Mock(false, "%PDF-1.5"))
+	t.Cleanup(func() {
+		_ = tex.SetAllowedTools(tex.SupportedTools())
+		_ = tex.SetAllowedEnvVars(tex.SupportedEnvVars())
+		_ = tex.SetMagicComments(tex.MagicKeys)
+	})
+
+	// the doctor applies the configuration like the server
+	cfg := defaultConfig()
+	cfg.tools = "biber"
+	cfg.envVars = "none"
+	cfg.magic = "perl"
+
+	report := diagnose(cfg, xlog.NewDiscard())
+	require.False(t, report.OK)
+	checks := make(map[string]checkResult)
+	for _, c := range report.Checks {
+		checks[c.Name] = c
+	}
+	assert.Equal(t, checkResult{Name: "tools", Status: checkPass, Message: "[biber]"}, checks["tools"])
+	assert.Equal(t, checkResult{Name: "environment variables", Status: checkPass, Message: "[]"},
+		checks["environment variables"])
+	assert.Equal(t, checkFail, checks["magic comments"].Status)
+	assert.Contains(t, checks["magic comments"].Fix, "--magic-comments")
+	assert.Equal(t, checkPass, checks["compile xelatex"].Status)
+
+	assert.Equal(t, []string{"biber"}, tex.AllowedTools())
+	assert.Empty(t, tex.AllowedEnvVars())
+}
+
+func TestDiagnose_signing(t *testing.T) {
+	swapDoctorDeps(t, "/usr/bin/latexmk", nil, exec.Mock(false, "%PDF-1.5"))
+	lookPath = func(name string) (string, error) {
+		if name == "pyhanko" {
+			return "", errors.New("not found")
+		}
+		return "/usr/bin/" + name, nil
+	}
+
+	cfg := defaultConfig()
+	cfg.signingKeys = []string{"contracts=cert=sign.crt&key=sign.key"}
+
+	report := diagnose(cfg, xlog.NewDiscard())
+	require.False(t, report.OK)
+	i := slices.IndexFunc(report.Checks, func(c checkResult) bool { return c.Name == "pyhanko" })
+	require.GreaterOrEqual(t, i, 0)
+	assert.Equal(t, checkFail, report.Checks[i].Status)
+	assert.Contains(t, report.Checks[i].Fix, "pip install pyhanko")
+
+	lookPath = func(name string) (string, error) { return "/usr/bin/" + name, nil }
+	report = diagnose(cfg, xlog.NewDiscard())
+	require.True(t, report.OK, "%+v", report.Checks)
+}
+
+func TestRunDoctor_output(t *testing.T) {
+	swapDoctorDeps(t, "/usr/bin/latexmk", nil, exec.Mock(false, "%PDF-1.5"))
+
+	cfg := defaultConfig()
+
+	var text bytes.Buffer
+	require.NoError(t, runDoctor(cfg, xlog.NewDiscard(), &text))
+	assert.Contains(t, text.String(), "[pass] latexmk: /usr/bin/latexmk\n")
+	assert.Contains(t, text.String(), "All checks passed.")
+
+	cfg.doctorJSON = true
+	var raw bytes.Buffer
+	require.NoError(t, runDoctor(cfg, xlog.NewDiscard(), &raw))
+
+	var report doctorReport
+	require.NoError(t, json.Unmarshal(raw.Bytes(), &report))
+	assert.True(t, report.OK)
+	assert.Equal(t, "local", report.Mode)
+	assert.Len(t, report.Checks, 7)
+}
+
+func TestRunDoctor_failure(t *testing.T) {
+	swapDoctorDeps(t, "", errors.New("not found"), exec.Mock(false, "%PDF-1.5"))
+
+	var buf bytes.Buffer
+	err := runDoctor(defaultConfig(), xlog.NewDiscard(), &buf)
+	require.ErrorIs(t, err, errChecksFailed)
+	assert.Contains(t, buf.String(), "[fail] latexmk: not found\n       fix: ")
+	assert.Contains(t, buf.String(), "[skip] compile xelatex: previous checks failed\n")
+	assert.Contains(t, buf.String(), "Some checks failed.")
+}
+
+func TestUsedCompilers(t *testing.T) {
+	t.Cleanup(func() { _ = tex.SetDefaultEngine("xelatex") })
+
+	assert.Equal(t, "latexmk", usedCompilers()[0])
+
+	// note: engines can't be removed, other tests must not rely on the exact list
+	require.NoError(t, registerEngines([]string{"tectonic=tectonic:"}))
+	assert.Equal(t, []string{"latexmk", "tectonic"}, usedCompilers())
+}
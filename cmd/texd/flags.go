@@ -128,6 +128,33 @@ func buildApp(progname string, stderr io.Writer, cfg *config, shellEscape, noShe
 				Category:    catServer,
 				Destination: &cfg.compileTimeout,
 			},
+			&cli.IntFlag{
+				Name:        "workspaces",
+				Value:       cfg.workspaces,
+				Usage:       "maximum `number` of persistent workspaces, a value <= 0 disables workspaces",
+				Category:    catServer,
+				Destination: &cfg.workspaces,
+			},
+			&cli.DurationFlag{
+				Name:        "workspace-idle",
+				Value:       cfg.workspaceIdle,
+				Usage:       "idle time after which workspaces expire",
+				Category:    catServer,
+				Destination: &cfg.workspaceIdle,
+			},
+			&cli.StringFlag{
+				Name:        "workspace-quota",
+				Value:       cfg.workspaceQuota,
+				Usage:       "maximum size of a workspace, including auxiliary files",
+				Category:    catServer,
+				Destination: &cfg.workspaceQuota,
+			},
+			&cli.StringSliceFlag{
+				Name:        "api-key",
+				Usage:       "require API keys, defined with `name=params`, where params is a URL query string with the secret and optionally allowed profiles (may be repeated)",
+				Category:    catServer,
+				Destination: &cfg.apiKeys,
+			},
 
 			// TeX Options
 			&cli.StringFlag{
@@ -138,6 +165,12 @@ func buildApp(progname string, stderr io.Writer, cfg *config, shellEscape, noShe
 				Category:    catTeX,
 				Destination: &cfg.engine,
 			},
+			&cli.StringSliceFlag{
+				Name:        "engine",
+				Usage:       "add or redefine a TeX engine with `name=flags`, where flags are space separated latexmk flags (may be repeated)",
+				Category:    catTeX,
+				Destination: &cfg.engines,
+			},
 			&cli.BoolFlag{
 				Name:        "shell-escape",
 				Usage:       "enable shell escaping to arbitrary commands (mutually exclusive with --no-shell-escape)",
@@ -150,6 +183,57 @@ func buildApp(progname string, stderr io.Writer, cfg *config, shellEscape, noShe
 				Category:    catTeX,
 				Destination: noShellEscape,
 			},
+			&cli.BoolFlag{
+				Name:        "detect-encoding",
+				Usage:       "convert TeX and data files in legacy encodings (e.g. Latin-1) to UTF-8, and normalize file names",
+				Category:    catTeX,
+				Destination: &cfg.transcode,
+			},
+			&cli.BoolFlag{
+				Name:        "no-package-check",
+				Usage:       "only warn about packages missing from the package index, instead of rejecting documents",
+				Category:    catTeX,
+				Destination: &cfg.noPkgCheck,
+			},
+			&cli.StringSliceFlag{
+				Name:        "profile",
+				Usage:       "define a render profile with `name=params`, where params is a URL query string (may be repeated)",
+				Category:    catTeX,
+				Destination: &cfg.profiles,
+			},
+			&cli.StringSliceFlag{
+				Name:        "signing-key",
+				Usage:       "define a PDF signing key with `name=params`, where params is a URL query string referencing PEM or PKCS#12 files (may be repeated)",
+				Category:    catTeX,
+				Destination: &cfg.signingKeys,
+			},
+			&cli.StringSliceFlag{
+				Name:        "error-code",
+				Usage:       "map TeX errors to a custom error code with `code=params`, where params is a URL query string with a pattern and an optional hint (may be repeated)",
+				Category:    catTeX,
+				Destination: &cfg.errorCodes,
+			},
+			&cli.StringFlag{
+				Name:        "magic-comments",
+				Value:       cfg.magic,
+				Usage:       fmt.Sprintf("comma separated `keys` documents may set with magic comments, \"all\" or \"none\" (keys: %v)", tex.MagicKeys),
+				Category:    catTeX,
+				Destination: &cfg.magic,
+			},
+			&cli.StringFlag{
+				Name:        "tools",
+				Value:       cfg.tools,
+				Usage:       fmt.Sprintf("comma separated auxiliary `tools` clients may enable, \"all\" or \"none\" (tools: %v)", tex.SupportedTools()),
+				Category:    catTeX,
+				Destination: &cfg.tools,
+			},
+			&cli.StringFlag{
+				Name:        "env-vars",
+				Value:       cfg.envVars,
+				Usage:       fmt.Sprintf("comma separated environment variable `names` clients may set, \"all\" or \"none\" (variables: %v)", tex.SupportedEnvVars()),
+				Category:    catTeX,
+				Destination: &cfg.envVars,
+			},
 			&cli.StringFlag{
 				Name:        "job-directory",
 				Aliases:     []string{"D"},
@@ -181,6 +265,12 @@ func buildApp(progname string, stderr io.Writer, cfg *config, shellEscape, noShe
 				Category:    catDocker,
 				Destination: &cfg.pull,
 			},
+			&cli.StringSliceFlag{
+				Name:        "image-engines",
+				Usage:       "restrict engines available in an image with `image=name[,name...]` (may be repeated)",
+				Category:    catDocker,
+				Destination: &cfg.imageEngines,
+			},
 
 			// Reference Store Options
 			&cli.StringFlag{
@@ -237,6 +327,27 @@ func buildApp(progname string, stderr io.Writer, cfg *config, shellEscape, noShe
 				Destination: &cfg.showVersion,
 			},
 		},
+		Commands: []*cli.Command{
+			{
+				Name:      "doctor",
+				Usage:     "check the environment implied by the given flags, and exit",
+				ArgsUsage: "[images...]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:        "json",
+						Usage:       "print report as JSON",
+						Destination: &cfg.doctorJSON,
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					cfg.doctor = true
+					if action == nil {
+						return nil
+					}
+					return action(ctx, cmd)
+				},
+			},
+		},
 		Action: action,
 	}
 }
@@ -100,6 +100,15 @@ func TestParseFlags(t *testing.T) { //nolint: funlen
 				assert.Equal(t, "100MB", cfg.maxJobSize)
 			},
 		},
+		{
+			name: "workspaces",
+			args: []string{"--workspaces", "4", "--workspace-idle", "5m", "--workspace-quota", "20MB"},
+			want: func(cfg *config) {
+				assert.Equal(t, 4, cfg.workspaces)
+				assert.Equal(t, 5*time.Minute, cfg.workspaceIdle)
+				assert.Equal(t, "20MB", cfg.workspaceQuota)
+			},
+		},
 		{
 			name: "queue wait",
 			args: []string{"-w", "30s"},
@@ -205,6 +214,25 @@ func TestParseFlags(t *testing.T) { //nolint: funlen
 				assert.Equal(t, []string{"image1:latest", "image2:v1.0"}, cfg.images)
 			},
 		},
+		{
+			name: "doctor",
+			args: []string{"-D", "/tmp/jobs", "doctor", "image1:latest"},
+			want: func(cfg *config) {
+				assert.True(t, cfg.doctor)
+				assert.False(t, cfg.doctorJSON)
+				assert.Equal(t, "/tmp/jobs", cfg.jobDir)
+				assert.Equal(t, []string{"image1:latest"}, cfg.images)
+			},
+		},
+		{
+			name: "doctor json",
+			args: []string{"doctor", "--json"},
+			want: func(cfg *config) {
+				assert.True(t, cfg.doctor)
+				assert.True(t, cfg.doctorJSON)
+				assert.Empty(t, cfg.images)
+			},
+		},
 		{
 			name: "combined flags",
 			args: []string{
@@ -12,8 +12,9 @@ import (
 )
 
 const (
-	exitSuccess = 0
-	exitFlagErr = 2
+	exitSuccess  = 0
+	exitCheckErr = 1
+	exitFlagErr  = 2
 )
 
 func main() {
@@ -29,11 +30,13 @@ func main() {
 
 // run is the main application logic, separated from main() for testability.
 func run(args []string, stdout, stderr io.Writer) (int, error) {
-	// Print banner
-	texd.PrintBanner(stdout)
-
 	// Parse flags
 	cfg, err := parseFlags(args[0], args[1:], stderr)
+
+	// Print banner, unless it would garble machine-readable output
+	if err != nil || !cfg.doctor || !cfg.doctorJSON {
+		texd.PrintBanner(stdout)
+	}
 	if err != nil {
 		if errors.Is(err, errHelpRequested) {
 			return exitSuccess, errHelpRequested
@@ -53,6 +56,14 @@ func run(args []string, stdout, stderr io.Writer) (int, error) {
 	}
 	defer sync()
 
+	// Run diagnostics instead of the service
+	if cfg.doctor {
+		if err := runDoctor(cfg, log, stdout); err != nil {
+			return exitCheckErr, err
+		}
+		return exitSuccess, nil
+	}
+
 	// Configure TeX package
 	if err := configureTeX(cfg, log); err != nil {
 		return exitFlagErr, err
@@ -2,9 +2,12 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"testing"
 
+	"github.com/digineo/texd/tex"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRun_HelpFlag(t *testing.T) {
@@ -62,3 +65,20 @@ func TestRun_MutuallyExclusiveFlags(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "mutually exclusive")
 }
+
+func TestRun_DoctorJSON(t *testing.T) {
+	t.Cleanup(func() { _ = tex.SetJobBaseDir("") })
+
+	for _, flag := range []string{"--json", "-json", "--json=true"} {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+
+		// the job directory doesn't exist, no compilation is attempted
+		_, err := run([]string{"texd", "-D", "/nonexistent", "doctor", flag}, stdout, stderr)
+		require.ErrorIs(t, err, errChecksFailed, flag)
+
+		var report doctorReport
+		require.NoError(t, json.Unmarshal(stdout.Bytes(), &report), flag) // no banner
+		assert.False(t, report.OK, flag)
+	}
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/digineo/texd/exec"
 	"github.com/digineo/texd/refstore"
@@ -14,31 +17,138 @@ import (
 	"github.com/docker/go-units"
 )
 
-// configureTeX sets up the tex package globals based on config.
-func configureTeX(cfg *config, log xlog.Logger) error {
-	if err := tex.SetJobBaseDir(cfg.jobDir); err != nil {
-		log.Error("error setting job directory",
-			xlog.String("flag", "--job-directory"),
-			xlog.Error(err))
-		return err
-	}
+// A texSetting configures one aspect of the tex package globals. The
+// settings are shared by configureTeX and the doctor subcommand, so the
+// doctor checks the same configuration the server uses.
+type texSetting struct {
+	check string // name of the doctor check
+	flag  string // flag of the setting
+	msg   string // log message on failure
+	fix   string // doctor hint on failure
 
-	if err := tex.SetDefaultEngine(cfg.engine); err != nil {
-		log.Error("error setting default TeX engine",
-			xlog.String("flag", "--tex-engine"),
-			xlog.Error(err))
-		return err
+	// required settings must succeed, before the doctor compiles test
+	// documents
+	required bool
+
+	// apply configures the setting. The summary is reported by the
+	// doctor, it is empty for defaults.
+	apply func(cfg *config) (summary string, err error)
+}
+
+// listSummary summarizes a list flag (see parseList) for the doctor.
+func listSummary(flag string, names []string) string {
+	if flag == "all" {
+		return ""
 	}
+	return fmt.Sprint(names)
+}
 
-	// Handle shell escaping tri-state: 0=default, 1=enable, -1=disable
-	if cfg.shellEscape != 0 {
-		if cfg.shellEscape > 0 {
+var texSettings = []texSetting{{
+	check:    "job directory",
+	flag:     "--job-directory",
+	msg:      "error setting job directory",
+	fix:      "create the directory and make it writable for the texd user, or select another one with --job-directory",
+	required: true,
+	apply: func(cfg *config) (string, error) {
+		if err := tex.SetJobBaseDir(cfg.jobDir); err != nil {
+			return "", err
+		}
+		return tex.JobBaseDir(), nil
+	},
+}, {
+	check: "custom engines",
+	flag:  "--engine",
+	msg:   "error adding TeX engine",
+	fix:   "check the definitions given with --engine",
+	apply: func(cfg *config) (string, error) {
+		if err := registerEngines(cfg.engines); err != nil || len(cfg.engines) == 0 {
+			return "", err
+		}
+		return fmt.Sprint(tex.SupportedEngines()), nil
+	},
+}, {
+	check: "error codes",
+	flag:  "--error-code",
+	msg:   "error adding error pattern",
+	fix:   "check the definitions given with --error-code",
+	apply: func(cfg *config) (string, error) {
+		if err := registerErrorPatterns(cfg.errorCodes); err != nil || len(cfg.errorCodes) == 0 {
+			return "", err
+		}
+		return fmt.Sprint(tex.ErrorCodes()), nil
+	},
+}, {
+	check: "default engine",
+	flag:  "--tex-engine",
+	msg:   "error setting default TeX engine",
+	fix:   "select one of the supported engines (or a custom one, see --engine) with --tex-engine",
+	apply: func(cfg *config) (string, error) {
+		if err := tex.SetDefaultEngine(cfg.engine); err != nil {
+			return "", err
+		}
+		return tex.DefaultEngine.Name(), nil
+	},
+}, {
+	check: "magic comments",
+	flag:  "--magic-comments",
+	msg:   "error setting magic comment keys",
+	fix:   fmt.Sprintf("use all, none, or a list of %v with --magic-comments", tex.MagicKeys),
+	apply: func(cfg *config) (string, error) {
+		err := tex.SetMagicComments(parseList(cfg.magic, tex.MagicKeys))
+		return listSummary(cfg.magic, tex.AllowedMagicComments()), err
+	},
+}, {
+	check: "tools",
+	flag:  "--tools",
+	msg:   "error setting auxiliary tools",
+	fix:   fmt.Sprintf("use all, none, or a list of %v with --tools", tex.SupportedTools()),
+	apply: func(cfg *config) (string, error) {
+		err := tex.SetAllowedTools(parseList(cfg.tools, tex.SupportedTools()))
+		return listSummary(cfg.tools, tex.AllowedTools()), err
+	},
+}, {
+	check: "environment variables",
+	flag:  "--env-vars",
+	msg:   "error setting environment variables",
+	fix:   fmt.Sprintf("use all, none, or a list of %v with --env-vars", tex.SupportedEnvVars()),
+	apply: func(cfg *config) (string, error) {
+		err := tex.SetAllowedEnvVars(parseList(cfg.envVars, tex.SupportedEnvVars()))
+		return listSummary(cfg.envVars, tex.AllowedEnvVars()), err
+	},
+}, {
+	check: "shell escape",
+	flag:  "--shell-escape",
+	apply: func(cfg *config) (string, error) {
+		// Handle shell escaping tri-state: 0=default, 1=enable, -1=disable
+		switch {
+		case cfg.shellEscape > 0:
 			_ = tex.SetShellEscaping(tex.AllowedShellEscape)
-		} else {
+			return "allowed", nil
+		case cfg.shellEscape < 0:
 			_ = tex.SetShellEscaping(tex.ForbiddenShellEscape)
+			return "forbidden", nil
 		}
-	}
+		return "", nil
+	},
+}, {
+	check: "encoding detection",
+	flag:  "--detect-encoding",
+	apply: func(cfg *config) (string, error) {
+		tex.SetEncodingDetection(cfg.transcode)
+		return "", nil
+	},
+}}
 
+// configureTeX sets up the tex package globals based on config.
+func configureTeX(cfg *config, log xlog.Logger) error {
+	for _, s := range texSettings {
+		if _, err := s.apply(cfg); err != nil {
+			log.Error(s.msg,
+				xlog.String("flag", s.flag),
+				xlog.Error(err))
+			return err
+		}
+	}
 	return nil
 }
 
@@ -51,7 +161,11 @@ func buildServiceOptions(cfg *config, log xlog.Logger) (service.Options, error)
 		CompileTimeout: cfg.compileTimeout,
 		Mode:           "local",
 		Executor:       exec.LocalExec,
+		Prober:         exec.LocalProbe,
+		NoPackageCheck: cfg.noPkgCheck,
 		KeepJobs:       cfg.keepJobs,
+		Workspaces:     cfg.workspaces,
+		WorkspaceIdle:  cfg.workspaceIdle,
 	}
 
 	// Parse and set max job size
@@ -64,6 +178,50 @@ func buildServiceOptions(cfg *config, log xlog.Logger) (service.Options, error)
 		opts.MaxJobSize = maxsz
 	}
 
+	if cfg.workspaceQuota != "" {
+		quota, err := units.FromHumanSize(cfg.workspaceQuota)
+		if err != nil {
+			log.Error("error parsing workspace quota",
+				xlog.String("flag", "--workspace-quota"),
+				xlog.Error(err))
+			return opts, err
+		}
+		opts.WorkspaceQuota = quota
+	}
+
+	for _, def := range cfg.profiles {
+		profile, err := service.ParseProfile(def)
+		if err != nil {
+			log.Error("error parsing render profile",
+				xlog.String("flag", "--profile"),
+				xlog.Error(err))
+			return opts, err
+		}
+		opts.Profiles = append(opts.Profiles, profile)
+	}
+
+	for _, def := range cfg.signingKeys {
+		key, err := tex.ParseSigningKey(def)
+		if err != nil {
+			log.Error("error loading signing key",
+				xlog.String("flag", "--signing-key"),
+				xlog.Error(err))
+			return opts, err
+		}
+		opts.SigningKeys = append(opts.SigningKeys, key)
+	}
+
+	for _, def := range cfg.apiKeys {
+		key, err := service.ParseAPIKey(def)
+		if err != nil {
+			log.Error("error loading API key",
+				xlog.String("flag", "--api-key"),
+				xlog.Error(err))
+			return opts, err
+		}
+		opts.APIKeys = append(opts.APIKeys, key)
+	}
+
 	// Setup reference store if configured
 	if cfg.storageDSN != "" {
 		rp, err := createRetentionPolicy(cfg.retPolicy, cfg.retPolItems, cfg.retPolSize)
@@ -101,11 +259,95 @@ func buildServiceOptions(cfg *config, log xlog.Logger) (service.Options, error)
 		}
 		opts.Mode = "container"
 		opts.Executor = cli.Executor
+		opts.Prober = cli.Probe
+
+		opts.ImageEngines, err = parseImageEngines(cfg.imageEngines, opts.Images)
+		if err != nil {
+			log.Error("error parsing engine restrictions",
+				xlog.String("flag", "--image-engines"),
+				xlog.Error(err))
+			return opts, err
+		}
+	} else if len(cfg.imageEngines) > 0 {
+		log.Warn("ignoring engine restrictions in local mode",
+			xlog.String("flag", "--image-engines"))
 	}
 
 	return opts, nil
 }
 
+// registerEngines parses custom engine definitions and makes them
+// available in the tex package.
+func registerEngines(defs []string) error {
+	for _, def := range defs {
+		engine, err := tex.ParseEngineDefinition(def)
+		if err != nil {
+			return err
+		}
+		if err := tex.AddEngine(engine); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerErrorPatterns parses custom error patterns and adds them to
+// the catalogue in the tex package.
+func registerErrorPatterns(defs []string) error {
+	for _, def := range defs {
+		p, err := tex.ParseErrorPattern(def)
+		if err != nil {
+			return err
+		}
+		tex.AddErrorPattern(p)
+	}
+	return nil
+}
+
+// parseList parses a comma separated list of keys, as used for
+// --magic-comments, --tools and --env-vars. "all" expands to the given keys.
+func parseList(s string, all []string) (keys []string) {
+	switch s = strings.TrimSpace(s); s {
+	case "all":
+		return all
+	case "", "none":
+		return nil
+	}
+	for key := range strings.SplitSeq(s, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// parseImageEngines parses "image=name,name" restrictions. The image
+// must be one of the given known images, and each engine name must be
+// supported.
+func parseImageEngines(defs []string, images []string) (map[string][]string, error) {
+	if len(defs) == 0 {
+		return nil, nil
+	}
+
+	result := make(map[string][]string, len(defs))
+	for _, def := range defs {
+		image, names, ok := strings.Cut(def, "=")
+		if !ok || image == "" || names == "" {
+			return nil, fmt.Errorf("invalid engine restriction %q: expected image=name[,name...]", def)
+		}
+		if !slices.Contains(images, image) {
+			return nil, fmt.Errorf("invalid engine restriction %q: unknown image %q", def, image)
+		}
+		for _, name := range strings.Split(names, ",") {
+			if _, err := tex.ParseEngine(name); err != nil {
+				return nil, fmt.Errorf("invalid engine restriction %q: %w", def, err)
+			}
+			result[image] = append(result[image], name)
+		}
+	}
+	return result, nil
+}
+
 // createRetentionPolicy creates a retention policy based on the given parameters.
 func createRetentionPolicy(policy int, items int, size string) (refstore.RetentionPolicy, error) {
 	switch policy {
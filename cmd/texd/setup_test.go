@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/digineo/texd/service"
+	"github.com/digineo/texd/tex"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -143,6 +144,22 @@ func TestConfigureTeX(t *testing.T) { //nolint: funlen
 			},
 			wantErr: true,
 		},
+		{
+			name: "invalid environment variable",
+			cfg: &config{
+				engine:  "pdflatex",
+				envVars: "TZ,PATH",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid error code",
+			cfg: &config{
+				engine:     "pdflatex",
+				errorCodes: []string{"minted=hint=no+pattern"},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -241,6 +258,80 @@ func TestBuildServiceOptions(t *testing.T) { //nolint: funlen
 			},
 			wantErr: true,
 		},
+		{
+			name: "profiles",
+			cfg: &config{
+				maxJobSize: "50MB",
+				profiles:   []string{"invoice=engine=lualatex&strict=true"},
+			},
+			wantErr: false,
+			check: func(t *testing.T, opts service.Options) {
+				require.Len(t, opts.Profiles, 1)
+				assert.Equal(t, "invoice", opts.Profiles[0].Name)
+				assert.Equal(t, "lualatex", opts.Profiles[0].Params.Get("engine"))
+			},
+		},
+		{
+			name: "workspaces",
+			cfg: &config{
+				maxJobSize:     "50MB",
+				workspaces:     8,
+				workspaceIdle:  time.Minute,
+				workspaceQuota: "10MB",
+			},
+			wantErr: false,
+			check: func(t *testing.T, opts service.Options) {
+				assert.Equal(t, 8, opts.Workspaces)
+				assert.Equal(t, time.Minute, opts.WorkspaceIdle)
+				assert.EqualValues(t, 10_000_000, opts.WorkspaceQuota)
+			},
+		},
+		{
+			name: "invalid workspace quota",
+			cfg: &config{
+				maxJobSize:     "50MB",
+				workspaceQuota: "invalid",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid signing key",
+			cfg: &config{
+				maxJobSize:  "50MB",
+				signingKeys: []string{"contracts=cert=/nonexistent.crt&key=/nonexistent.key"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "API keys",
+			cfg: &config{
+				maxJobSize: "50MB",
+				profiles:   []string{"invoice=engine=lualatex"},
+				apiKeys:    []string{"accounting=secret=0123456789abcdef&profiles=invoice"},
+			},
+			wantErr: false,
+			check: func(t *testing.T, opts service.Options) {
+				require.Len(t, opts.APIKeys, 1)
+				assert.Equal(t, "accounting", opts.APIKeys[0].Name)
+				assert.Equal(t, []string{"invoice"}, opts.APIKeys[0].Profiles)
+			},
+		},
+		{
+			name: "invalid API key",
+			cfg: &config{
+				maxJobSize: "50MB",
+				apiKeys:    []string{"accounting=secret=short"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid profile",
+			cfg: &config{
+				maxJobSize: "50MB",
+				profiles:   []string{"invoice=input=main.tex"},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -259,3 +350,47 @@ func TestBuildServiceOptions(t *testing.T) { //nolint: funlen
 		})
 	}
 }
+
+func TestParseImageEngines(t *testing.T) {
+	images := []string{"texlive:latest", "texlive-ja:latest"}
+
+	result, err := parseImageEngines(nil, images)
+	require.NoError(t, err)
+	assert.Nil(t, result)
+
+	result, err = parseImageEngines([]string{"texlive-ja:latest=lualatex,xelatex"}, images)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"texlive-ja:latest": {"lualatex", "xelatex"}}, result)
+
+	for def, msg := range map[string]string{
+		"texlive:latest":         "expected image=name[,name...]",
+		"texlive:latest=":        "expected image=name[,name...]",
+		"unknown:latest=xelatex": `unknown image "unknown:latest"`,
+		"texlive:latest=dings":   `unsupported TeX engine: "dings"`,
+	} {
+		_, err := parseImageEngines([]string{def}, images)
+		require.Error(t, err, def)
+		assert.Contains(t, err.Error(), msg, def)
+	}
+}
+
+func TestRegisterEngines(t *testing.T) {
+	t.Cleanup(func() { _ = tex.SetDefaultEngine("xelatex") })
+
+	require.NoError(t, registerEngines([]string{"lualatex=-pdflua -halt-on-error"}))
+	assert.Subset(t, tex.SupportedEngines(), []string{"xelatex", "pdflatex", "lualatex"})
+
+	e, err := tex.ParseEngine("lualatex")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-pdflua", "-halt-on-error"}, e.Flags()[len(e.Flags())-2:])
+
+	require.NoError(t, registerEngines([]string{"lualatex=-pdflua"}))
+	assert.Error(t, registerEngines([]string{"evil=-e"}))
+}
+
+func TestParseList(t *testing.T) {
+	assert.Equal(t, tex.MagicKeys, parseList("all", tex.MagicKeys))
+	assert.Nil(t, parseList("none", tex.MagicKeys))
+	assert.Nil(t, parseList("", tex.MagicKeys))
+	assert.Equal(t, []string{"engine", "input"}, parseList(" engine, input,", tex.MagicKeys))
+}
@@ -8,7 +8,7 @@ import (
 )
 
 type dockerRunner interface {
-	Run(ctx context.Context, tag, wd string, cmd []string) (string, error)
+	Run(ctx context.Context, tag, wd string, env, cmd []string) (string, error)
 }
 
 type dockerExec struct {
@@ -30,9 +30,10 @@ func (x *dockerExec) Run(ctx context.Context, log xlog.Logger) error {
 	}
 
 	tag := x.doc.Image()
-	log.Debug("running latexmk", xlog.Any("args", cmd[1:]))
-	output, err := x.cli.Run(ctx, tag, dir, cmd)
-	if err != nil {
+	env := x.doc.Environ()
+	log.Debug("running compiler", xlog.String("cmd", cmd[0]), xlog.Any("args", cmd[1:]))
+	output, err := x.cli.Run(ctx, tag, dir, env, cmd)
+	if x.doc.Engine().Compiler().Failed(err, output) {
 		log.Error("compilation failed", xlog.Error(err))
 		return tex.CompilationError("compilation failed", err, tex.KV{
 			"cmd":    cmd[0],
@@ -41,5 +42,7 @@ func (x *dockerExec) Run(ctx context.Context, log xlog.Logger) error {
 			"image":  tag,
 		})
 	}
-	return nil
+	return x.runSteps(ctx, log, func(ctx context.Context, cmd []string) (string, error) {
+		return x.cli.Run(ctx, tag, dir, env, cmd)
+	})
 }
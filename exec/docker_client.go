@@ -183,7 +183,7 @@ func (dc *DockerClient) findAllowedImageID(tag string) string {
 // containerWd is the work dir inside a (new) container.
 const containerWd = "/texd"
 
-func (dc *DockerClient) prepareContainer(ctx context.Context, tag, wd string, cmd []string) (string, error) {
+func (dc *DockerClient) prepareContainer(ctx context.Context, tag, wd string, env, cmd []string) (string, error) {
 	id := dc.findAllowedImageID(tag)
 	if id == "" {
 		return "", fmt.Errorf("image %q not allowed", tag)
@@ -192,6 +192,7 @@ func (dc *DockerClient) prepareContainer(ctx context.Context, tag, wd string, cm
 	containerCfg := &container.Config{
 		Image:           id,
 		Cmd:             cmd,
+		Env:             env,
 		WorkingDir:      containerWd,
 		NetworkDisabled: true,
 	}
@@ -232,9 +233,11 @@ func (dc *DockerClient) waitForContainer(ctx context.Context, id string) (status
 }
 
 // Run creates a new Docker container from the given image tag, mounts the
-// working directory into it, and executes the given command in it.
-func (dc *DockerClient) Run(ctx context.Context, tag, wd string, cmd []string) (string, error) {
-	id, err := dc.prepareContainer(ctx, tag, wd, cmd)
+// working directory into it, and executes the given command in it. It
+// returns the command's stderr output, which is also streamed (together
+// with stdout) to the writer given to WithOutput, if any.
+func (dc *DockerClient) Run(ctx context.Context, tag, wd string, env, cmd []string) (string, error) {
+	id, err := dc.prepareContainer(ctx, tag, wd, env, cmd)
 	if err != nil {
 		return "", err
 	}
@@ -244,16 +247,24 @@ func (dc *DockerClient) Run(ctx context.Context, tag, wd string, cmd []string) (
 		logErr   error
 		logsDone = make(chan struct{})
 	)
+	stdout, stderr, flush := outputStreams(ctx)
 	go func() {
 		defer close(logsDone)
+		defer flush()
 		out, err := dc.cli.ContainerLogs(ctx, id, client.ContainerLogsOptions{
 			ShowStderr: true,
+			ShowStdout: stdout != nil,
+			Follow:     true,
 		})
 		if err != nil {
 			logErr = fmt.Errorf("unable to retrieve logs: %w", err)
 			return
 		}
-		if _, err = stdcopy.StdCopy(os.Stderr, &buf, out); err != nil {
+		dstout, dsterr := io.Writer(os.Stderr), io.Writer(&buf)
+		if stdout != nil {
+			dstout, dsterr = stdout, io.MultiWriter(&buf, stderr)
+		}
+		if _, err = stdcopy.StdCopy(dstout, dsterr, out); err != nil {
 			logErr = fmt.Errorf("unable to read logs: %w", err)
 			return
 		}
@@ -14,6 +14,7 @@ import (
 	"testing"
 
 	"github.com/digineo/xlog"
+	"github.com/moby/moby/api/pkg/stdcopy"
 	"github.com/moby/moby/api/types/container"
 	"github.com/moby/moby/api/types/image"
 	"github.com/moby/moby/api/types/jsonstream"
@@ -567,13 +568,13 @@ func (s *dockerClientSuite) TestPrepareContainer() {
 	s.mockContainerCreate("test:latest", wd, cmd,
 		"worker-1", nil)
 
-	id, err := s.subject.prepareContainer(bg, "", wd, cmd)
+	id, err := s.subject.prepareContainer(bg, "", wd, nil, cmd)
 	s.Require().NoError(err)
 	s.Assert().Equal("worker-1", id)
 }
 
 func (s *dockerClientSuite) TestPrepareContainer_unknownImage() {
-	id, err := s.subject.prepareContainer(bg, "un:known", "/", nil)
+	id, err := s.subject.prepareContainer(bg, "un:known", "/", nil, nil)
 	s.Require().EqualError(err, `image "un:known" not allowed`)
 	s.Assert().Equal("", id)
 }
@@ -582,7 +583,7 @@ func (s *dockerClientSuite) TestPrepareContainer_failToStart() {
 	s.mockContainerCreate("test:latest", "/", []string{"true"},
 		"", errors.New("test-failure"))
 
-	id, err := s.subject.prepareContainer(bg, "", "/", []string{"true"})
+	id, err := s.subject.prepareContainer(bg, "", "/", nil, []string{"true"})
 	s.Require().EqualError(err, "failed to create container: test-failure")
 	s.Assert().Equal("", id)
 }
@@ -596,6 +597,7 @@ func (s *dockerClientSuite) TestRun() {
 	mockLogs := &mockContainerLogsResult{ReadCloser: io.NopCloser(&logs)}
 	s.cli.On("ContainerLogs", bg, runningID, client.ContainerLogsOptions{
 		ShowStderr: true,
+		Follow:     true,
 	}).Return(mockLogs, nil)
 
 	s.cli.On("ContainerStart", bg, runningID, client.ContainerStartOptions{}).
@@ -607,17 +609,55 @@ func (s *dockerClientSuite) TestRun() {
 	s.cli.On("ContainerWait", bg, runningID, client.ContainerWaitOptions{Condition: container.WaitConditionNotRunning}).
 		Return(client.ContainerWaitResult{Result: statusCh, Error: errCh})
 
-	out, err := s.subject.Run(bg, "texd", "/job", []string{"latexmk"})
+	out, err := s.subject.Run(bg, "texd", "/job", nil, []string{"latexmk"})
 	s.Require().NoError(err)
 	s.Assert().Empty(out) // simulating logs is hard, ignore for now
 }
 
+func (s *dockerClientSuite) TestRun_output() {
+	const runningID = "5ca1ab1e"
+	s.subject.images = append(s.subject.images, image.Summary{ID: "test", RepoTags: []string{"texd"}})
+	s.cli.On("ContainerCreate", mock.Anything, mock.Anything).
+		Return(client.ContainerCreateResult{ID: runningID}, nil)
+
+	// multiplexed log stream, see stdcopy.StdCopy
+	var logs bytes.Buffer
+	frame := func(stream stdcopy.StdType, s string) {
+		logs.Write([]byte{byte(stream), 0, 0, 0, 0, 0, 0, byte(len(s))})
+		logs.WriteString(s)
+	}
+	frame(stdcopy.Stdout, "[1] [2")
+	frame(stdcopy.Stderr, "Run number 1 of rule 'xelatex'\n")
+	frame(stdcopy.Stdout, "]\n")
+	mockLogs := &mockContainerLogsResult{ReadCloser: io.NopCloser(&logs)}
+	s.cli.On("ContainerLogs", mock.Anything, runningID, client.ContainerLogsOptions{
+		ShowStderr: true,
+		ShowStdout: true,
+		Follow:     true,
+	}).Return(mockLogs, nil)
+
+	s.cli.On("ContainerStart", mock.Anything, runningID, client.ContainerStartOptions{}).
+		Return(client.ContainerStartResult{}, nil)
+
+	statusCh := make(chan container.WaitResponse, 1)
+	statusCh <- container.WaitResponse{StatusCode: 0}
+	errCh := make(chan error, 1)
+	s.cli.On("ContainerWait", mock.Anything, runningID, client.ContainerWaitOptions{Condition: container.WaitConditionNotRunning}).
+		Return(client.ContainerWaitResult{Result: statusCh, Error: errCh})
+
+	var output bytes.Buffer
+	out, err := s.subject.Run(WithOutput(bg, &output), "texd", "/job", nil, []string{"latexmk"})
+	s.Require().NoError(err)
+	s.Assert().Equal("Run number 1 of rule 'xelatex'\n", out)
+	s.Assert().Equal("Run number 1 of rule 'xelatex'\n[1] [2]\n", output.String())
+}
+
 func (s *dockerClientSuite) TestRun_errContainerCreate() {
 	const runningID = "deadbeef"
 	s.mockContainerCreate("texd", "/job", []string{"latexmk"},
 		runningID, io.ErrClosedPipe)
 
-	out, err := s.subject.Run(bg, "texd", "/job", []string{"latexmk"})
+	out, err := s.subject.Run(bg, "texd", "/job", nil, []string{"latexmk"})
 	s.Require().EqualError(err, "failed to create container: io: read/write on closed pipe")
 	s.Assert().Equal("", out)
 }
@@ -630,6 +670,7 @@ func (s *dockerClientSuite) TestRun_errRetrieveLogs() {
 	mockLogs := &mockContainerLogsResult{ReadCloser: io.NopCloser(nil)}
 	s.cli.On("ContainerLogs", bg, runningID, client.ContainerLogsOptions{
 		ShowStderr: true,
+		Follow:     true,
 	}).Return(mockLogs, errors.New("failed"))
 
 	s.cli.On("ContainerStart", bg, runningID, client.ContainerStartOptions{}).
@@ -641,7 +682,7 @@ func (s *dockerClientSuite) TestRun_errRetrieveLogs() {
 	s.cli.On("ContainerWait", bg, runningID, client.ContainerWaitOptions{Condition: container.WaitConditionNotRunning}).
 		Return(client.ContainerWaitResult{Result: statusCh, Error: errCh})
 
-	out, err := s.subject.Run(bg, "texd", "/job", []string{"latexmk"})
+	out, err := s.subject.Run(bg, "texd", "/job", nil, []string{"latexmk"})
 	s.Require().EqualError(err, "unable to retrieve logs: failed")
 	s.Assert().Equal("", out)
 }
@@ -660,6 +701,7 @@ func (s *dockerClientSuite) TestRun_errReadLogs() {
 	mockLogs := &mockContainerLogsResult{ReadCloser: io.NopCloser(&failReader{errors.New("copy failure")})}
 	s.cli.On("ContainerLogs", bg, runningID, client.ContainerLogsOptions{
 		ShowStderr: true,
+		Follow:     true,
 	}).Return(mockLogs, nil)
 
 	s.cli.On("ContainerStart", bg, runningID, client.ContainerStartOptions{}).
@@ -671,7 +713,7 @@ func (s *dockerClientSuite) TestRun_errReadLogs() {
 	s.cli.On("ContainerWait", bg, runningID, client.ContainerWaitOptions{Condition: container.WaitConditionNotRunning}).
 		Return(client.ContainerWaitResult{Result: statusCh, Error: errCh})
 
-	out, err := s.subject.Run(bg, "texd", "/job", []string{"latexmk"})
+	out, err := s.subject.Run(bg, "texd", "/job", nil, []string{"latexmk"})
 	s.Require().EqualError(err, "unable to read logs: copy failure")
 	s.Assert().Equal("", out)
 }
@@ -684,12 +726,13 @@ func (s *dockerClientSuite) TestRun_errContainerStart() {
 	mockLogs := &mockContainerLogsResult{ReadCloser: io.NopCloser(&bytes.Buffer{})}
 	s.cli.On("ContainerLogs", bg, runningID, client.ContainerLogsOptions{
 		ShowStderr: true,
+		Follow:     true,
 	}).Return(mockLogs, nil)
 
 	s.cli.On("ContainerStart", bg, runningID, client.ContainerStartOptions{}).
 		Return(client.ContainerStartResult{}, errors.New("dockerd busy"))
 
-	_, err := s.subject.Run(bg, "texd", "/job", []string{"latexmk"})
+	_, err := s.subject.Run(bg, "texd", "/job", nil, []string{"latexmk"})
 	s.Require().EqualError(err, "failed to start container: dockerd busy")
 }
 
@@ -701,6 +744,7 @@ func (s *dockerClientSuite) TestRun_errWaitForContainer() {
 	mockLogs := &mockContainerLogsResult{ReadCloser: io.NopCloser(&bytes.Buffer{})}
 	s.cli.On("ContainerLogs", bg, runningID, client.ContainerLogsOptions{
 		ShowStderr: true,
+		Follow:     true,
 	}).Return(mockLogs, nil)
 
 	s.cli.On("ContainerStart", bg, runningID, client.ContainerStartOptions{}).
@@ -712,7 +756,7 @@ func (s *dockerClientSuite) TestRun_errWaitForContainer() {
 	s.cli.On("ContainerWait", bg, runningID, client.ContainerWaitOptions{Condition: container.WaitConditionNotRunning}).
 		Return(client.ContainerWaitResult{Result: statusCh, Error: errCh})
 
-	_, err := s.subject.Run(bg, "texd", "/job", []string{"latexmk"})
+	_, err := s.subject.Run(bg, "texd", "/job", nil, []string{"latexmk"})
 	s.Require().EqualError(err, "failed to run container: unexpected restart")
 }
 
@@ -725,6 +769,7 @@ func (s *dockerClientSuite) TestRun_errExitStatus() {
 	mockLogs := &mockContainerLogsResult{ReadCloser: io.NopCloser(&logs)}
 	s.cli.On("ContainerLogs", bg, runningID, client.ContainerLogsOptions{
 		ShowStderr: true,
+		Follow:     true,
 	}).Return(mockLogs, nil)
 
 	s.cli.On("ContainerStart", bg, runningID, client.ContainerStartOptions{}).
@@ -736,6 +781,6 @@ func (s *dockerClientSuite) TestRun_errExitStatus() {
 	s.cli.On("ContainerWait", bg, runningID, client.ContainerWaitOptions{Condition: container.WaitConditionNotRunning}).
 		Return(client.ContainerWaitResult{Result: statusCh, Error: errCh})
 
-	_, err := s.subject.Run(bg, "texd", "/job", []string{"latexmk"})
+	_, err := s.subject.Run(bg, "texd", "/job", nil, []string{"latexmk"})
 	s.Require().EqualError(err, "container exited with status 127")
 }
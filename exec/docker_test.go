@@ -17,8 +17,8 @@ type dockerClientMock struct {
 	mock.Mock
 }
 
-func (m *dockerClientMock) Run(ctx context.Context, tag, wd string, cmd []string) (string, error) {
-	args := m.Called(ctx, tag, wd, cmd)
+func (m *dockerClientMock) Run(ctx context.Context, tag, wd string, env, cmd []string) (string, error) {
+	args := m.Called(ctx, tag, wd, env, cmd)
 	return args.String(0), args.Error(1)
 }
 
@@ -47,7 +47,7 @@ func TestDockerExec_latexmkFailed(t *testing.T) {
 	errStart := errors.New("command not found")
 
 	cli := &dockerClientMock{}
-	cli.On("Run", bg, "", "/texd", doc.Engine().LatexmkCmd(mainFile)).
+	cli.On("Run", bg, "", "/texd", []string(nil), doc.Engine().LatexmkCmd(mainFile)).
 		Return("outputlog", errStart)
 
 	exec := &dockerExec{
@@ -70,7 +70,7 @@ func TestDockerExec_success(t *testing.T) {
 	mainFile := "index.tex"
 	doc := &mockDocument{"/texd", nil, mainFile, nil}
 	cli := &dockerClientMock{}
-	cli.On("Run", bg, "", "/texd", doc.Engine().LatexmkCmd(mainFile)).
+	cli.On("Run", bg, "", "/texd", []string(nil), doc.Engine().LatexmkCmd(mainFile)).
 		Return("", nil)
 
 	exec := &dockerExec{
@@ -81,3 +81,51 @@ func TestDockerExec_success(t *testing.T) {
 	err := exec.Run(bg, xlog.NewDiscard())
 	require.NoError(t, err)
 }
+
+func TestDockerExec_steps(t *testing.T) {
+	mainFile := "index.tex"
+	step := tex.Step{Name: "png", Cmd: []string{"pdftoppm", "index.pdf", "page"}}
+	doc := &stepsDocument{
+		mockDocument: &mockDocument{"/texd", nil, mainFile, nil},
+		steps:        []tex.Step{step},
+	}
+	cli := &dockerClientMock{}
+	cli.On("Run", bg, "", "/texd", []string(nil), doc.Engine().LatexmkCmd(mainFile)).
+		Return("", nil)
+	cli.On("Run", bg, "", "/texd", []string(nil), step.Cmd).
+		Return("no such file", errors.New("exit status 1"))
+
+	exec := &dockerExec{
+		baseExec: baseExec{doc: doc},
+		cli:      cli,
+	}
+
+	err := exec.Run(bg, xlog.NewDiscard())
+	require.EqualError(t, err, "post-processing failed: exit status 1")
+	cli.AssertExpectations(t)
+}
+
+func TestDockerExec_environ(t *testing.T) {
+	mainFile := "index.tex"
+	step := tex.Step{Name: "png", Cmd: []string{"pdftoppm", "index.pdf", "page"}}
+	env := []string{"SOURCE_DATE_EPOCH=0", "FORCE_SOURCE_DATE=1"}
+	doc := &stepsDocument{
+		mockDocument: &mockDocument{"/texd", nil, mainFile, nil},
+		steps:        []tex.Step{step},
+		env:          env,
+	}
+	cli := &dockerClientMock{}
+	cli.On("Run", bg, "", "/texd", env, doc.Engine().LatexmkCmd(mainFile)).
+		Return("", nil)
+	cli.On("Run", bg, "", "/texd", env, step.Cmd).
+		Return("", nil)
+
+	exec := &dockerExec{
+		baseExec: baseExec{doc: doc},
+		cli:      cli,
+	}
+
+	err := exec.Run(bg, xlog.NewDiscard())
+	require.NoError(t, err)
+	cli.AssertExpectations(t)
+}
@@ -2,7 +2,12 @@ package exec
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/digineo/texd/metrics"
 	"github.com/digineo/texd/tex"
 	"github.com/digineo/xlog"
 )
@@ -17,6 +22,8 @@ type Document interface {
 	MainInput() (string, error)
 	Engine() tex.Engine
 	Image() string
+	Steps() []tex.Step
+	Environ() []string
 }
 
 var _ Document = (tex.Document)(nil)
@@ -31,7 +38,86 @@ func (x *baseExec) extract() (dir string, cmd []string, err error) {
 		return "", nil, err
 	}
 
-	cmd = x.doc.Engine().LatexmkCmd(main)
+	cmd = x.doc.Engine().Command(main)
 	dir, err = x.doc.WorkingDirectory()
 	return
 }
+
+// runSteps executes the document's additional steps (see tex.Step) in
+// order, using the given run function. It stops at the first failure.
+// The duration of each step, and the file size delta of post-processing
+// steps, are recorded in metrics.
+func (x *baseExec) runSteps(ctx context.Context, log xlog.Logger, run func(context.Context, []string) (string, error)) error {
+	for _, step := range x.doc.Steps() {
+		log.Debug("running step",
+			xlog.String("step", step.Name),
+			xlog.String("cmd", step.Cmd[0]),
+			xlog.Any("args", step.Cmd[1:]))
+		start := time.Now()
+		output, err := x.runStep(ctx, step, run)
+		metrics.PostProcessDuration.WithLabelValues(step.Name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			log.Error("step failed",
+				xlog.String("step", step.Name),
+				xlog.String("output", output),
+				xlog.Error(err))
+			return tex.CompilationError("post-processing failed", err, tex.KV{
+				"step":   step.Name,
+				"cmd":    step.Cmd[0],
+				"args":   step.Cmd[1:],
+				"output": output,
+			})
+		}
+		if delta, ok := x.sizeDelta(step); ok {
+			log.Debug("step completed", xlog.String("step", step.Name), xlog.Int("size-delta", int(delta)))
+			metrics.PostProcessSizeDelta.WithLabelValues(step.Name).Observe(float64(delta))
+		}
+	}
+	return nil
+}
+
+// runStep prepares and runs a single step (see tex.Step.Prepare). The
+// step's secrets are only present in the working directory while the step
+// runs.
+func (x *baseExec) runStep(ctx context.Context, step tex.Step, run func(context.Context, []string) (string, error)) (string, error) {
+	if len(step.Secrets) > 0 || step.Prepare != nil {
+		dir, err := x.doc.WorkingDirectory()
+		if err != nil {
+			return "", err
+		}
+		if step.Prepare != nil {
+			if err = step.Prepare(dir); err != nil {
+				return "", fmt.Errorf("failed to prepare step: %w", err)
+			}
+		}
+		for name, secret := range step.Secrets {
+			file := filepath.Join(dir, name)
+			defer func() { _ = os.Remove(file) }()
+			if err = os.WriteFile(file, []byte(secret), 0o600); err != nil {
+				return "", fmt.Errorf("failed to write secrets: %w", err)
+			}
+		}
+	}
+	return run(ctx, step.Cmd)
+}
+
+// sizeDelta returns the size difference between the output and input
+// files of a post-processing step.
+func (x *baseExec) sizeDelta(step tex.Step) (int64, bool) {
+	if step.Input == "" || step.Output == "" {
+		return 0, false
+	}
+	dir, err := x.doc.WorkingDirectory()
+	if err != nil {
+		return 0, false
+	}
+	in, err := os.Stat(filepath.Join(dir, step.Input))
+	if err != nil {
+		return 0, false
+	}
+	out, err := os.Stat(filepath.Join(dir, step.Output))
+	if err != nil {
+		return 0, false
+	}
+	return out.Size() - in.Size(), true
+}
@@ -1,10 +1,14 @@
 package exec
 
 import (
+	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -24,7 +28,9 @@ func (m *mockDocument) MainInput() (string, error)        { return m.main, m.mai
 func (*mockDocument) Engine() tex.Engine                  { return tex.DefaultEngine }
 
 // methods required to satisfy the Document interface.
-func (*mockDocument) Image() string { return "" }
+func (*mockDocument) Image() string     { return "" }
+func (*mockDocument) Steps() []tex.Step { return nil }
+func (*mockDocument) Environ() []string { return nil }
 
 func TestBaseExec_extract(t *testing.T) {
 	dirErr := errors.New("dir error")
@@ -70,3 +76,105 @@ func TestBaseExec_extract(t *testing.T) {
 		}
 	}
 }
+
+// stepsDocument adds steps to a mockDocument.
+type stepsDocument struct {
+	*mockDocument
+	steps []tex.Step
+	env   []string
+}
+
+func (d *stepsDocument) Steps() []tex.Step { return d.steps }
+func (d *stepsDocument) Environ() []string { return d.env }
+
+func TestBaseExec_runSteps(t *testing.T) {
+	doc := &stepsDocument{
+		mockDocument: &mockDocument{"/", nil, "main.tex", nil},
+		steps: []tex.Step{
+			{Name: "first", Cmd: []string{"a", "1"}},
+			{Name: "second", Cmd: []string{"b", "2"}},
+			{Name: "third", Cmd: []string{"c", "3"}},
+		},
+	}
+	x := &baseExec{doc: doc}
+
+	var called [][]string
+	err := x.runSteps(bg, xlog.NewDiscard(), func(_ context.Context, cmd []string) (string, error) {
+		called = append(called, cmd)
+		if cmd[0] == "b" {
+			return "oops", errors.New("exit status 1")
+		}
+		return "", nil
+	})
+	require.EqualError(t, err, "post-processing failed: exit status 1")
+	assert.Equal(t, [][]string{{"a", "1"}, {"b", "2"}}, called)
+	assert.Equal(t, tex.KV{
+		"step":   "second",
+		"cmd":    "b",
+		"args":   []string{"2"},
+		"output": "oops",
+	}, err.(*tex.ErrWithCategory).Extra()) //nolint:forcetypeassert,errorlint
+}
+
+func TestBaseExec_sizeDelta(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.pdf"), make([]byte, 100), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "_texd-compress.pdf"), make([]byte, 40), 0o600))
+
+	x := &baseExec{doc: &mockDocument{dir, nil, "main.tex", nil}}
+	delta, ok := x.sizeDelta(tex.Step{Name: "compress", Input: "main.pdf", Output: "_texd-compress.pdf"})
+	assert.True(t, ok)
+	assert.EqualValues(t, -60, delta)
+
+	_, ok = x.sizeDelta(tex.Step{Name: "png"})
+	assert.False(t, ok)
+	_, ok = x.sizeDelta(tex.Step{Name: "pdfa", Input: "main.pdf", Output: "_texd-pdfa.pdf"})
+	assert.False(t, ok)
+}
+
+func TestBaseExec_runStep_secrets(t *testing.T) {
+	dir := t.TempDir()
+	x := &baseExec{doc: &mockDocument{dir, nil, "main.tex", nil}}
+	step := tex.Step{
+		Name:    "encrypt",
+		Cmd:     []string{"qpdf", "@args"},
+		Secrets: map[string]tex.Secret{"args": "--encrypt\nsecret\n"},
+	}
+
+	_, err := x.runStep(bg, step, func(_ context.Context, cmd []string) (string, error) {
+		assert.Equal(t, step.Cmd, cmd)
+		contents, err := os.ReadFile(filepath.Join(dir, "args"))
+		require.NoError(t, err)
+		assert.Equal(t, "--encrypt\nsecret\n", string(contents))
+		return "", errors.New("exit status 2")
+	})
+	require.EqualError(t, err, "exit status 2")
+	assert.NoFileExists(t, filepath.Join(dir, "args"))
+}
+
+func TestBaseExec_runStep_prepare(t *testing.T) {
+	dir := t.TempDir()
+	x := &baseExec{doc: &mockDocument{dir, nil, "main.tex", nil}}
+
+	var prepared string
+	step := tex.Step{
+		Name: "metadata",
+		Cmd:  []string{"qpdf"},
+		Prepare: func(wd string) error {
+			prepared = wd
+			return nil
+		},
+	}
+	_, err := x.runStep(bg, step, func(context.Context, []string) (string, error) {
+		assert.Equal(t, dir, prepared)
+		return "", nil
+	})
+	require.NoError(t, err)
+
+	step.Prepare = func(string) error { return errors.New("invalid input") }
+	_, err = x.runStep(bg, step, func(context.Context, []string) (string, error) {
+		t.Fatal("unexpected run")
+		return "", nil
+	})
+	require.EqualError(t, err, "failed to prepare step: invalid input")
+}
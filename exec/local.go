@@ -3,6 +3,8 @@ package exec
 import (
 	"bytes"
 	"context"
+	"io"
+	"os"
 	"os/exec"
 
 	"github.com/digineo/texd/tex"
@@ -14,6 +16,23 @@ type localExec struct {
 	path string // overrides command to execute (in tests)
 }
 
+// localEnvKeys lists the variables local commands inherit from texd's
+// environment. Everything else comes from the job (like in a container),
+// so texd's own configuration doesn't leak into documents.
+var localEnvKeys = []string{"PATH", "HOME"}
+
+// localEnviron returns the environment for local commands, consisting of
+// the inherited variables (see localEnvKeys) and the job's variables.
+func localEnviron(env []string) []string {
+	base := make([]string, 0, len(localEnvKeys)+len(env))
+	for _, key := range localEnvKeys {
+		if value, ok := os.LookupEnv(key); ok {
+			base = append(base, key+"="+value)
+		}
+	}
+	return append(base, env...)
+}
+
 func LocalExec(doc Document) Exec {
 	return &localExec{
 		baseExec: baseExec{doc: doc},
@@ -31,21 +50,34 @@ func (x *localExec) Run(ctx context.Context, log xlog.Logger) error {
 		args[0] = x.path
 	}
 
-	var stderr bytes.Buffer
-	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
-	cmd.Dir = dir
-	cmd.Stderr = &stderr
+	env := localEnviron(x.doc.Environ())
+	run := func(ctx context.Context, args []string) (string, error) {
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Dir = dir
+		cmd.Env = env
+		cmd.Stderr = &stderr
+		stdout, errs, flush := outputStreams(ctx)
+		if stdout != nil {
+			cmd.Stdout = stdout
+			cmd.Stderr = io.MultiWriter(&stderr, errs)
+		}
+		err := cmd.Run()
+		flush()
+		return stderr.String(), err
+	}
 
-	log.Debug("running latexmk", xlog.Any("args", args[1:]))
-	if err := cmd.Run(); err != nil {
+	log.Debug("running compiler", xlog.String("cmd", args[0]), xlog.Any("args", args[1:]))
+	output, err := run(ctx, args)
+	if x.doc.Engine().Compiler().Failed(err, output) {
 		log.Error("compilation failed",
-			xlog.String("stderr", stderr.String()),
+			xlog.String("stderr", output),
 			xlog.Error(err))
 		return tex.CompilationError("compilation failed", err, tex.KV{
 			"cmd":    args[0],
 			"args":   args[1:],
-			"output": stderr.String(),
+			"output": output,
 		})
 	}
-	return nil
+	return x.runSteps(ctx, log, run)
 }
@@ -1,11 +1,13 @@
 package exec
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/digineo/texd/tex"
@@ -51,6 +53,22 @@ func TestLocalExec_Run(t *testing.T) {
 			expectedErr:    "compilation failed: exit status 23",
 			expectedOutput: tmpDir + " -cd -silent -pv- -pvc- -pdfxe main.tex\n",
 		},
+		{
+			doc: &stepsDocument{
+				mockDocument: &mockDocument{tmpDir, nil, "main.tex", nil},
+				steps:        []tex.Step{{Name: "true", Cmd: []string{"/bin/true"}}, {Name: "false", Cmd: []string{"/bin/false"}}},
+			},
+			path:        "/bin/true",
+			expectedErr: "post-processing failed: exit status 1",
+		},
+		{
+			doc: &stepsDocument{
+				mockDocument: &mockDocument{tmpDir, nil, "main.tex", nil},
+				steps:        []tex.Step{{Name: "env", Cmd: []string{"/bin/sh", "-c", `test "$SOURCE_DATE_EPOCH" = 42 -a -n "$PATH"`}}},
+				env:          []string{"SOURCE_DATE_EPOCH=42"},
+			},
+			path: "/bin/true",
+		},
 	}
 
 	for _, tt := range tests {
@@ -73,3 +91,63 @@ func TestLocalExec_Run(t *testing.T) {
 
 	require.NoError(err)
 }
+
+func TestLocalExec_Run_output(t *testing.T) {
+	t.Parallel()
+
+	doc := &stepsDocument{
+		mockDocument: &mockDocument{t.TempDir(), nil, "main.tex", nil},
+		steps:        []tex.Step{{Name: "sh", Cmd: []string{"/bin/sh", "-c", "echo step; echo done >&2"}}},
+	}
+	exec := LocalExec(doc).(*localExec) //nolint:forcetypeassert
+	exec.path = "/bin/true"
+
+	var output bytes.Buffer
+	require.NoError(t, exec.Run(WithOutput(context.Background(), &output), xlog.NewDiscard()))
+	assert.Contains(t, output.String(), "step\n")
+	assert.Contains(t, output.String(), "done\n")
+}
+
+// TestLocalExec_Run_signingKeys ensures the signing key material is
+// removed from the working directory, even if signing fails (i.e. when
+// the job directory is kept, see --keep-jobs).
+func TestLocalExec_Run_signingKeys(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	doc := &stepsDocument{
+		mockDocument: &mockDocument{dir, nil, "main.tex", nil},
+		steps: []tex.Step{{
+			Name:    "sign",
+			Cmd:     []string{"/bin/sh", "-c", "test -s _texd-sign.crt -a -s _texd-sign.key && exit 3"},
+			Secrets: map[string]tex.Secret{"_texd-sign.crt": "cert", "_texd-sign.key": "key"},
+		}},
+	}
+	exec := LocalExec(doc).(*localExec) //nolint:forcetypeassert
+	exec.path = "/bin/true"
+
+	err := exec.Run(context.Background(), xlog.NewDiscard())
+	require.EqualError(t, err, "post-processing failed: exit status 3")
+	assert.NoFileExists(t, filepath.Join(dir, "_texd-sign.crt"))
+	assert.NoFileExists(t, filepath.Join(dir, "_texd-sign.key"))
+}
+
+func TestLocalExec_environ(t *testing.T) {
+	t.Setenv("TEXD_SECRET", "leaked")
+	t.Setenv("HOME", "/home/texd")
+
+	// same job environment as in TestDockerExec_environ
+	env := []string{"SOURCE_DATE_EPOCH=0", "FORCE_SOURCE_DATE=1"}
+	doc := &stepsDocument{
+		mockDocument: &mockDocument{t.TempDir(), nil, "main.tex", nil},
+		steps:        []tex.Step{{Name: "env", Cmd: []string{"env"}}},
+		env:          env,
+	}
+	exec := LocalExec(doc).(*localExec) //nolint:forcetypeassert
+	exec.path = "/bin/true"
+
+	var output bytes.Buffer
+	require.NoError(t, exec.Run(WithOutput(context.Background(), &output), xlog.NewDiscard()))
+	assert.Equal(t, append([]string{"PATH=" + os.Getenv("PATH"), "HOME=/home/texd"}, env...),
+		strings.Split(strings.TrimSpace(output.String()), "\n"))
+}
@@ -3,6 +3,8 @@ package exec
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/digineo/texd/tex"
@@ -44,7 +46,7 @@ func (x *MockExec) Run(ctx context.Context, log xlog.Logger) error {
 		return tex.CompilationError("invalid document", err, nil)
 	}
 
-	log.Debug("simlate running latexmk", xlog.Any("args", args[1:]))
+	log.Debug("simlate running compiler", xlog.String("cmd", args[0]), xlog.Any("args", args[1:]))
 	main, _ := x.doc.MainInput() // would have failed in x.extract()
 	dot := strings.LastIndexByte(main, '.')
 	if dot < 0 {
@@ -52,9 +54,9 @@ func (x *MockExec) Run(ctx context.Context, log xlog.Logger) error {
 	}
 	var outfile string
 	if x.ShouldFail {
-		outfile = main[:dot] + ".log"
+		outfile = x.doc.Engine().Compiler().LogFile(main)
 	} else {
-		outfile = main[:dot] + ".pdf"
+		outfile = x.doc.Engine().Compiler().ResultFile(main)
 	}
 
 	adder, ok := x.doc.(interface {
@@ -63,7 +65,10 @@ func (x *MockExec) Run(ctx context.Context, log xlog.Logger) error {
 	if !ok {
 		panic("can't add files to document")
 	}
-	if err := adder.AddFile(outfile, x.ResultContents); err != nil {
+	if strings.HasPrefix(outfile, "_") {
+		// reserved for compiler output (e.g. HTML), AddFile would reject it
+		x.writeFile(outfile)
+	} else if err := adder.AddFile(outfile, x.ResultContents); err != nil {
 		panic(fmt.Errorf("failed to store result file: %w", err))
 	}
 
@@ -73,5 +78,35 @@ func (x *MockExec) Run(ctx context.Context, log xlog.Logger) error {
 			"args": args[1:],
 		})
 	}
+
+	// simulate post-processing, and conversion of the result into one page
+	steps := x.doc.Steps()
+	if len(steps) == 0 {
+		return nil
+	}
+	log.Debug("simulate running steps", xlog.Any("steps", steps))
+	for _, step := range steps {
+		if step.Output != "" {
+			x.writeFile(step.Output)
+		}
+	}
+	if doc, ok := x.doc.(interface{ Output() tex.Output }); ok {
+		if page := doc.Output().PageFile(1); page != "" {
+			x.writeFile(page)
+		}
+	}
 	return nil
 }
+
+// writeFile stores the result contents in the working directory, bypassing
+// the document's file name validation.
+func (x *MockExec) writeFile(name string) {
+	wd, _ := x.doc.WorkingDirectory() // would have failed in x.extract()
+	name = filepath.Join(wd, name)
+	if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+		panic(fmt.Errorf("failed to create output directory: %w", err))
+	}
+	if err := os.WriteFile(name, []byte(x.ResultContents), 0o600); err != nil {
+		panic(fmt.Errorf("failed to store output file: %w", err))
+	}
+}
@@ -0,0 +1,66 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+type outputKey struct{}
+
+// WithOutput returns a copy of ctx, which makes executors forward the
+// output (stdout and stderr) of all commands to w, while they run. Each
+// write to w contains complete lines only (except for a missing line
+// break at the very end of the output), and w is never written to
+// concurrently.
+func WithOutput(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, outputKey{}, w)
+}
+
+// outputStreams returns writers for stdout and stderr of a command,
+// which forward complete lines to the writer given to WithOutput. Both
+// are nil, if there is no such writer. The caller must call flush after
+// the command finished.
+func outputStreams(ctx context.Context) (stdout, stderr io.Writer, flush func()) {
+	w, ok := ctx.Value(outputKey{}).(io.Writer)
+	if !ok || w == nil {
+		return nil, nil, func() {}
+	}
+	mu := &sync.Mutex{}
+	out := &lineWriter{mu: mu, w: w}
+	errs := &lineWriter{mu: mu, w: w}
+	return out, errs, func() {
+		out.flush()
+		errs.flush()
+	}
+}
+
+// lineWriter buffers incomplete lines.
+type lineWriter struct {
+	mu  *sync.Mutex // shared with other streams
+	w   io.Writer
+	buf []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	if i := bytes.LastIndexByte(lw.buf, '\n'); i >= 0 {
+		lw.forward(lw.buf[:i+1])
+		lw.buf = append(lw.buf[:0], lw.buf[i+1:]...)
+	}
+	return len(p), nil // failures of w must not affect the command
+}
+
+func (lw *lineWriter) flush() {
+	if len(lw.buf) > 0 {
+		lw.forward(lw.buf)
+		lw.buf = lw.buf[:0]
+	}
+}
+
+func (lw *lineWriter) forward(lines []byte) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	_, _ = lw.w.Write(lines)
+}
@@ -0,0 +1,46 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingWriter struct{ writes []string }
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func TestOutputStreams(t *testing.T) {
+	t.Parallel()
+
+	stdout, stderr, flush := outputStreams(context.Background())
+	assert.Nil(t, stdout)
+	assert.Nil(t, stderr)
+	flush() // no-op
+
+	var w recordingWriter
+	stdout, stderr, flush = outputStreams(WithOutput(context.Background(), &w))
+	require.NotNil(t, stdout)
+	for _, s := range []string{"[1", "] [2", "]\nfoo\nba"} {
+		_, err := stdout.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	_, err := stderr.Write([]byte("Warning: x\n"))
+	require.NoError(t, err)
+	_, err = stdout.Write([]byte("r"))
+	require.NoError(t, err)
+	flush()
+
+	assert.Equal(t, []string{"[1] [2]\nfoo\n", "Warning: x\n", "bar"}, w.writes)
+
+	var buf bytes.Buffer
+	_, _, flush = outputStreams(WithOutput(context.Background(), &buf))
+	flush()
+	assert.Empty(t, buf.String())
+}
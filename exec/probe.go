@@ -0,0 +1,44 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/digineo/texd/tex"
+)
+
+// A Prober runs a command outside of a render job, e.g. to inspect the
+// TeX distribution, and returns its output. The image is only relevant
+// in container mode.
+type Prober func(ctx context.Context, image string, cmd []string) ([]byte, error)
+
+var (
+	_ Prober = LocalProbe
+	_ Prober = (*DockerClient)(nil).Probe
+)
+
+// LocalProbe runs cmd on the host, and returns its stdout. The image is
+// ignored.
+func LocalProbe(ctx context.Context, _ string, cmd []string) ([]byte, error) {
+	return exec.CommandContext(ctx, cmd[0], cmd[1:]...).Output()
+}
+
+// Probe runs cmd in a new container from the given image tag, and returns
+// its output (stdout and stderr). The container's working directory is
+// empty.
+func (dc *DockerClient) Probe(ctx context.Context, tag string, cmd []string) ([]byte, error) {
+	wd, err := os.MkdirTemp(tex.JobBaseDir(), "probe-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(wd)
+
+	var out bytes.Buffer
+	if _, err = dc.Run(WithOutput(ctx, &out), tag, wd, nil, cmd); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,57 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/moby/moby/api/pkg/stdcopy"
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/image"
+	"github.com/moby/moby/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalProbe(t *testing.T) {
+	t.Parallel()
+
+	out, err := LocalProbe(context.Background(), "ignored", []string{"/bin/sh", "-c", "echo out; echo err >&2"})
+	require.NoError(t, err)
+	assert.Equal(t, "out\n", string(out))
+
+	_, err = LocalProbe(context.Background(), "", []string{"/bin/false"})
+	assert.Error(t, err)
+}
+
+func (s *dockerClientSuite) TestProbe() {
+	const runningID = "c0ffee"
+	s.subject.images = append(s.subject.images, image.Summary{ID: "test", RepoTags: []string{"texd"}})
+	s.cli.On("ContainerCreate", mock.Anything, mock.Anything).
+		Return(client.ContainerCreateResult{ID: runningID}, nil)
+
+	var logs bytes.Buffer
+	logs.Write([]byte{byte(stdcopy.Stdout), 0, 0, 0, 0, 0, 0, 13})
+	logs.WriteString("graphicx.sty\n")
+	s.cli.On("ContainerLogs", mock.Anything, runningID, client.ContainerLogsOptions{
+		ShowStderr: true,
+		ShowStdout: true,
+		Follow:     true,
+	}).Return(&mockContainerLogsResult{ReadCloser: io.NopCloser(&logs)}, nil)
+	s.cli.On("ContainerStart", mock.Anything, runningID, client.ContainerStartOptions{}).
+		Return(client.ContainerStartResult{}, nil)
+
+	statusCh := make(chan container.WaitResponse, 1)
+	statusCh <- container.WaitResponse{StatusCode: 0}
+	s.cli.On("ContainerWait", mock.Anything, runningID, client.ContainerWaitOptions{Condition: container.WaitConditionNotRunning}).
+		Return(client.ContainerWaitResult{Result: statusCh, Error: make(chan error, 1)})
+
+	out, err := s.subject.Probe(bg, "texd", []string{"kpsewhich"})
+	s.Require().NoError(err)
+	s.Assert().Equal("graphicx.sty\n", string(out))
+
+	_, err = s.subject.Probe(bg, "unknown", []string{"kpsewhich"})
+	s.Assert().EqualError(err, `image "unknown" not allowed`)
+}
@@ -18,6 +18,11 @@ var (
 	ProcessedRejected = processedTotal.WithLabelValues("rejected")
 	ProcessedAborted  = processedTotal.WithLabelValues("aborted")
 
+	CompilationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "texd_compilation_errors_total",
+		Help: "Number of compilation failures, by error code",
+	}, []string{"code"})
+
 	ProcessingDuration = promauto.NewHistogram(prometheus.HistogramOpts{
 		Name: "texd_processing_duration_seconds",
 		Help: "Overview of processing time per job",
@@ -34,11 +39,27 @@ var (
 		Buckets: prometheus.ExponentialBuckets(512, 2, 13), // 0.5 KiB .. 2 MiB
 	}, []string{"type"})
 
-	OutputSize = promauto.NewHistogram(prometheus.HistogramOpts{
+	OutputSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "texd_output_file_size_bytes",
-		Help:    "Overview of generated document sizes, success only",
+		Help:    "Overview of generated document sizes by output format, success only",
 		Buckets: prometheus.ExponentialBuckets(2048, 2, 13), // 2 KiB .. 8 MiB
-	})
+	}, []string{"format"})
+
+	PostProcessDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "texd_postprocess_duration_seconds",
+		Help:    "Overview of post-processing and conversion time by step",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2, 5, 10, 20, 30, 60},
+	}, []string{"step"})
+
+	PostProcessSizeDelta = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "texd_postprocess_size_delta_bytes",
+		Help: "Overview of PDF file size changes by post-processing step, negative values mean shrinkage",
+		Buckets: []float64{
+			-8 << 20, -2 << 20, -512 << 10, -128 << 10, -32 << 10, -8 << 10, -2 << 10,
+			0,
+			2 << 10, 8 << 10, 32 << 10, 128 << 10, 512 << 10, 2 << 20, 8 << 20,
+		},
+	}, []string{"step"})
 
 	JobsQueueLength = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "texd_job_queue_length",
@@ -50,6 +71,11 @@ var (
 		Help: "Queue capacity indicator, with 0 meaning empty and 1 meaning full queue",
 	})
 
+	TeXLiveInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "texd_texlive_info",
+		Help: "TeX distribution details by image, with empty labels for unknown versions",
+	}, []string{"image", "texlive", "latexmk", "pdftex", "xetex", "luatex"})
+
 	Info = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name:        "texd_info",
 		Help:        "Various runtime and configuration information",
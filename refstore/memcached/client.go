@@ -13,6 +13,7 @@ type client interface {
 	Get(key string) (*memcache.Item, error)
 	Set(*memcache.Item) error
 	Touch(key string, seconds int32) error
+	Ping() error
 }
 
 func newClient(host string, params url.Values) (client, error) {
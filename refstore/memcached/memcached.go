@@ -62,6 +62,8 @@ func init() {
 	refstore.RegisterAdapter("memcached", New)
 }
 
+var _ refstore.Pinger = (*store)(nil)
+
 type store struct {
 	client    client
 	keyPrefix string
@@ -171,6 +173,14 @@ func (s *store) Exists(id refstore.Identifier) bool {
 	return err == nil
 }
 
+// Ping checks whether all configured Memcached servers are reachable.
+func (s *store) Ping() error {
+	if err := s.client.Ping(); err != nil {
+		return fmt.Errorf("memcached: %w", err)
+	}
+	return nil
+}
+
 func (s *store) key(id refstore.Identifier) string {
 	return s.keyPrefix + id.Raw()
 }
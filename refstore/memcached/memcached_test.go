@@ -133,6 +133,11 @@ func (m *clientMock) Touch(key string, seconds int32) error {
 	return args.Error(0)
 }
 
+func (m *clientMock) Ping() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
 type storeSuite struct {
 	suite.Suite
 
@@ -276,3 +281,11 @@ func (s *storeSuite) TestStore_serverError() {
 	err := s.store.Store(nil, buf)
 	s.Require().ErrorIs(err, memcache.ErrServerError)
 }
+
+func (s *storeSuite) TestPing() {
+	s.client.On("Ping").Return(nil).Once()
+	s.Require().NoError(s.store.Ping())
+
+	s.client.On("Ping").Return(memcache.ErrNoServers).Once()
+	s.Require().EqualError(s.store.Ping(), "memcached: memcache: no servers configured or available")
+}
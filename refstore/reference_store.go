@@ -25,3 +25,9 @@ type Adapter interface {
 // ErrUnknownReference can be returned from Adapter implementations, if
 // a given Identifier is unknown to them.
 var ErrUnknownReference = errors.New("unknown reference")
+
+// Pinger may be implemented by adapters which depend on external services.
+// Ping should report whether the backend is reachable and usable.
+type Pinger interface {
+	Ping() error
+}
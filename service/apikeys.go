@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/digineo/texd/service/middleware"
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+)
+
+// An APIKey grants access to the endpoints processing documents. Keys
+// restricted to a set of profiles may only render with one of them, so
+// profiles act as permission unit.
+type APIKey struct {
+	Name     string
+	Profiles []string // allowed profiles, empty means unrestricted
+
+	hash [sha256.Size]byte // of the secret
+}
+
+var apiKeyNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// minSecretLength prevents trivially guessable secrets.
+const minSecretLength = 16
+
+// ParseAPIKey parses an API key definition of the form "name=params",
+// where params is a URL query string with either the secret, or a file
+// containing it, and an optional comma separated list of profiles:
+//
+//	accounting=secretfile=/etc/texd/accounting.key&profiles=invoice,letter
+//	ci=secret=0123456789abcdef0123
+//
+// The profile names are validated on Start.
+func ParseAPIKey(def string) (APIKey, error) {
+	name, query, ok := strings.Cut(def, "=")
+	if !ok || !apiKeyNamePattern.MatchString(name) {
+		return APIKey{}, fmt.Errorf("invalid API key definition %q: expected name=params", def)
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return APIKey{}, fmt.Errorf("invalid API key %q: %w", name, err)
+	}
+	for key := range params {
+		switch key {
+		case "secret", "secretfile", "profiles":
+		default:
+			return APIKey{}, fmt.Errorf("invalid API key %q: unsupported parameter %q", name, key)
+		}
+	}
+
+	secret := params.Get("secret")
+	switch {
+	case params.Has("secret") && params.Has("secretfile"):
+		return APIKey{}, fmt.Errorf("invalid API key %q: expected either secret or secretfile", name)
+	case params.Has("secretfile"):
+		contents, err := os.ReadFile(params.Get("secretfile"))
+		if err != nil {
+			return APIKey{}, fmt.Errorf("invalid API key %q: %w", name, err)
+		}
+		secret = strings.TrimRight(string(contents), "\r\n")
+	}
+	if len(secret) < minSecretLength {
+		return APIKey{}, fmt.Errorf("invalid API key %q: secret must have at least %d characters", name, minSecretLength)
+	}
+
+	key := APIKey{Name: name, hash: sha256.Sum256([]byte(secret))}
+	for p := range strings.SplitSeq(params.Get("profiles"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			key.Profiles = append(key.Profiles, p)
+		}
+	}
+	return key, nil
+}
+
+// validateAPIKeys ensures key names are unique, and the referenced
+// profiles exist.
+func (svc *service) validateAPIKeys() error {
+	seen := make(map[string]bool, len(svc.apiKeys))
+	for _, key := range svc.apiKeys {
+		if seen[key.Name] {
+			return fmt.Errorf("duplicate API key %q", key.Name)
+		}
+		seen[key.Name] = true
+		for _, name := range key.Profiles {
+			if !slices.ContainsFunc(svc.profiles, func(p Profile) bool { return p.Name == name }) {
+				return fmt.Errorf("invalid API key %q: unknown profile %q", key.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+type apiKeyContextKey struct{}
+
+// authenticate requires a valid API key (given as bearer token), if API
+// keys are configured. The key is stored in the request context.
+func (svc *service) authenticate(next http.Handler) http.Handler {
+	if len(svc.apiKeys) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		key := svc.lookupAPIKey(req)
+		if key == nil {
+			log := svc.Logger().With(middleware.RequestIDField(req.Context()))
+			log.Warn("rejected request without valid API key")
+			res.Header().Set("WWW-Authenticate", `Bearer realm="texd"`)
+			http.Error(res, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		svc.Logger().Debug("authenticated request",
+			middleware.RequestIDField(req.Context()),
+			xlog.String("api-key", key.Name))
+		ctx := context.WithValue(req.Context(), apiKeyContextKey{}, key)
+		next.ServeHTTP(res, req.WithContext(ctx))
+	})
+}
+
+func (svc *service) lookupAPIKey(req *http.Request) *APIKey {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil
+	}
+	hash := sha256.Sum256([]byte(token))
+	var found *APIKey
+	for i := range svc.apiKeys {
+		// compare all keys, to not leak which one matched
+		if subtle.ConstantTimeCompare(hash[:], svc.apiKeys[i].hash[:]) == 1 {
+			found = &svc.apiKeys[i]
+		}
+	}
+	return found
+}
+
+// authorizeProfile ensures the API key of the request (if any) permits the
+// selected profile. Keys restricted to a single profile select it
+// implicitly.
+func authorizeProfile(ctx context.Context, params url.Values) (url.Values, error) {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	if key == nil || len(key.Profiles) == 0 {
+		return params, nil
+	}
+	name := params.Get("profile")
+	if name == "" && len(key.Profiles) == 1 {
+		implicit := make(url.Values, len(params)+1)
+		for k, v := range params {
+			implicit[k] = v
+		}
+		implicit.Set("profile", key.Profiles[0])
+		return implicit, nil
+	}
+	if name == "" {
+		return nil, tex.InputError("profile required", nil, tex.KV{"profiles": key.Profiles})
+	}
+	if !slices.Contains(key.Profiles, name) {
+		return nil, tex.InputError("profile not permitted", nil, tex.KV{"profile": name, "profiles": key.Profiles})
+	}
+	return params, nil
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/digineo/texd/exec"
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAPIKey(t *testing.T) {
+	t.Parallel()
+
+	key, err := ParseAPIKey("accounting=secret=0123456789abcdef&profiles=invoice,+letter")
+	require.NoError(t, err)
+	assert.Equal(t, "accounting", key.Name)
+	assert.Equal(t, []string{"invoice", "letter"}, key.Profiles)
+
+	secretFile := filepath.Join(t.TempDir(), "ci.key")
+	require.NoError(t, os.WriteFile(secretFile, []byte("0123456789abcdef\n"), 0o600))
+	fromFile, err := ParseAPIKey("ci=secretfile=" + secretFile)
+	require.NoError(t, err)
+	assert.Equal(t, key.hash, fromFile.hash)
+	assert.Empty(t, fromFile.Profiles)
+
+	for def, msg := range map[string]string{
+		"ci":                         "expected name=params",
+		"CI=secret=0123456789abcdef": "expected name=params",
+		"ci=secret=short":            "at least 16 characters",
+		"ci=secretfile=/nonexistent": "no such file",
+		"ci=secret=0123456789abcdef&secretfile=x":     "expected either secret or secretfile",
+		"ci=secret=0123456789abcdef&image=texlive":    `unsupported parameter "image"`,
+		"ci=secret=0123456789abcdef&profiles=%zz":     "invalid URL escape",
+		"ci=secret=0123456789abcdef&profiles=a&sign=": `unsupported parameter "sign"`,
+	} {
+		_, err := ParseAPIKey(def)
+		require.Error(t, err, def)
+		assert.Contains(t, err.Error(), msg, def)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	require.NoError(t, tex.SetJobBaseDir(t.TempDir()))
+	t.Cleanup(func() { _ = tex.SetJobBaseDir("") })
+
+	svc := newService(Options{
+		QueueLength: 1,
+		Mode:        "local",
+		Executor:    exec.Mock(false, mockPDF),
+		Profiles: []Profile{
+			mustParseProfile(t, "invoice=engine=lualatex"),
+			mustParseProfile(t, "letter=engine=pdflatex"),
+		},
+		APIKeys: []APIKey{
+			mustParseAPIKey(t, "admin=secret=admin-0123456789"),
+			mustParseAPIKey(t, "accounting=secret=accounting-0123456789&profiles=invoice"),
+			mustParseAPIKey(t, "office=secret=office-0123456789&profiles=invoice,letter"),
+		},
+	}, xlog.NewDiscard())
+	require.NoError(t, svc.validateAPIKeys())
+	routes := svc.routes()
+
+	request := func(method, uri, secret string) (int, string) {
+		body := "--x\r\nContent-Disposition: form-data; name=\"main.tex\"; filename=\"main.tex\"\r\n\r\n" +
+			"\\documentclass{article}\r\n--x--\r\n"
+		req := httptest.NewRequest(method, uri, strings.NewReader(body))
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+		if secret != "" {
+			req.Header.Set("Authorization", "Bearer "+secret)
+		}
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec.Code, strings.TrimSpace(rec.Body.String())
+	}
+	render := func(secret, query string) (int, string) {
+		return request(http.MethodPost, "/render"+query, secret)
+	}
+
+	code, _ := render("", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = render("wrong-0123456789", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, body := render("admin-0123456789", "?engine=xelatex")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, mockPDF, body+"\n")
+
+	// implicit profile
+	code, _ = render("accounting-0123456789", "")
+	assert.Equal(t, http.StatusOK, code)
+	_, body = request(http.MethodPost, "/validate", "accounting-0123456789")
+	assert.Contains(t, body, `"engine":"lualatex"`)
+	_, body = render("accounting-0123456789", "?profile=letter")
+	assert.Equal(t, `{"category":"input","error":"profile not permitted","profile":"letter","profiles":["invoice"]}`, body)
+
+	_, body = render("office-0123456789", "")
+	assert.Equal(t, `{"category":"input","error":"profile required","profiles":["invoice","letter"]}`, body)
+	code, _ = render("office-0123456789", "?profile=letter")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = request(http.MethodGet, "/jobs/01J0000000000000000000000/synctex/forward", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = request(http.MethodPost, "/workspaces", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = request(http.MethodGet, "/jobs/01J0000000000000000000000/result", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = request(http.MethodPost, "/validate", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// public endpoints
+	code, _ = request(http.MethodGet, "/status", "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = request(http.MethodGet, "/packages", "")
+	assert.NotEqual(t, http.StatusUnauthorized, code)
+
+	svc.apiKeys = append(svc.apiKeys, mustParseAPIKey(t, "other=secret=other-0123456789&profiles=thesis"))
+	assert.EqualError(t, svc.validateAPIKeys(), `invalid API key "other": unknown profile "thesis"`)
+	svc.apiKeys = append(svc.apiKeys[:1], mustParseAPIKey(t, "admin=secret=admin-9876543210"))
+	assert.EqualError(t, svc.validateAPIKeys(), `duplicate API key "admin"`)
+}
+
+func TestAuthorizeProfile(t *testing.T) {
+	t.Parallel()
+
+	key := mustParseAPIKey(t, "accounting=secret=accounting-0123456789&profiles=invoice")
+	ctx := context.WithValue(context.Background(), apiKeyContextKey{}, &key)
+
+	params, err := authorizeProfile(ctx, url.Values{"engine": {"xelatex"}})
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{"engine": {"xelatex"}, "profile": {"invoice"}}, params)
+
+	params, err = authorizeProfile(context.Background(), url.Values{"profile": {"letter"}})
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{"profile": {"letter"}}, params)
+}
+
+func mustParseAPIKey(t *testing.T, def string) APIKey {
+	t.Helper()
+	key, err := ParseAPIKey(def)
+	require.NoError(t, err)
+	return key
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/digineo/texd/metrics"
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+)
+
+// maxDiagnoseSize limits the amount of log data searched by diagnose.
+const maxDiagnoseSize = 8 << 20
+
+// diagnose searches the log file of doc and the compiler output for
+// well-known failures, and adds the error code and a hint to err, if it
+// is a CompilationError.
+func diagnose(log xlog.Logger, doc tex.Document, err error) {
+	catErr, ok := err.(*tex.ErrWithCategory) //nolint:errorlint
+	if !ok || !tex.IsCompilationError(err) {
+		return
+	}
+
+	var buf bytes.Buffer
+	if logs, lerr := doc.GetLogs(); lerr != nil {
+		log.Debug("no log file to diagnose", xlog.Error(lerr))
+	} else {
+		if _, lerr = io.Copy(&buf, io.LimitReader(logs, maxDiagnoseSize)); lerr != nil {
+			log.Warn("failed to read log file", xlog.Error(lerr))
+		}
+		_ = logs.Close()
+	}
+	if output, ok := catErr.Extra()["output"].(string); ok {
+		buf.WriteString("\n")
+		buf.WriteString(output)
+	}
+
+	code, extra := tex.Diagnose(buf.Bytes())
+	log.Info("diagnosed compilation failure", xlog.String("code", code))
+	metrics.CompilationErrors.WithLabelValues(code).Inc()
+	tex.ExtendError(err, extra)
+}
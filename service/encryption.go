@@ -0,0 +1,40 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/digineo/texd/tex"
+)
+
+// encryptionField is the name of the multipart field holding the PDF
+// encryption settings (see tex.Encryption). File names can't contain
+// underscores, hence it can't be confused with a file.
+const encryptionField = "_encryption"
+
+// maxEncryptionSize limits the size of the encryption settings.
+const maxEncryptionSize = 4 << 10
+
+// setEncryption reads the encryption settings from r, and applies them to
+// the document's output. The settings contain passwords, hence they must
+// not appear in logs or errors.
+func setEncryption(doc tex.Document, r io.Reader, partNum int) error {
+	if doc.Output().Encryption != nil {
+		return tex.InputError("duplicate encryption settings", nil, tex.KV{"part": partNum})
+	}
+
+	var enc tex.Encryption
+	dec := json.NewDecoder(io.LimitReader(r, maxEncryptionSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&enc); err != nil {
+		// don't wrap err, decoding errors may quote the input
+		return tex.InputError("malformed encryption settings", nil, tex.KV{"part": partNum})
+	}
+
+	output, err := doc.Output().WithEncryption(&enc)
+	if err != nil {
+		return tex.InputError("invalid encryption settings", err, tex.KV{"part": partNum})
+	}
+	doc.SetOutput(output)
+	return nil
+}
@@ -2,21 +2,52 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/digineo/texd/tex"
 )
 
+// queueUpdateInterval is the interval in which jobs waiting for a free
+// slot report their queue position (see streamProgress).
+var queueUpdateInterval = time.Second
+
 func (svc *service) acquire(ctx context.Context) error {
+	ticket := svc.queued.Add(1)
+	defer svc.dequeued.Add(1)
+	progress := progressFrom(ctx)
+	reportPosition := func() {
+		// assumes jobs leave the queue in order, which holds unless
+		// jobs give up waiting
+		progress.send("queue", queueEvent{
+			Position: int(max(ticket-svc.dequeued.Load(), 1)),
+			Length:   len(svc.jobs),
+			Capacity: cap(svc.jobs),
+		})
+	}
+	reportPosition()
+
 	// don't wait too long for other jobs to complete.
 	ctx, cancel := context.WithTimeout(ctx, svc.queueTimeout)
 	defer cancel()
 
-	select {
-	case svc.jobs <- struct{}{}:
-		// success
-		return nil
-	case <-ctx.Done():
-		return tex.QueueError("queue full, please try again later", ctx.Err(), nil)
+	var updates <-chan time.Time
+	if progress != nil {
+		ticker := time.NewTicker(queueUpdateInterval)
+		defer ticker.Stop()
+		updates = ticker.C
+	}
+
+	for {
+		select {
+		case svc.jobs <- struct{}{}:
+			// success
+			progress.send("start", struct{}{})
+			return nil
+		case <-updates:
+			reportPosition()
+		case <-ctx.Done():
+			return tex.QueueError("queue full, please try again later", ctx.Err(), nil)
+		}
 	}
 }
 
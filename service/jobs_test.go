@@ -2,9 +2,13 @@ package service
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/digineo/xlog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -35,3 +39,32 @@ func TestContextMutex(t *testing.T) {
 	require.EqualError(t, err, "queue full, please try again later: context canceled")
 	assert.True(t, time.Since(t0) < 10*time.Millisecond)
 }
+
+func TestAcquire_queueUpdates(t *testing.T) {
+	interval := queueUpdateInterval
+	t.Cleanup(func() { queueUpdateInterval = interval })
+	queueUpdateInterval = 5 * time.Millisecond
+
+	svc := &service{
+		jobs:         make(chan struct{}, 1),
+		queueTimeout: 100 * time.Millisecond,
+	}
+	require.NoError(t, svc.acquire(context.Background()))
+
+	rec := httptest.NewRecorder()
+	es := &eventStream{log: xlog.NewDiscard(), res: rec, rc: http.NewResponseController(rec)}
+	ctx := context.WithValue(context.Background(), progressKey{}, es)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		svc.release()
+	}()
+	require.NoError(t, svc.acquire(ctx))
+	defer svc.release()
+
+	events := strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n")
+	require.Greater(t, len(events), 3, "expected repeated queue events")
+	for _, ev := range events[:len(events)-1] {
+		assert.Regexp(t, `^event: queue\ndata: \{"position":1,"length":[01],"capacity":1\}$`, ev)
+	}
+	assert.Equal(t, "event: start\ndata: {}", events[len(events)-1])
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/digineo/texd/tex"
+)
+
+// xmpField is the name of the multipart field holding a custom XMP packet
+// (see tex.Metadata). File names can't contain underscores, hence it
+// can't be confused with a file.
+const xmpField = "_xmp"
+
+// metadataHeaderPrefix prefixes the response headers reporting the
+// applied metadata.
+const metadataHeaderPrefix = "X-Texd-Metadata-"
+
+// applyMetadata configures output to apply the document information from
+// the meta-title=, meta-author=, meta-subject= and meta-keywords= parameters.
+func applyMetadata(output tex.Output, params url.Values) (tex.Output, error) {
+	m := tex.Metadata{
+		Title:    params.Get("meta-title"),
+		Author:   params.Get("meta-author"),
+		Subject:  params.Get("meta-subject"),
+		Keywords: params.Get("meta-keywords"),
+	}
+	output, err := output.WithMetadata(m)
+	if err != nil {
+		return output, tex.InputError("invalid metadata", err, nil)
+	}
+	return output, nil
+}
+
+// setXMP reads a custom XMP packet from r, and adds it to the document's
+// output metadata.
+func setXMP(doc tex.Document, r io.Reader, partNum int) error {
+	output := doc.Output()
+	var m tex.Metadata
+	if output.Metadata != nil {
+		m = *output.Metadata
+	}
+	if len(m.XMP) > 0 {
+		return tex.InputError("duplicate XMP packet", nil, tex.KV{"part": partNum})
+	}
+
+	xmp, err := io.ReadAll(io.LimitReader(r, tex.MaxXMPSize+1))
+	if err != nil {
+		return tex.InputError("failed to read part", err, tex.KV{"part": partNum})
+	}
+	if len(xmp) == 0 {
+		return tex.InputError("empty XMP packet", nil, tex.KV{"part": partNum})
+	}
+	m.XMP = xmp
+
+	if output, err = output.WithMetadata(m); err != nil {
+		return tex.InputError("invalid metadata", err, tex.KV{"part": partNum})
+	}
+	doc.SetOutput(output)
+	return nil
+}
+
+// setMetadataHeaders reports the applied metadata in response headers.
+// Non-ASCII values are encoded as described in RFC 2047.
+func setMetadataHeaders(h http.Header, m *tex.Metadata) {
+	if m == nil {
+		return
+	}
+	for key, value := range m.Fields() {
+		h.Set(metadataHeaderPrefix+strings.ToUpper(key[:1])+key[1:], mime.QEncoding.Encode("utf-8", value))
+	}
+	if len(m.XMP) > 0 {
+		h.Set(metadataHeaderPrefix+"Xmp", strconv.Itoa(len(m.XMP))+" bytes")
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/digineo/texd/tex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyMetadata(t *testing.T) {
+	t.Parallel()
+
+	output, err := applyMetadata(tex.Output{}, url.Values{})
+	require.NoError(t, err)
+	assert.Nil(t, output.Metadata)
+
+	output, err = applyMetadata(tex.Output{}, url.Values{
+		"meta-title":  {"Gehaltsabrechnung"},
+		"meta-author": {"ACME GmbH"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &tex.Metadata{Title: "Gehaltsabrechnung", Author: "ACME GmbH"}, output.Metadata)
+
+	_, err = applyMetadata(tex.Output{Format: tex.FormatSVG}, url.Values{"meta-title": {"x"}})
+	assert.EqualError(t, err, `invalid metadata: metadata is not supported for format "svg"`)
+}
+
+func TestSetXMP(t *testing.T) {
+	t.Parallel()
+
+	doc := tex.NewDocument(nil, tex.DefaultEngine, "")
+	doc.SetOutput(tex.Output{Metadata: &tex.Metadata{Title: "x"}})
+
+	require.NoError(t, setXMP(doc, strings.NewReader("<x:xmpmeta/>"), 2))
+	assert.Equal(t, &tex.Metadata{Title: "x", XMP: []byte("<x:xmpmeta/>")}, doc.Output().Metadata)
+
+	assert.EqualError(t, setXMP(doc, strings.NewReader("<x:xmpmeta/>"), 3), "duplicate XMP packet")
+
+	doc.SetOutput(tex.Output{})
+	assert.EqualError(t, setXMP(doc, strings.NewReader(""), 3), "empty XMP packet")
+	assert.EqualError(t, setXMP(doc, strings.NewReader("<x:xmpmeta>"), 3),
+		"invalid metadata: invalid XMP packet: XML syntax error on line 1: unexpected EOF")
+}
+
+func TestSetMetadataHeaders(t *testing.T) {
+	t.Parallel()
+
+	h := http.Header{}
+	setMetadataHeaders(h, nil)
+	assert.Empty(t, h)
+
+	setMetadataHeaders(h, &tex.Metadata{
+		Title:    "Gehaltsabrechnung März",
+		Keywords: "payslip",
+		XMP:      []byte("<x/>"),
+	})
+	assert.Equal(t, http.Header{
+		"X-Texd-Metadata-Title":    {"=?utf-8?q?Gehaltsabrechnung_M=C3=A4rz?="},
+		"X-Texd-Metadata-Keywords": {"payslip"},
+		"X-Texd-Metadata-Xmp":      {"4 bytes"},
+	}, h)
+}
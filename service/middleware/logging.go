@@ -69,3 +69,9 @@ func WithLogging(log xlog.Logger) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// Unwrap allows http.ResponseController to access the underlying
+// ResponseWriter (e.g. for flushing streamed responses).
+func (l *responseLogger) Unwrap() http.ResponseWriter {
+	return l.ResponseWriter
+}
@@ -48,3 +48,15 @@ func TestLogging(t *testing.T) {
 		"url=/",
 	}, " ")+"\n", buf.String())
 }
+
+func TestLogging_flush(t *testing.T) {
+	t.Parallel()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		assert.NoError(t, http.NewResponseController(w).Flush())
+	})
+
+	w := httptest.NewRecorder()
+	WithLogging(xlog.NewDiscard())(h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, w.Flushed)
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/digineo/texd/service/middleware"
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+)
+
+// checkPackages ensures that the packages required by doc are either
+// provided by the document itself, or by the TeX distribution. It is a
+// no-op with Options.NoPackageCheck, as the index might be incomplete
+// (e.g. packages installed outside of the ls-R databases).
+func (svc *service) checkPackages(doc tex.Document) error {
+	if svc.noPkgCheck {
+		return nil
+	}
+	unknown, err := svc.unknownPackages(doc)
+	if err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return unknownPackageError(doc, unknown)
+	}
+	return nil
+}
+
+// unknownPackages lists the packages required by doc, which are neither
+// provided by the document itself, nor by the TeX distribution. Without
+// a (non-empty) package index, all packages are considered available.
+func (svc *service) unknownPackages(doc tex.Document) ([]string, error) {
+	idx := svc.packages[doc.Image()]
+	if idx == nil || idx.Len() == 0 {
+		return nil, nil
+	}
+	deps, err := doc.Dependencies()
+	if err != nil {
+		return nil, err
+	}
+	return idx.UnknownPackages(deps), nil
+}
+
+// unknownPackageError describes the unknown packages of doc.
+func unknownPackageError(doc tex.Document, packages []string) error {
+	kv := tex.KV{"packages": packages}
+	if image := doc.Image(); image != "" {
+		kv["image"] = image
+	}
+	return tex.InputError("unknown package", nil, kv)
+}
+
+type packagesResponse struct {
+	Image    string   `json:"image,omitempty"`
+	Packages []string `json:"packages"`
+}
+
+// HandlePackages lists the packages of an image (selected with the image
+// parameter), or of the local installation.
+func (svc *service) HandlePackages(res http.ResponseWriter, req *http.Request) {
+	log := svc.Logger().With(middleware.RequestIDField(req.Context()))
+	image, err := svc.validateImageParam(req.URL.Query().Get("image"))
+	if err != nil {
+		errorResponse(log, res, err)
+		return
+	}
+	idx := svc.packages[image]
+	if idx == nil {
+		var kv tex.KV
+		if image != "" {
+			kv = tex.KV{"image": image}
+		}
+		errorResponse(log, res, tex.InputError("no package index available", nil, kv))
+		return
+	}
+
+	res.Header().Set("Content-Type", mimeTypeJSON)
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	res.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(res).Encode(packagesResponse{Image: image, Packages: idx.Names()}); err != nil {
+		log.Error("failed to write response", xlog.Error(err))
+	}
+}
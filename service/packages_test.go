@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/digineo/texd/exec"
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackages(t *testing.T) {
+	require.NoError(t, tex.SetJobBaseDir(t.TempDir()))
+	t.Cleanup(func() { _ = tex.SetJobBaseDir("") })
+
+	svc := newService(Options{
+		QueueLength: 1,
+		Mode:        "container",
+		Images:      []string{"texlive", "broken"},
+		Executor:    exec.Mock(false, mockPDF),
+	}, xlog.NewDiscard())
+	svc.probeImages(func(_ context.Context, image string, cmd []string) ([]byte, error) {
+		switch {
+		case image == "broken":
+			return nil, errors.New("kpsewhich: not found")
+		case slices.Equal(cmd, tex.PackageIndexCommand):
+			return []byte("graphicx.sty\nxcolor.sty\n"), nil
+		case slices.Equal(cmd, tex.DistributionCommand):
+			return []byte("pdftex: pdfTeX 3.141592653-2.6-1.40.25 (TeX Live 2023)\n"), nil
+		}
+		return nil, errors.New("unexpected command")
+	})
+	assert.Equal(t, map[string]tex.DistributionInfo{
+		"texlive": {TeXLive: "2023", Versions: map[string]string{"pdftex": "3.141592653-2.6-1.40.25"}},
+	}, svc.distributionStatus())
+
+	routes := svc.routes()
+	get := func(uri string) string {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, uri, nil))
+		body, err := io.ReadAll(rec.Result().Body)
+		require.NoError(t, err)
+		return strings.TrimSpace(string(body))
+	}
+	assert.Equal(t, `{"image":"texlive","packages":["graphicx","xcolor"]}`, get("/packages"))
+	assert.Equal(t, `{"category":"input","error":"no package index available","image":"broken"}`, get("/packages?image=broken"))
+	assert.Equal(t, `{"category":"input","error":"forbidden image name","image":"other"}`, get("/packages?image=other"))
+
+	check := func(image string, files ...[2]string) []string {
+		doc := tex.NewDocument(xlog.NewDiscard(), tex.DefaultEngine, image)
+		t.Cleanup(func() { _ = doc.Cleanup() })
+		for _, f := range files {
+			require.NoError(t, doc.AddFile(f[0], f[1]))
+		}
+		unknown, err := svc.unknownPackages(doc)
+		require.NoError(t, err)
+		return unknown
+	}
+	custom := [2]string{"custom.sty", `\RequirePackage{xcolor}`}
+	assert.Empty(t, check("texlive", [2]string{"main.tex", `\usepackage{graphicx,xcolor}`}, custom))
+	assert.Equal(t, []string{"fontspec", "tikz"}, check("texlive",
+		[2]string{"main.tex", `\usepackage{graphicx,custom}\usepackage{fontspec}\RequirePackage{tikz}`}, custom))
+	assert.Empty(t, check("broken", [2]string{"main.tex", `\usepackage{fontspec}`}))
+
+	// latexmk runs in the directory of the main input
+	assert.Empty(t, check("texlive",
+		[2]string{"sub/main.tex", `\documentclass{article}\usepackage{custom}`},
+		[2]string{"sub/custom.sty", ""}))
+
+	// an empty index doesn't reject anything
+	svc.packages["texlive"] = tex.ParsePackageIndex(nil)
+	assert.Empty(t, check("texlive", [2]string{"main.tex", `\usepackage{fontspec}`}))
+
+	svc.packages["texlive"] = tex.ParsePackageIndex([]byte("graphicx.sty\n"))
+	doc := tex.NewDocument(xlog.NewDiscard(), tex.DefaultEngine, "texlive")
+	t.Cleanup(func() { _ = doc.Cleanup() })
+	require.NoError(t, doc.AddFile("main.tex", `\usepackage{graphicx}\usepackage{fontspec}`))
+	err := svc.checkPackages(doc)
+	require.EqualError(t, err, "unknown package")
+	assert.Equal(t, tex.KV{"packages": []string{"fontspec"}, "image": "texlive"}, err.(*tex.ErrWithCategory).Extra()) //nolint:errorlint,forcetypeassert
+
+	svc.noPkgCheck = true
+	assert.NoError(t, svc.checkPackages(doc))
+}
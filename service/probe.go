@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/digineo/texd/exec"
+	"github.com/digineo/texd/metrics"
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+)
+
+// probeTimeout limits the duration of each probe command at startup.
+const probeTimeout = time.Minute
+
+// probeImages inspects the TeX distribution of each image (or the local
+// installation in local mode): it builds a package index, and determines
+// the versions of TeX Live and its programs. Failures are not fatal,
+// documents for images without package index are not checked.
+func (svc *service) probeImages(probe exec.Prober) {
+	images := svc.images
+	if svc.mode != "container" {
+		images = []string{""}
+	}
+
+	svc.packages = make(map[string]*tex.PackageIndex, len(images))
+	svc.distributions = make(map[string]tex.DistributionInfo, len(images))
+	for _, image := range images {
+		log := svc.Logger().With(xlog.String("image", image))
+		run := func(cmd []string) ([]byte, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+			defer cancel()
+			return probe(ctx, image, cmd)
+		}
+
+		if out, err := run(tex.PackageIndexCommand); err != nil {
+			log.Warn("failed to build package index, skipping package checks", xlog.Error(err))
+		} else {
+			idx := tex.ParsePackageIndex(out)
+			log.Info("built package index", xlog.Int("packages", idx.Len()))
+			svc.packages[image] = idx
+		}
+
+		if out, err := run(tex.DistributionCommand); err != nil {
+			log.Warn("failed to inspect TeX distribution", xlog.Error(err))
+		} else {
+			info := tex.ParseDistribution(out)
+			log.Info("inspected TeX distribution",
+				xlog.String("texlive", info.TeXLive),
+				xlog.Any("versions", info.Versions))
+			svc.distributions[image] = info
+			if len(svc.signingKeys) > 0 && info.Versions["pyhanko"] == "" {
+				log.Warn("pyhanko not found, signing will fail")
+			}
+			metrics.TeXLiveInfo.WithLabelValues(image, info.TeXLive,
+				info.Versions["latexmk"],
+				info.Versions["pdftex"],
+				info.Versions["xetex"],
+				info.Versions["luatex"],
+			).Set(1)
+		}
+	}
+}
+
+// distributionStatus returns the distribution details for /status, by
+// image name ("local" in local mode).
+func (svc *service) distributionStatus() map[string]tex.DistributionInfo {
+	if len(svc.distributions) == 0 {
+		return nil
+	}
+	status := make(map[string]tex.DistributionInfo, len(svc.distributions))
+	for image, info := range svc.distributions {
+		if image == "" {
+			image = "local"
+		}
+		status[image] = info
+	}
+	return status
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/digineo/texd/tex"
+)
+
+// A Profile is a named set of render parameters, defined by the server
+// administrator. Clients select a profile with the profile= parameter,
+// instead of repeating the parameters on every request.
+type Profile struct {
+	Name   string
+	Params url.Values
+}
+
+// profileKeys lists the render parameters a profile may define.
+var profileKeys = []string{
+	"engine", "image", "errors", "bib", "strict", "tools", "env",
+	"artifacts", "postprocess", "prepend", "append", "sign", "sign-box", "reproducible",
+	"meta-title", "meta-author", "meta-subject", "meta-keywords",
+}
+
+var profileNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// ParseProfile parses a profile definition of the form "name=params",
+// where params is a URL query string:
+//
+//	invoice=engine=lualatex&image=texlive:2024&strict=true&tools=biber
+//
+// Only the syntax is checked here, the values are validated on Start.
+func ParseProfile(def string) (Profile, error) {
+	name, query, ok := strings.Cut(def, "=")
+	if !ok || !profileNamePattern.MatchString(name) {
+		return Profile{}, fmt.Errorf("invalid profile definition %q: expected name=params", def)
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return Profile{}, fmt.Errorf("invalid profile definition %q: %w", def, err)
+	}
+	if len(params) == 0 {
+		return Profile{}, fmt.Errorf("invalid profile definition %q: no parameters given", def)
+	}
+	for key, values := range params {
+		if !slices.Contains(profileKeys, key) {
+			return Profile{}, fmt.Errorf("invalid profile definition %q: unsupported parameter %q", def, key)
+		}
+		if len(values) != 1 {
+			return Profile{}, fmt.Errorf("invalid profile definition %q: parameter %q given multiple times", def, key)
+		}
+	}
+	return Profile{Name: name, Params: params}, nil
+}
+
+// validateProfiles ensures each profile is acceptable, given the configured
+// images, engines and tools.
+func (svc *service) validateProfiles() error {
+	seen := make(map[string]bool, len(svc.profiles))
+	for _, p := range svc.profiles {
+		if seen[p.Name] {
+			return fmt.Errorf("duplicate profile %q", p.Name)
+		}
+		seen[p.Name] = true
+		if err := svc.validateProfile(p); err != nil {
+			return fmt.Errorf("invalid profile %q: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+func (svc *service) validateProfile(p Profile) error {
+	image, err := svc.validateImageParam(p.Params.Get("image"))
+	if err != nil {
+		return err
+	}
+	if _, err = svc.validateEngineParam(p.Params.Get("engine"), image); err != nil {
+		return err
+	}
+	if errs := p.Params.Get("errors"); errs != "" && errs != "full" && errs != "condensed" {
+		return fmt.Errorf("unsupported errors value %q", errs)
+	}
+	if _, err = tex.ParseBibTool(p.Params.Get("bib")); err != nil {
+		return err
+	}
+	if _, err = tex.ParseStrict(p.Params.Get("strict")); err != nil {
+		return err
+	}
+	if _, err = tex.ParseTools(p.Params.Get("tools")); err != nil {
+		return err
+	}
+	output, err := tex.Output{}.WithPostProcess(p.Params.Get("postprocess"))
+	if err != nil {
+		return err
+	}
+	if output, err = output.WithArtifacts(p.Params.Get("artifacts")); err != nil {
+		return err
+	}
+	if output, err = output.WithMerge(p.Params.Get("prepend"), p.Params.Get("append")); err != nil {
+		return err
+	}
+	if output, err = applyMetadata(output, p.Params); err != nil {
+		return err
+	}
+	if output, err = applyReproducible(output, p.Params); err != nil {
+		return err
+	}
+	if _, err = tex.ParseEnv(p.Params["env"]); err != nil {
+		return err
+	}
+	_, err = svc.applySignature(output, p.Params)
+	return err
+}
+
+// applyProfile merges the parameters of the profile selected by the
+// profile= parameter into params. Parameters defined by the profile
+// can't be overridden with a different value, which allows using
+// profiles to enforce settings. The API key of the request (see
+// authenticate) must permit the profile.
+func (svc *service) applyProfile(ctx context.Context, params url.Values) (url.Values, error) {
+	params, err := authorizeProfile(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	name := params.Get("profile")
+	if name == "" {
+		return params, nil
+	}
+	i := slices.IndexFunc(svc.profiles, func(p Profile) bool { return p.Name == name })
+	if i < 0 {
+		return nil, tex.InputError("unknown profile", nil, tex.KV{"profile": name})
+	}
+
+	merged := make(url.Values, len(params))
+	for key, values := range params {
+		merged[key] = values
+	}
+	for key, values := range svc.profiles[i].Params {
+		if v, ok := params[key]; ok && !slices.Equal(v, values) {
+			return nil, tex.InputError("parameter conflicts with profile", nil, tex.KV{
+				"profile":   name,
+				"parameter": key,
+			})
+		}
+		merged[key] = values
+	}
+	return merged, nil
+}
+
+// profileStatus lists the profile parameters for the status endpoint.
+func (svc *service) profileStatus() map[string]map[string]string {
+	if len(svc.profiles) == 0 {
+		return nil
+	}
+	status := make(map[string]map[string]string, len(svc.profiles))
+	for _, p := range svc.profiles {
+		params := make(map[string]string, len(p.Params))
+		for key := range p.Params {
+			params[key] = p.Params.Get(key)
+		}
+		status[p.Name] = params
+	}
+	return status
+}
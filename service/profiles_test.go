@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProfile(t *testing.T) {
+	t.Parallel()
+
+	p, err := ParseProfile("invoice=engine=lualatex&image=texlive&strict=true&tools=biber,makeindex")
+	require.NoError(t, err)
+	assert.Equal(t, "invoice", p.Name)
+	assert.Equal(t, url.Values{
+		"engine": {"lualatex"},
+		"image":  {"texlive"},
+		"strict": {"true"},
+		"tools":  {"biber,makeindex"},
+	}, p.Params)
+
+	for def, msg := range map[string]string{
+		"invoice":                     "expected name=params",
+		"Invoice=engine=lualatex":     "expected name=params",
+		"invoice=":                    "no parameters given",
+		"invoice=input=main.tex":      `unsupported parameter "input"`,
+		"invoice=profile=other":       `unsupported parameter "profile"`,
+		"invoice=engine=a&engine=b":   `parameter "engine" given multiple times`,
+		"invoice=engine=lualatex&%zz": "invalid URL escape",
+	} {
+		_, err := ParseProfile(def)
+		require.Error(t, err, def)
+		assert.Contains(t, err.Error(), msg, def)
+	}
+}
+
+func mustParseProfile(t *testing.T, def string) Profile {
+	t.Helper()
+	p, err := ParseProfile(def)
+	require.NoError(t, err)
+	return p
+}
+
+func TestValidateProfiles(t *testing.T) {
+	t.Parallel()
+
+	svc := &service{
+		mode:         "container",
+		images:       []string{"texlive", "texlive-lua"},
+		imageEngines: map[string][]string{"texlive-lua": {"lualatex"}},
+	}
+
+	svc.profiles = []Profile{
+		mustParseProfile(t, "invoice=engine=lualatex&image=texlive-lua&strict=true&errors=condensed&postprocess=pdfa"),
+		mustParseProfile(t, "thesis=tools=biber,makeglossaries"),
+	}
+	assert.NoError(t, svc.validateProfiles())
+
+	for def, msg := range map[string]string{
+		"p=image=unknown":                    `invalid profile "p": forbidden image name`,
+		"p=engine=dings":                     `invalid profile "p": unknown engine`,
+		"p=engine=xelatex&image=texlive-lua": `invalid profile "p": engine not available in image`,
+		"p=errors=verbose":                   `invalid profile "p": unsupported errors value "verbose"`,
+		"p=bib=makeindex":                    `invalid profile "p": unsupported bibliography tool`,
+		"p=strict=maybe":                     `invalid profile "p": invalid strictness value`,
+		"p=tools=perl":                       `invalid profile "p": unsupported tool`,
+		"p=postprocess=zip":                  `invalid profile "p": unsupported post-processor`,
+		"p=env=HOME%3D/root":                 `invalid profile "p": unsupported environment variable`,
+		"p=artifacts=pdf":                    `invalid profile "p": unsupported artifact`,
+		"p=reproducible=later":               `invalid profile "p": invalid reproducible option`,
+		"p=sign=contracts":                   `invalid profile "p": unknown signing key`,
+	} {
+		svc.profiles = []Profile{mustParseProfile(t, def)}
+		err := svc.validateProfiles()
+		require.Error(t, err, def)
+		assert.Contains(t, err.Error(), msg, def)
+	}
+
+	svc.profiles = []Profile{
+		mustParseProfile(t, "p=engine=lualatex"),
+		mustParseProfile(t, "p=engine=pdflatex"),
+	}
+	assert.EqualError(t, svc.validateProfiles(), `duplicate profile "p"`)
+}
+
+func TestApplyProfile(t *testing.T) {
+	t.Parallel()
+
+	svc := &service{profiles: []Profile{
+		mustParseProfile(t, "invoice=engine=lualatex&strict=true"),
+	}}
+
+	params, err := svc.applyProfile(context.Background(), url.Values{"input": {"main.tex"}})
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{"input": {"main.tex"}}, params)
+
+	params, err = svc.applyProfile(context.Background(), url.Values{
+		"profile": {"invoice"},
+		"input":   {"main.tex"},
+		"strict":  {"true"}, // same value is fine
+	})
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"profile": {"invoice"},
+		"input":   {"main.tex"},
+		"engine":  {"lualatex"},
+		"strict":  {"true"},
+	}, params)
+
+	_, err = svc.applyProfile(context.Background(), url.Values{"profile": {"invoice"}, "engine": {"xelatex"}})
+	assert.EqualError(t, err, "parameter conflicts with profile")
+	assert.Equal(t, tex.KV{"profile": "invoice", "parameter": "engine"}, err.(*tex.ErrWithCategory).Extra()) //nolint:forcetypeassert,errorlint
+
+	_, err = svc.applyProfile(context.Background(), url.Values{"profile": {"letter"}})
+	assert.EqualError(t, err, "unknown profile")
+}
+
+func TestHandleStatus_profiles(t *testing.T) {
+	svc := &service{
+		mode:     "local",
+		profiles: []Profile{mustParseProfile(t, "invoice=engine=lualatex&strict=true")},
+		jobs:     make(chan struct{}, 2),
+		log:      xlog.NewDiscard(),
+	}
+
+	rec := httptest.NewRecorder()
+	svc.HandleStatus(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var status Status
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&status))
+	assert.Equal(t, map[string]map[string]string{
+		"invoice": {"engine": "lualatex", "strict": "true"},
+	}, status.Profiles)
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digineo/texd/exec"
+	"github.com/digineo/texd/metrics"
+	"github.com/digineo/texd/service/middleware"
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+	"github.com/gorilla/mux"
+)
+
+const mimeTypeEventStream = "text/event-stream"
+
+// resultTTL limits how long results of streamed jobs are kept, if they
+// aren't fetched.
+const resultTTL = time.Minute
+
+// wantsProgress reports whether the client asked for a progress stream
+// instead of the result.
+func wantsProgress(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), mimeTypeEventStream)
+}
+
+// eventStream sends Server-Sent Events. It is safe for concurrent use.
+type eventStream struct {
+	mu     sync.Mutex
+	log    xlog.Logger
+	res    http.ResponseWriter
+	rc     *http.ResponseController
+	failed bool // the client is likely gone, drop further events
+}
+
+type progressKey struct{}
+
+// progressFrom returns the event stream of a render job, or nil.
+func progressFrom(ctx context.Context) *eventStream {
+	es, _ := ctx.Value(progressKey{}).(*eventStream)
+	return es
+}
+
+func (es *eventStream) send(event string, data any) {
+	if es == nil {
+		return
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		es.log.Error("failed to encode event", xlog.String("event", event), xlog.Error(err))
+		return
+	}
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.failed {
+		return
+	}
+	_, err = es.res.Write([]byte("event: " + event + "\ndata: " + string(payload) + "\n\n"))
+	if err == nil {
+		err = es.rc.Flush()
+	}
+	if err != nil {
+		es.log.Error("failed to send event", xlog.String("event", event), xlog.Error(err))
+		es.failed = true
+	}
+}
+
+type queueEvent struct {
+	Position int `json:"position"` // waiting jobs, including this one
+	Length   int `json:"length"`
+	Capacity int `json:"capacity"`
+}
+
+type resultEvent struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+}
+
+// renderFunc is the signature of svc.render and svc.renderWorkspace.
+type renderFunc func(xlog.Logger, http.ResponseWriter, *http.Request) error
+
+// streamProgress runs render, and reports its progress as Server-Sent
+// Events (queue position, compiler passes, pages and warnings). The
+// result is kept in a temporary file, and the final "result" event links
+// to it (see HandleResult). Failures are reported with an "error" event.
+func (svc *service) streamProgress(log xlog.Logger, res http.ResponseWriter, req *http.Request, render renderFunc) {
+	es := &eventStream{log: log, res: res, rc: http.NewResponseController(res)}
+	// HTTP/1 servers discard the unread request body once the response
+	// headers are written, but render still needs to read the files
+	if err := es.rc.EnableFullDuplex(); err != nil {
+		log.Debug("full duplex unavailable", xlog.Error(err))
+	}
+	res.Header().Set("Content-Type", mimeTypeEventStream)
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no") // disable buffering in nginx
+	res.WriteHeader(http.StatusOK)
+
+	progress := tex.NewProgress(func(ev tex.ProgressEvent) { es.send(ev.Type, ev) })
+	ctx := context.WithValue(req.Context(), progressKey{}, es)
+	ctx = exec.WithOutput(ctx, progress)
+
+	result := &spooledResponse{header: make(http.Header)}
+	if err := render(log, result, req.WithContext(ctx)); err != nil {
+		result.discard()
+		metrics.ProcessedFailure.Inc()
+		es.send("error", errorBody(err))
+		return
+	}
+
+	id, _ := middleware.GetRequestID(req)
+	svc.results.store(id, result)
+	es.send("result", resultEvent{URL: "/jobs/" + id + "/result", Status: result.code})
+}
+
+// HandleResult sends the result of a streamed job (see streamProgress).
+// Results can only be fetched once.
+func (svc *service) HandleResult(res http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+	log := svc.Logger().With(middleware.RequestIDField(req.Context()))
+	result := svc.results.take(id)
+	if result == nil {
+		errorResponse(log, res, tex.InputError("unknown result", nil, tex.KV{"job": id}))
+		return
+	}
+	defer result.discard()
+	if err := result.send(res); err != nil {
+		log.Error("failed to send result", xlog.Error(err))
+	}
+}
+
+// spooledResponse is an http.ResponseWriter, which writes the response
+// body into a temporary file in the job directory (see tex.JobBaseDir).
+type spooledResponse struct {
+	header http.Header
+	code   int
+	body   *os.File // created on first write
+	expiry *time.Timer
+}
+
+func (r *spooledResponse) Header() http.Header { return r.header }
+
+func (r *spooledResponse) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+}
+
+func (r *spooledResponse) Write(p []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	if r.body == nil {
+		f, err := os.CreateTemp(tex.JobBaseDir(), "texd-result-")
+		if err != nil {
+			return 0, err
+		}
+		r.body = f
+	}
+	return r.body.Write(p)
+}
+
+// send writes the stored response to res.
+func (r *spooledResponse) send(res http.ResponseWriter) error {
+	for k, v := range r.header {
+		res.Header()[k] = v
+	}
+	res.WriteHeader(r.code)
+	if r.body == nil {
+		return nil
+	}
+	if _, err := r.body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(res, r.body)
+	return err
+}
+
+// discard removes the temporary file.
+func (r *spooledResponse) discard() {
+	if r.body != nil {
+		_ = r.body.Close()
+		_ = os.Remove(r.body.Name())
+	}
+}
+
+// resultStore keeps results of streamed jobs until they are fetched, or
+// until they expire.
+type resultStore struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	items map[string]*spooledResponse
+}
+
+func newResultStore(ttl time.Duration) *resultStore {
+	return &resultStore{ttl: ttl, items: make(map[string]*spooledResponse)}
+}
+
+// store keeps r, and discards it when it isn't taken within the TTL.
+func (rs *resultStore) store(id string, r *spooledResponse) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.items[id] = r
+	r.expiry = time.AfterFunc(rs.ttl, func() {
+		if r := rs.take(id); r != nil {
+			r.discard()
+		}
+	})
+}
+
+// take removes a result from the store. The caller must discard it.
+func (rs *resultStore) take(id string) *spooledResponse {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	r := rs.items[id]
+	if r != nil {
+		r.expiry.Stop()
+		delete(rs.items, id)
+	}
+	return r
+}
+
+// close discards all results.
+func (rs *resultStore) close() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for id, r := range rs.items {
+		r.expiry.Stop()
+		r.discard()
+		delete(rs.items, id)
+	}
+}
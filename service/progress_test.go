@@ -0,0 +1,55 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digineo/texd/tex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultStore(t *testing.T) {
+	require.NoError(t, tex.SetJobBaseDir(t.TempDir()))
+	t.Cleanup(func() { _ = tex.SetJobBaseDir("") })
+
+	newResult := func() *spooledResponse {
+		r := &spooledResponse{header: make(http.Header)}
+		r.Header().Set("Content-Type", mimeTypePDF)
+		_, err := r.Write([]byte(mockPDF))
+		require.NoError(t, err)
+		return r
+	}
+
+	rs := newResultStore(20 * time.Millisecond)
+	taken, expired := newResult(), newResult()
+	rs.store("taken", taken)
+	rs.store("expired", expired)
+
+	r := rs.take("taken")
+	require.Same(t, taken, r)
+	assert.Nil(t, rs.take("taken"))
+	rec := httptest.NewRecorder()
+	require.NoError(t, r.send(rec))
+	r.discard()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, mimeTypePDF, rec.Header().Get("Content-Type"))
+	assert.Equal(t, mockPDF, rec.Body.String())
+	assert.NoFileExists(t, taken.body.Name())
+
+	assert.FileExists(t, expired.body.Name())
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(expired.body.Name())
+		return os.IsNotExist(err)
+	}, time.Second, 5*time.Millisecond)
+	assert.Nil(t, rs.take("expired"))
+
+	closed := newResult()
+	rs.store("closed", closed)
+	rs.close()
+	assert.NoFileExists(t, closed.body.Name())
+	assert.Nil(t, rs.take("closed"))
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"archive/zip"
 	"bufio"
 	"bytes"
 	"context"
@@ -10,6 +11,8 @@ import (
 	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/url"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -23,6 +26,8 @@ import (
 
 func (svc *service) Close() {
 	close(svc.jobs)
+	svc.workspaces.close(svc.Logger())
+	svc.results.close()
 }
 
 func (svc *service) HandleRender(res http.ResponseWriter, req *http.Request) {
@@ -34,6 +39,10 @@ func (svc *service) HandleRender(res http.ResponseWriter, req *http.Request) {
 	}
 
 	log := svc.Logger().With(middleware.RequestIDField(req.Context()))
+	if wantsProgress(req) {
+		svc.streamProgress(log, res, req, svc.render)
+		return
+	}
 	if err := svc.render(log, res, req); err != nil {
 		metrics.ProcessedFailure.Inc()
 		errorResponse(log, res, err)
@@ -45,13 +54,23 @@ func (svc *service) shouldKeepJobs(err error) bool {
 	return svc.keepJobs == KeepJobsAlways || (svc.keepJobs == KeepJobsOnFailure && err != nil)
 }
 
-func (svc *service) render(log xlog.Logger, res http.ResponseWriter, req *http.Request) error { //nolint:funlen
-	params := req.URL.Query()
-	image, err := svc.validateImageParam(params.Get("image"))
+// jobOptions are the validated request parameters of a render job.
+type jobOptions struct {
+	image  string
+	engine tex.Engine
+	output tex.Output
+	env    map[string]string
+}
+
+func (svc *service) render(log xlog.Logger, res http.ResponseWriter, req *http.Request) error {
+	params, err := svc.applyProfile(req.Context(), req.URL.Query())
 	if err != nil {
 		return err
 	}
-	engine, err := svc.validateEngineParam(params.Get("engine"))
+	if profile := params.Get("profile"); profile != "" {
+		log = log.With(xlog.String("profile", profile))
+	}
+	opts, err := svc.parseJobOptions(params)
 	if err != nil {
 		return err
 	}
@@ -64,7 +83,9 @@ func (svc *service) render(log xlog.Logger, res http.ResponseWriter, req *http.R
 	}
 	defer svc.release()
 
-	doc := tex.NewDocument(log, engine, image)
+	doc := tex.NewDocument(log, opts.engine, opts.image)
+	doc.SetOutput(opts.output)
+	doc.SetEnv(opts.env)
 	if id, ok := middleware.GetRequestID(req); ok {
 		doc.SetWorkingDirName(id)
 	}
@@ -87,62 +108,212 @@ func (svc *service) render(log xlog.Logger, res http.ResponseWriter, req *http.R
 		return err
 	}
 
-	// Optionally, set main input file. When present, the name must be
-	// included of multipart request body.
-	if input := params.Get("input"); input != "" {
-		if err = doc.SetMainInput(input); err != nil {
-			log.Error("invalid main input file",
-				xlog.String("filename", input),
-				xlog.Error(err))
-			return err
-		}
+	var written bool
+	if written, err = svc.compile(log, res, req, doc, params); written {
+		return nil // header is already written
 	}
+	return err
+}
 
-	// Check presence main input file. If not given, guess from file
-	// listing.
-	if _, err = doc.MainInput(); err != nil {
-		return err
+// parseJobOptions validates the request parameters, which don't depend
+// on the input files.
+func (svc *service) parseJobOptions(params url.Values) (opts jobOptions, err error) {
+	if opts.image, err = svc.validateImageParam(params.Get("image")); err != nil {
+		return opts, err
+	}
+	if opts.engine, err = svc.validateEngineParam(params.Get("engine"), opts.image); err != nil {
+		return opts, err
+	}
+	output, err := tex.ParseOutput(params.Get("format"), params.Get("dpi"), params.Get("pages"))
+	if err != nil {
+		return opts, tex.InputError("invalid output format", err, nil)
+	}
+	if output, err = output.WithPostProcess(params.Get("postprocess")); err != nil {
+		return opts, tex.InputError("invalid post-processing", err, tex.KV{"postprocess": params.Get("postprocess")})
+	}
+	if output, err = output.WithArtifacts(params.Get("artifacts")); err != nil {
+		return opts, tex.InputError("invalid artifacts", err, tex.KV{"artifacts": params.Get("artifacts")})
+	}
+	if output, err = output.WithMerge(params.Get("prepend"), params.Get("append")); err != nil {
+		return opts, tex.InputError("invalid merge files", err, tex.KV{
+			"prepend": params.Get("prepend"),
+			"append":  params.Get("append"),
+		})
+	}
+	if output, err = applyMetadata(output, params); err != nil {
+		return opts, err
+	}
+	if output, err = applyReproducible(output, params); err != nil {
+		return opts, err
+	}
+	if opts.env, err = tex.ParseEnv(params["env"]); err != nil {
+		return opts, tex.InputError("invalid environment variable", err, tex.KV{"env": params["env"]})
+	}
+	if opts.output, err = svc.applySignature(output, params); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// compile runs the executor for doc, whose files have already been
+// added, and sends the results. When written is true, the response header
+// was already written, and err (if any) can't be reported to the client
+// anymore.
+func (svc *service) compile(log xlog.Logger, res http.ResponseWriter, req *http.Request, doc tex.Document, params url.Values) (written bool, err error) { //nolint:funlen
+	if err = svc.prepare(log, doc, params); err != nil {
+		return false, err
 	}
 
 	if err := req.Context().Err(); err != nil {
 		log.Error("cancel render job, client is gone", xlog.Error(err))
 		metrics.ProcessedAborted.Inc()
-		return err
+		return false, err
+	}
+
+	// Unresolved file references (and unknown packages, if they are not
+	// checked) are a likely cause for compilation failures. They are not
+	// fatal, as the TeX distribution might provide them.
+	missing, merr := doc.MissingFiles()
+	if merr != nil {
+		log.Error("failed to scan dependencies", xlog.Error(merr))
+	} else if len(missing) > 0 {
+		log.Warn("unresolved file references", xlog.Any("missing", missing))
+	}
+	unknown, _ := svc.unknownPackages(doc) // scan errors are logged above
+	if len(unknown) > 0 {
+		log.Warn("unknown packages", xlog.Any("packages", unknown))
 	}
 
 	startProcessing := time.Now()
 	if err = svc.executor(doc).Run(req.Context(), log); err != nil {
+		if len(missing) > 0 {
+			tex.ExtendError(err, tex.KV{"unresolved": missing})
+		}
+		if len(unknown) > 0 {
+			tex.ExtendError(err, tex.KV{"unknown-packages": unknown})
+		}
+		diagnose(log, doc, err)
 		switch format := params.Get("errors"); format {
 		case "full", "condensed":
 			logReader, lerr := doc.GetLogs()
 			if lerr != nil {
 				log.Error("failed to get logs", xlog.Error(lerr))
-				return err // not lerr, client gets error from executor.Run()
+				return false, err // not lerr, client gets error from executor.Run()
 			}
 			logfileResponse(log, res, format, logReader)
-			return nil // header is already written
+			return true, err
 		}
-		return err
+		return false, err
 	}
 	metrics.ProcessingDuration.Observe(time.Since(startProcessing).Seconds())
 	metrics.ProcessedSuccess.Inc()
 
-	pdf, err := doc.GetResult()
+	results, err := doc.GetResults()
 	if err != nil {
 		log.Error("failed to get result", xlog.Error(err))
-		return err
+		return false, err
+	}
+	defer func() {
+		for _, r := range results {
+			_ = r.Close()
+		}
+	}()
+	artifacts, err := doc.GetArtifacts()
+	if err != nil {
+		log.Error("failed to get artifacts", xlog.Error(err))
+		return false, err
+	}
+	results = append(results, artifacts...)
+
+	// Send PDF (or other single file), or a ZIP archive of multiple files
+	// (or results with artifacts)
+	var n int64
+	output := doc.Output()
+	setMetadataHeaders(res.Header(), output.Metadata)
+	if len(results) == 1 && !output.IsArchive() {
+		res.Header().Set("Content-Type", output.MimeType())
+		res.WriteHeader(http.StatusOK)
+		n, err = io.Copy(res, results[0])
+	} else {
+		res.Header().Set("Content-Type", mimeTypeZIP)
+		res.Header().Set("Content-Disposition", `attachment; filename="`+output.Format+`.zip"`)
+		res.WriteHeader(http.StatusOK)
+		n, err = writeZIP(res, results)
 	}
-	defer func() { _ = pdf.Close() }()
-
-	// Send PDF
-	res.Header().Set("Content-Type", mimeTypePDF)
-	res.WriteHeader(http.StatusOK)
-	n, err := io.Copy(res, pdf)
 	if err != nil {
 		log.Error("failed to send results", xlog.Error(err))
 	}
-	metrics.OutputSize.Observe(float64(n))
-	return nil // header is already written
+	metrics.OutputSize.WithLabelValues(output.Format).Observe(float64(n))
+	return true, err
+}
+
+// prepare resolves the main input file and the engine for doc, whose
+// files have already been added, and checks the required packages.
+func (svc *service) prepare(log xlog.Logger, doc tex.Document, params url.Values) error {
+	// PDF files to merge must have been uploaded (or referenced).
+	if merge := doc.Output().Merge; merge != nil {
+		for _, name := range merge.Files() {
+			if !doc.HasFile(name) {
+				return tex.InputError("unknown merge file", nil, tex.KV{"file": name})
+			}
+		}
+	}
+
+	// Optionally, set main input file. When present, the name must be
+	// included of multipart request body.
+	if input := params.Get("input"); input != "" {
+		if err := doc.SetMainInput(input); err != nil {
+			log.Error("invalid main input file",
+				xlog.String("filename", input),
+				xlog.Error(err))
+			return err
+		}
+	}
+
+	// Check presence main input file. If not given, guess from file
+	// listing.
+	if _, err := doc.MainInput(); err != nil {
+		return err
+	}
+
+	// Apply settings from magic comments, unless overridden by request
+	// parameters.
+	if err := svc.applyMagicComments(log, doc, params); err != nil {
+		return err
+	}
+
+	// Fail early, if the TeX distribution lacks required packages.
+	return svc.checkPackages(doc)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// writeZIP writes a ZIP archive containing the given files to w, and
+// returns the archive size.
+func writeZIP(w io.Writer, files []tex.ResultFile) (int64, error) {
+	cw := &countingWriter{w: w}
+	zw := zip.NewWriter(cw)
+	for _, f := range files {
+		entry, err := zw.Create(f.Name)
+		if err != nil {
+			return cw.n, err
+		}
+		if _, err = io.Copy(entry, f); err != nil {
+			return cw.n, err
+		}
+	}
+	err := zw.Close()
+	return cw.n, err
 }
 
 // Validates name of Docker image. Ignored in local mode, but must be
@@ -163,17 +334,135 @@ func (svc *service) validateImageParam(image string) (string, error) {
 	return "", tex.InputError("forbidden image name", nil, tex.KV{"image": image})
 }
 
-// Validate TeX engine. Optional, but engine must be known to texd.
-func (svc *service) validateEngineParam(name string) (engine tex.Engine, err error) {
+// Validate TeX engine. Optional, but engine must be known to texd, and
+// it must be available in the given image. When omitted, the default
+// engine is used (or the first available engine, if the image does not
+// provide the default engine).
+func (svc *service) validateEngineParam(name, image string) (engine tex.Engine, err error) {
+	available, restricted := svc.imageEngines[image]
 	if name == "" {
-		return tex.DefaultEngine, nil
+		if !restricted || slices.Contains(available, tex.DefaultEngine.Name()) {
+			return tex.DefaultEngine, nil
+		}
+		name = available[0]
 	}
 	engine, err = tex.ParseEngine(name)
 	if err != nil {
 		log.Printf("invalid engine: %v", err)
-		err = tex.InputError("unknown engine", err, nil)
+		return engine, tex.InputError("unknown engine", err, nil)
+	}
+	if restricted && !slices.Contains(available, name) {
+		log.Printf("engine %q not available in image %q", name, image)
+		return engine, tex.InputError("engine not available in image", nil, tex.KV{
+			"engine": name,
+			"image":  image,
+		})
 	}
-	return
+	return engine, nil
+}
+
+// applyMagicComments resolves the engine and compiler options for doc.
+// Explicit request parameters take precedence over magic comments in
+// the main input file, which in turn take precedence over the defaults.
+// Magic comments are subject to the same restrictions as parameters.
+func (svc *service) applyMagicComments(log xlog.Logger, doc tex.Document, params url.Values) error {
+	magic := doc.MagicComments()
+	source := func(key string) (string, string) {
+		if v := params.Get(key); v != "" {
+			return v, "request"
+		}
+		if v := magic[key]; v != "" {
+			return v, "magic comment"
+		}
+		return "", "default"
+	}
+	fail := func(msg string, err error, key, value, src string) error {
+		return tex.InputError(msg, err, tex.KV{key: value, "source": src})
+	}
+
+	var (
+		engine = doc.Engine()
+		opts   tex.Options
+		err    error
+	)
+	engineName, engineSrc := source(tex.MagicEngine)
+	if engineSrc == "magic comment" {
+		// request parameter was already validated
+		if engine, err = svc.validateEngineParam(engineName, doc.Image()); err != nil {
+			tex.ExtendError(err, tex.KV{"engine": engineName, "source": engineSrc})
+			return err
+		}
+	}
+
+	if engine, err = doc.Output().Engine(engine); err != nil {
+		return tex.InputError("unsupported output format", err, tex.KV{
+			"engine": engine.Name(),
+			"format": doc.Output().Format,
+		})
+	}
+
+	bib, bibSrc := source(tex.MagicBib)
+	if opts.Bib, err = tex.ParseBibTool(bib); err != nil {
+		return fail("invalid bibliography tool", err, "bib", bib, bibSrc)
+	}
+	if bibSrc == "magic comment" && slices.Contains(tex.SupportedTools(), bib) &&
+		!slices.Contains(tex.AllowedTools(), bib) {
+		// documents may carry magic comments for other environments
+		log.Warn("ignoring bibliography tool from magic comment, not allowed",
+			xlog.String("bib", bib))
+		bib, bibSrc, opts.Bib = "", "default", ""
+	}
+	strict, strictSrc := source(tex.MagicStrict)
+	if opts.Strict, err = tex.ParseStrict(strict); err != nil {
+		return fail("invalid strictness", err, "strict", strict, strictSrc)
+	}
+
+	if opts.Tools, err = tex.ParseTools(params.Get("tools")); err != nil {
+		return tex.InputError("invalid tools", err, tex.KV{"tools": params.Get("tools")})
+	}
+	opts.Artifacts = doc.Output().Artifacts
+
+	if engine, err = engine.WithOptions(opts); err != nil {
+		return tex.InputError("unsupported options", err, tex.KV{
+			"engine": engine.Name(),
+			"bib":    opts.Bib,
+			"tools":  opts.Tools,
+		})
+	}
+	doc.SetEngine(engine)
+
+	main, _ := doc.MainInput()
+	log.Info("job settings",
+		xlog.String("input", main),
+		xlog.String("engine", engine.Name()),
+		xlog.String("engine-source", engineSrc),
+		xlog.String("bib", bib),
+		xlog.String("bib-source", bibSrc),
+		xlog.Any("strict", opts.Strict),
+		xlog.Any("tools", opts.Tools),
+		xlog.String("strict-source", strictSrc),
+		xlog.Any("postprocess", doc.Output().PostProcess),
+		xlog.Any("metadata", doc.Output().Metadata != nil),
+		xlog.Any("encrypted", doc.Output().Encryption != nil),
+		xlog.Any("signed", doc.Output().Signature != nil),
+		xlog.Any("reproducible", doc.Output().Reproducible),
+		xlog.Any("artifacts", doc.Output().Artifacts),
+		xlog.Any("env", doc.Environ()))
+	return nil
+}
+
+// applyReproducible enables reproducible builds, if requested with the
+// reproducible= parameter.
+func applyReproducible(output tex.Output, params url.Values) (tex.Output, error) {
+	value := params.Get("reproducible")
+	epoch, ok, err := tex.ParseReproducible(value)
+	if err == nil && ok {
+		output, err = output.WithReproducible(epoch)
+	}
+	if err != nil {
+		return output, tex.InputError("invalid reproducible option", err, tex.KV{"reproducible": value})
+	}
+	return output, nil
 }
 
 type errMissingReference struct{ ref string }
@@ -181,25 +470,18 @@ type errMissingReference struct{ ref string }
 func (err *errMissingReference) Error() string { return err.ref }
 
 func (svc *service) addFiles(log xlog.Logger, doc tex.Document, req *http.Request) error {
-	ct := req.Header.Get("Content-Type")
-	mt, params, err := mime.ParseMediaType(ct)
+	mr, err := multipartReader(req)
 	if err != nil {
-		return tex.InputError("failed to parse request: invalid content type", err, tex.KV{
-			"content-type": ct,
-		})
-	}
-	if mt != "multipart/form-data" {
-		return tex.InputError("unsupported media type: expected multipart/form-data", nil, tex.KV{
-			"media-type": mt,
-		})
+		return err
 	}
-	mr := multipart.NewReader(req.Body, params["boundary"])
 	var missingRefs []string
 	refErr := &errMissingReference{}
 	for i := 0; ; i++ {
 		part, err := mr.NextPart()
 		if err == io.EOF {
 			break
+		} else if err != nil {
+			return tex.InputError("failed to parse request", err, tex.KV{"part": i})
 		}
 		switch err = svc.addFileFromPart(log, doc, part, i); {
 		case errors.As(err, &refErr):
@@ -216,11 +498,33 @@ func (svc *service) addFiles(log xlog.Logger, doc tex.Document, req *http.Reques
 	return nil
 }
 
+func multipartReader(req *http.Request) (*multipart.Reader, error) {
+	ct := req.Header.Get("Content-Type")
+	mt, params, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return nil, tex.InputError("failed to parse request: invalid content type", err, tex.KV{
+			"content-type": ct,
+		})
+	}
+	if mt != "multipart/form-data" {
+		return nil, tex.InputError("unsupported media type: expected multipart/form-data", nil, tex.KV{
+			"media-type": mt,
+		})
+	}
+	return multipart.NewReader(req.Body, params["boundary"]), nil
+}
+
 func (svc *service) addFileFromPart(log xlog.Logger, doc tex.Document, part *multipart.Part, partNum int) error {
 	name := part.FormName()
 	if name == "" {
 		return tex.InputError("empty name", nil, tex.KV{"part": partNum})
 	}
+	switch name {
+	case encryptionField:
+		return setEncryption(doc, part, partNum)
+	case xmpField:
+		return setXMP(doc, part, partNum)
+	}
 
 	target, err := doc.NewWriter(name)
 	if err != nil {
@@ -318,7 +622,6 @@ func observeRenderMetrics(doc tex.Document) {
 	observe("data", m.DataFiles)
 	observe("other", m.OtherFiles)
 
-	if m.Result >= 0 {
-		metrics.OutputSize.Observe(float64(m.Result))
-	}
+	// The output size is observed when sending the result (see compile),
+	// as m.Result might be an intermediate PDF file.
 }
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/digineo/texd/exec"
@@ -27,6 +28,7 @@ const (
 	mimeTypePlain = "text/plain; charset=utf-8"
 	mimeTypeHTML  = "text/html; charset=utf-8"
 	mimeTypeTexd  = "application/x.texd"
+	mimeTypeZIP   = "application/zip"
 
 	KeepJobsNever = iota
 	KeepJobsAlways
@@ -43,16 +45,46 @@ type Options struct {
 	Mode           string
 	KeepJobs       int // used for debugging
 	Images         []string
+	ImageEngines   map[string][]string // optional engine restrictions per image
+	Profiles       []Profile           // named parameter sets, see ParseProfile
+	SigningKeys    []tex.SigningKey    // see tex.ParseSigningKey
+	APIKeys        []APIKey            // see ParseAPIKey, empty disables authentication
 	RefStore       refstore.Adapter
+
+	// Prober is used at startup to inspect the TeX distribution of each
+	// image (or the local installation), see probeImages. Packages are not
+	// checked, if Prober is nil. With NoPackageCheck, documents requiring
+	// unknown packages are compiled anyway (the unknown packages are only
+	// logged).
+	Prober         exec.Prober
+	NoPackageCheck bool
+
+	// Workspaces limits the number of persistent workspaces (0 disables
+	// them). Idle workspaces expire after WorkspaceIdle, and their size
+	// is limited to WorkspaceQuota bytes (including auxiliary files).
+	Workspaces     int
+	WorkspaceIdle  time.Duration
+	WorkspaceQuota int64
 }
 
 type service struct {
-	mode   string
-	images []string
-	refs   refstore.Adapter
-	addr   string // for tests, when start(":0") was called
+	mode          string
+	images        []string
+	imageEngines  map[string][]string
+	profiles      []Profile
+	signingKeys   []tex.SigningKey
+	apiKeys       []APIKey
+	refs          refstore.Adapter
+	packages      map[string]*tex.PackageIndex    // by image, "" in local mode
+	distributions map[string]tex.DistributionInfo // likewise
+	noPkgCheck    bool                            // only warn about unknown packages
+	workspaces    *workspaces
+	results       *resultStore // of streamed jobs
+	addr          string       // for tests, when start(":0") was called
 
 	jobs           chan struct{}
+	queued         atomic.Int64 // number of jobs which entered the queue
+	dequeued       atomic.Int64 // number of jobs which left the queue (started or gave up)
 	executor       func(exec.Document) exec.Exec
 	compileTimeout time.Duration
 	queueTimeout   time.Duration
@@ -72,7 +104,14 @@ func newService(opts Options, log xlog.Logger) *service {
 		maxJobSize:     opts.MaxJobSize,
 		keepJobs:       opts.KeepJobs,
 		images:         opts.Images,
+		imageEngines:   opts.ImageEngines,
+		profiles:       opts.Profiles,
+		signingKeys:    opts.SigningKeys,
+		apiKeys:        opts.APIKeys,
+		noPkgCheck:     opts.NoPackageCheck,
 		refs:           opts.RefStore,
+		workspaces:     newWorkspaces(opts.Workspaces, opts.WorkspaceIdle, opts.WorkspaceQuota),
+		results:        newResultStore(resultTTL),
 		log:            log,
 	}
 	if svc.queueTimeout <= 0 {
@@ -90,13 +129,36 @@ func (svc *service) routes() http.Handler {
 	r.PathPrefix("/assets/").Handler(HandleAssets()).Methods(http.MethodGet)
 	r.PathPrefix("/docs/").Handler(http.StripPrefix("/docs/", HandleDocs())).Methods(http.MethodGet)
 
+	// endpoints processing documents require an API key, if configured
+	auth := svc.authenticate
+
 	render := http.Handler(http.HandlerFunc(svc.HandleRender))
 	if max := svc.maxJobSize; max > 0 {
 		render = http.MaxBytesHandler(render, max)
 	}
-	r.Handle("/render", render).Methods(http.MethodPost)
+	r.Handle("/render", auth(render)).Methods(http.MethodPost)
+
+	validate := http.Handler(http.HandlerFunc(svc.HandleValidate))
+	if max := svc.maxJobSize; max > 0 {
+		validate = http.MaxBytesHandler(validate, max)
+	}
+	r.Handle("/validate", auth(validate)).Methods(http.MethodPost)
+
+	workspace := http.HandlerFunc(svc.HandleWorkspace)
+	upload := http.Handler(workspace)
+	if max := svc.maxJobSize; max > 0 {
+		upload = http.MaxBytesHandler(upload, max)
+	}
+	r.Handle("/workspaces", auth(workspace)).Methods(http.MethodPost)
+	r.Handle("/workspaces/{id}", auth(workspace)).Methods(http.MethodGet, http.MethodDelete)
+	r.Handle("/workspaces/{id}", auth(upload)).Methods(http.MethodPatch)
+	r.Handle("/workspaces/{id}/files/{name:.+}", auth(upload)).Methods(http.MethodPut, http.MethodDelete)
+	r.Handle("/workspaces/{id}/render", auth(http.HandlerFunc(svc.HandleWorkspaceRender))).Methods(http.MethodPost)
 
 	r.HandleFunc("/status", svc.HandleStatus).Methods(http.MethodGet)
+	r.HandleFunc("/packages", svc.HandlePackages).Methods(http.MethodGet)
+	r.Handle("/jobs/{id}/result", auth(http.HandlerFunc(svc.HandleResult))).Methods(http.MethodGet)
+	r.Handle("/jobs/{id}/synctex/{direction:forward|reverse}", auth(http.HandlerFunc(svc.HandleSyncTeX))).Methods(http.MethodGet)
 	r.Handle("/metrics", svc.newMetricsHandler()).Methods(http.MethodGet)
 
 	// r.Use(handlers.RecoveryHandler())
@@ -122,6 +184,8 @@ func (svc *service) start(addr string) (func(context.Context) error, error) {
 	}
 	svc.addr = l.Addr().String()
 
+	go svc.workspaces.run(svc.Logger())
+
 	go func() {
 		if e := srv.Serve(l); !errors.Is(e, http.ErrServerClosed) {
 			svc.Logger().Error("unexpected HTTP server shutdown", xlog.Error(err))
@@ -138,7 +202,20 @@ func (svc *service) start(addr string) (func(context.Context) error, error) {
 }
 
 func Start(opts Options, log xlog.Logger) (func(context.Context) error, error) {
-	return newService(opts, log).start(opts.Addr)
+	svc := newService(opts, log)
+	if err := svc.validateSigningKeys(); err != nil {
+		return nil, err
+	}
+	if err := svc.validateProfiles(); err != nil {
+		return nil, err
+	}
+	if err := svc.validateAPIKeys(); err != nil {
+		return nil, err
+	}
+	if opts.Prober != nil {
+		svc.probeImages(opts.Prober)
+	}
+	return svc.start(opts.Addr)
 }
 
 var discardlog = xlog.NewDiscard()
@@ -169,16 +246,19 @@ func errorResponse(log xlog.Logger, res http.ResponseWriter, err error) {
 	res.Header().Set("X-Content-Type-Options", "nosniff")
 	res.WriteHeader(http.StatusUnprocessableEntity)
 
-	var respErr error
-	if cat, ok := err.(*tex.ErrWithCategory); ok {
-		respErr = json.NewEncoder(res).Encode(cat)
-	} else {
-		respErr = json.NewEncoder(res).Encode(map[string]string{
-			"error":    "internal server error",
-			"category": "internal",
-		})
-	}
-	if respErr != nil {
+	if respErr := json.NewEncoder(res).Encode(errorBody(err)); respErr != nil {
 		log.Error("failed to write response", xlog.Error(respErr))
 	}
 }
+
+// errorBody returns the JSON representation of err. Errors without a
+// category are not disclosed.
+func errorBody(err error) any {
+	if cat, ok := err.(*tex.ErrWithCategory); ok {
+		return cat
+	}
+	return map[string]string{
+		"error":    "internal server error",
+		"category": "internal",
+	}
+}
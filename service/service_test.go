@@ -1,6 +1,7 @@
 package service
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"testing"
@@ -19,8 +21,11 @@ import (
 	"github.com/digineo/texd/exec"
 	"github.com/digineo/texd/refstore"
 	"github.com/digineo/texd/refstore/dir"
+	"github.com/digineo/texd/tex"
 	"github.com/digineo/xlog"
 	"github.com/docker/go-units"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -96,8 +101,10 @@ type serviceTestCase struct {
 
 	statusCode   int
 	query        string // raw query params, without leading "?"
+	accept       string // Accept header
 	expectedMIME string
 	expectedBody string
+	checkBody    func(body []byte) // replaces the comparison with expectedBody
 
 	mockParams
 }
@@ -166,7 +173,17 @@ func (suite *testSuite) TestService_missingInput_asJSON() {
 		statusCode:   http.StatusUnprocessableEntity,
 		mockParams:   mockParams{true, mockLog},
 		expectedMIME: mimeTypeJSON,
-		expectedBody: `{"args":["-cd","-silent","-pv-","-pvc-","-pdfxe","input.tex"],"category":"compilation","cmd":"latexmk","error":"compilation failed"}`,
+		expectedBody: `{"args":["-cd","-silent","-pv-","-pvc-","-pdfxe","input.tex"],"category":"compilation","cmd":"latexmk","error":"compilation failed","unresolved":[{"command":"input","target":"missing.tex","file":"input.tex","line":3}]}`,
+	})
+}
+
+func (suite *testSuite) TestService_missingInput_diagnosed() {
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/missing", nil),
+		statusCode:   http.StatusUnprocessableEntity,
+		mockParams:   mockParams{true, "! LaTeX Error: File `missing.tex' not found.\n\nl.3 \\input{missing.tex}\n"},
+		expectedMIME: mimeTypeJSON,
+		expectedBody: `{"args":["-cd","-silent","-pv-","-pvc-","-pdfxe","input.tex"],"category":"compilation","cmd":"latexmk","code":"missing_file","error":"compilation failed","file":"missing.tex","hint":"The file missing.tex is missing. Check its name (which is case sensitive), and make sure it was uploaded.","line":3,"unresolved":[{"command":"input","target":"missing.tex","file":"input.tex","line":3}]}`,
 	})
 }
 
@@ -199,7 +216,314 @@ func (suite *testSuite) TestService_missingInput_differentEngine() {
 		mockParams:   mockParams{true, mockLog},
 		query:        "engine=lualatex",
 		expectedMIME: mimeTypeJSON,
-		expectedBody: `{"args":["-cd","-silent","-pv-","-pvc-","-pdflua","input.tex"],"category":"compilation","cmd":"latexmk","error":"compilation failed"}`,
+		expectedBody: `{"args":["-cd","-silent","-pv-","-pvc-","-pdflua","input.tex"],"category":"compilation","cmd":"latexmk","error":"compilation failed","unresolved":[{"command":"input","target":"missing.tex","file":"input.tex","line":3}]}`,
+	})
+}
+
+func (suite *testSuite) TestService_missingInput_strict() {
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/missing", nil),
+		statusCode:   http.StatusUnprocessableEntity,
+		mockParams:   mockParams{true, mockLog},
+		query:        "strict=true&bib=none",
+		expectedMIME: mimeTypeJSON,
+		expectedBody: `{"args":["-cd","-silent","-pv-","-pvc-","-pdfxe","-bibtex-","-halt-on-error","input.tex"],"category":"compilation","cmd":"latexmk","error":"compilation failed","unresolved":[{"command":"input","target":"missing.tex","file":"input.tex","line":3}]}`,
+	})
+}
+
+func (suite *testSuite) TestService_missingInput_profile() {
+	suite.svc.profiles = []Profile{{Name: "strict", Params: url.Values{"strict": {"true"}}}}
+	defer func() { suite.svc.profiles = nil }()
+
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/missing", nil),
+		statusCode:   http.StatusUnprocessableEntity,
+		mockParams:   mockParams{true, mockLog},
+		query:        "profile=strict&engine=lualatex",
+		expectedMIME: mimeTypeJSON,
+		expectedBody: `{"args":["-cd","-silent","-pv-","-pvc-","-pdflua","-halt-on-error","input.tex"],"category":"compilation","cmd":"latexmk","error":"compilation failed","unresolved":[{"command":"input","target":"missing.tex","file":"input.tex","line":3}]}`,
+	})
+}
+
+func (suite *testSuite) TestService_formatPNG() {
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/simple", nil),
+		statusCode:   http.StatusOK,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "format=png&dpi=72&pages=1",
+		expectedMIME: "image/png",
+		expectedBody: mockPDF,
+	})
+}
+
+func (suite *testSuite) TestService_postProcess() {
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/simple", nil),
+		statusCode:   http.StatusOK,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "postprocess=pdfa,linearize",
+		expectedMIME: mimeTypePDF,
+		expectedBody: mockPDF,
+	})
+}
+
+func (suite *testSuite) TestService_invalidPostProcess() {
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/simple", nil),
+		statusCode:   http.StatusUnprocessableEntity,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "format=png&postprocess=compress",
+		expectedMIME: mimeTypeJSON,
+		expectedBody: `{"category":"input","error":"invalid post-processing","postprocess":"compress"}`,
+	})
+}
+
+func (suite *testSuite) TestService_reproducible() {
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/simple", nil),
+		statusCode:   http.StatusOK,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "reproducible=1700000000",
+		expectedMIME: mimeTypePDF,
+		expectedBody: mockPDF,
+	})
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/simple", nil),
+		statusCode:   http.StatusUnprocessableEntity,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "reproducible=yesterday",
+		expectedMIME: mimeTypeJSON,
+		expectedBody: `{"category":"input","error":"invalid reproducible option","reproducible":"yesterday"}`,
+	})
+	suite.runServiceTestCase(serviceTestCase{
+		files: withField(addDirectory("../testdata/simple", nil), encryptionField,
+			`{"user_password":"1990-01-31"}`),
+		statusCode:   http.StatusUnprocessableEntity,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "reproducible=true",
+		expectedMIME: mimeTypeJSON,
+		expectedBody: `{"category":"input","error":"invalid encryption settings","part":1}`,
+	})
+}
+
+func (suite *testSuite) TestService_env() {
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/simple", nil),
+		statusCode:   http.StatusOK,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "env=TZ%3DEurope/Berlin&env=LANG%3Dde_DE.UTF-8",
+		expectedMIME: mimeTypePDF,
+		expectedBody: mockPDF,
+	})
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/simple", nil),
+		statusCode:   http.StatusUnprocessableEntity,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "env=PATH%3D/tmp",
+		expectedMIME: mimeTypeJSON,
+		expectedBody: `{"category":"input","env":["PATH=/tmp"],"error":"invalid environment variable"}`,
+	})
+}
+
+func (suite *testSuite) TestService_artifacts() {
+	suite.runServiceTestCase(serviceTestCase{
+		files:        withField(addDirectory("../testdata/simple", nil), "input.bbl", `\begin{thebibliography}{}`),
+		statusCode:   http.StatusOK,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "artifacts=log,bbl",
+		expectedMIME: mimeTypeZIP,
+		checkBody: func(body []byte) {
+			zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+			suite.Require().NoError(err)
+			contents := make(map[string]string)
+			for _, f := range zr.File {
+				r, err := f.Open()
+				suite.Require().NoError(err)
+				b, err := io.ReadAll(r)
+				suite.Require().NoError(err)
+				contents[f.Name] = string(b)
+			}
+			suite.Assert().Equal(map[string]string{
+				"input.pdf": mockPDF,
+				"input.bbl": `\begin{thebibliography}{}`,
+			}, contents) // no log file on success
+		},
+	})
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/simple", nil),
+		statusCode:   http.StatusUnprocessableEntity,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "artifacts=tex",
+		expectedMIME: mimeTypeJSON,
+		expectedBody: `{"artifacts":"tex","category":"input","error":"invalid artifacts"}`,
+	})
+}
+
+func (suite *testSuite) TestService_progress() {
+	var resultURL string
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/simple", nil),
+		statusCode:   http.StatusOK,
+		mockParams:   mockParams{false, mockPDF},
+		accept:       mimeTypeEventStream,
+		expectedMIME: mimeTypeEventStream,
+		checkBody: func(body []byte) {
+			events := strings.Split(strings.TrimSpace(string(body)), "\n\n")
+			suite.Require().Len(events, 3)
+			suite.Assert().Regexp(`^event: queue\ndata: \{"position":\d+,"length":\d+,"capacity":\d+\}$`, events[0])
+			suite.Assert().Equal("event: start\ndata: {}", events[1])
+			m := regexp.MustCompile(`^event: result\ndata: \{"url":"(/jobs/[0-9A-Z]+/result)","status":200\}$`).FindStringSubmatch(events[2])
+			suite.Require().NotNil(m, events[2])
+			resultURL = m[1]
+		},
+	})
+
+	res, err := http.Get("http://" + suite.svc.addr + resultURL)
+	suite.Require().NoError(err)
+	body, err := io.ReadAll(res.Body)
+	suite.Require().NoError(err)
+	suite.Require().NoError(res.Body.Close())
+	suite.Assert().Equal(http.StatusOK, res.StatusCode)
+	suite.Assert().Equal(mimeTypePDF, res.Header.Get("Content-Type"))
+	suite.Assert().Equal(mockPDF, string(body))
+
+	// results can be fetched only once
+	res, err = http.Get("http://" + suite.svc.addr + resultURL)
+	suite.Require().NoError(err)
+	suite.Require().NoError(res.Body.Close())
+	suite.Assert().Equal(http.StatusUnprocessableEntity, res.StatusCode)
+
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/simple", nil),
+		statusCode:   http.StatusOK,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "engine=foo",
+		accept:       mimeTypeEventStream,
+		expectedMIME: mimeTypeEventStream,
+		expectedBody: "event: error\ndata: {\"category\":\"input\",\"error\":\"unknown engine\"}",
+	})
+}
+
+// withField appends a form field to the files.
+func withField(files func(*multipart.Writer) error, name, value string) func(*multipart.Writer) error {
+	return func(w *multipart.Writer) error {
+		if err := files(w); err != nil {
+			return err
+		}
+		return w.WriteField(name, value)
+	}
+}
+
+func (suite *testSuite) TestService_encryption() {
+	suite.runServiceTestCase(serviceTestCase{
+		files: withField(addDirectory("../testdata/simple", nil), encryptionField,
+			`{"user_password":"1990-01-31","permissions":["print"]}`),
+		statusCode:   http.StatusOK,
+		mockParams:   mockParams{false, mockPDF},
+		expectedMIME: mimeTypePDF,
+		expectedBody: mockPDF,
+	})
+}
+
+func (suite *testSuite) TestService_encryption_invalid() {
+	suite.runServiceTestCase(serviceTestCase{
+		files: withField(addDirectory("../testdata/simple", nil), encryptionField,
+			`{"user_password":"1990-01-31",}`),
+		statusCode:   http.StatusUnprocessableEntity,
+		mockParams:   mockParams{false, mockPDF},
+		expectedMIME: mimeTypeJSON,
+		expectedBody: `{"category":"input","error":"malformed encryption settings","part":1}`,
+	})
+	suite.runServiceTestCase(serviceTestCase{
+		files: withField(addDirectory("../testdata/simple", nil), encryptionField,
+			`{"user_password":"1990-01-31"}`),
+		statusCode:   http.StatusUnprocessableEntity,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "format=png",
+		expectedMIME: mimeTypeJSON,
+		expectedBody: `{"category":"input","error":"invalid encryption settings","part":1}`,
+	})
+	suite.runServiceTestCase(serviceTestCase{
+		files: withField(addDirectory("../testdata/simple", nil), encryptionField,
+			`{"user_password":"1990-01-31"}`),
+		statusCode:   http.StatusUnprocessableEntity,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "postprocess=pdfa",
+		expectedMIME: mimeTypeJSON,
+		expectedBody: `{"category":"input","error":"invalid encryption settings","part":1}`,
+	})
+}
+
+func (suite *testSuite) TestService_sign() {
+	suite.svc.signingKeys = []tex.SigningKey{{Name: "contracts", Cert: "cert", Key: "key"}}
+	defer func() { suite.svc.signingKeys = nil }()
+
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/simple", nil),
+		statusCode:   http.StatusOK,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "sign=contracts&sign-box=1/50,50,250,100",
+		expectedMIME: mimeTypePDF,
+		expectedBody: mockPDF,
+	})
+	suite.runServiceTestCase(serviceTestCase{
+		files: withField(addDirectory("../testdata/simple", nil), encryptionField,
+			`{"user_password":"1990-01-31"}`),
+		statusCode:   http.StatusUnprocessableEntity,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "sign=contracts",
+		expectedMIME: mimeTypeJSON,
+		expectedBody: `{"category":"input","error":"invalid encryption settings","part":1}`,
+	})
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/simple", nil),
+		statusCode:   http.StatusUnprocessableEntity,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "sign=invoices",
+		expectedMIME: mimeTypeJSON,
+		expectedBody: `{"category":"input","error":"unknown signing key","sign":"invoices"}`,
+	})
+}
+
+func (suite *testSuite) TestService_metadata() {
+	suite.runServiceTestCase(serviceTestCase{
+		files: withField(addDirectory("../testdata/simple", nil), xmpField,
+			`<x:xmpmeta xmlns:x="adobe:ns:meta/"/>`),
+		statusCode:   http.StatusOK,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "meta-title=Rechnung&meta-author=ACME",
+		expectedMIME: mimeTypePDF,
+		expectedBody: mockPDF,
+	})
+}
+
+func (suite *testSuite) TestService_merge() {
+	suite.runServiceTestCase(serviceTestCase{
+		files:        withField(addDirectory("../testdata/simple", nil), "terms.pdf", mockPDF),
+		statusCode:   http.StatusOK,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "append=terms.pdf",
+		expectedMIME: mimeTypePDF,
+		expectedBody: mockPDF,
+	})
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/simple", nil),
+		statusCode:   http.StatusUnprocessableEntity,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "prepend=cover.pdf",
+		expectedMIME: mimeTypeJSON,
+		expectedBody: `{"category":"input","error":"unknown merge file","file":"cover.pdf"}`,
+	})
+}
+
+func (suite *testSuite) TestService_invalidFormat() {
+	suite.runServiceTestCase(serviceTestCase{
+		files:        addDirectory("../testdata/simple", nil),
+		statusCode:   http.StatusUnprocessableEntity,
+		mockParams:   mockParams{false, mockPDF},
+		query:        "format=docx",
+		expectedMIME: mimeTypeJSON,
+		expectedBody: `{"category":"input","error":"invalid output format"}`,
 	})
 }
 
@@ -299,6 +623,9 @@ func (suite *testSuite) runServiceTestCase(testCase serviceTestCase) {
 	require.NoError(err)
 
 	req.Header.Set("Content-Type", w.FormDataContentType())
+	if testCase.accept != "" {
+		req.Header.Set("Accept", testCase.accept)
+	}
 	res, err := http.DefaultClient.Do(req)
 	require.NoError(err)
 
@@ -310,6 +637,10 @@ func (suite *testSuite) runServiceTestCase(testCase serviceTestCase) {
 	if !assert.Equal(testCase.statusCode, res.StatusCode) {
 		suite.logger.Error("unexpected result", xlog.String("body", string(body)))
 	}
+	if testCase.checkBody != nil {
+		testCase.checkBody(body)
+		return
+	}
 	assert.EqualValues(
 		strings.TrimSpace(testCase.expectedBody),
 		strings.TrimSpace(string(body)))
@@ -400,3 +731,196 @@ func createFormField(w *multipart.Writer, name string, ref refAction) (io.Writer
 	}
 	return w.CreatePart(h)
 }
+
+func TestValidateEngineParam(t *testing.T) {
+	t.Parallel()
+
+	svc := &service{
+		mode:         "container",
+		images:       []string{"texlive", "texlive-lua"},
+		imageEngines: map[string][]string{"texlive-lua": {"lualatex"}},
+	}
+
+	for _, tc := range []struct {
+		name, image, expected, err string
+	}{
+		{"", "texlive", "xelatex", ""},
+		{"pdflatex", "texlive", "pdflatex", ""},
+		{"", "texlive-lua", "lualatex", ""},
+		{"lualatex", "texlive-lua", "lualatex", ""},
+		{"xelatex", "texlive-lua", "", "engine not available in image"},
+		{"dings", "texlive", "", "unknown engine: unsupported TeX engine: \"dings\""},
+	} {
+		engine, err := svc.validateEngineParam(tc.name, tc.image)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, engine.Name())
+	}
+}
+
+type magicDocument struct {
+	tex.Document // nil, only the methods below are used
+	engine       tex.Engine
+	magic        tex.MagicComments
+	output       tex.Output
+}
+
+func (doc *magicDocument) Engine() tex.Engine               { return doc.engine }
+func (doc *magicDocument) SetEngine(engine tex.Engine)      { doc.engine = engine }
+func (doc *magicDocument) Image() string                    { return "texlive-lua" }
+func (doc *magicDocument) Output() tex.Output               { return doc.output }
+func (doc *magicDocument) MainInput() (string, error)       { return "main.tex", nil }
+func (doc *magicDocument) MagicComments() tex.MagicComments { return doc.magic }
+func (doc *magicDocument) Environ() []string                { return nil }
+
+const (
+	biberConfig = `$bibtex_use = 2; $biber = 'biber %O %S';` +
+		` $bibtex = 'internal texd_skip %B'; sub texd_skip { return 0; }`
+	makeindexConfig = `add_cus_dep('idx', 'ind', 0, 'texd_makeindex');` +
+		` sub texd_makeindex { return system('makeindex', '-o', "$_[0].ind", '-t', "$_[0].ilg", "$_[0].idx"); }` +
+		` push @generated_exts, 'idx', 'ind', 'ilg';`
+)
+
+func TestApplyMagicComments(t *testing.T) {
+	t.Parallel()
+
+	svc := &service{
+		mode:         "container",
+		images:       []string{"texlive-lua"},
+		imageEngines: map[string][]string{"texlive-lua": {"lualatex", "pdflatex"}},
+	}
+	pdflatex, err := tex.ParseEngine("pdflatex")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		query  string
+		magic  tex.MagicComments
+		output tex.Output
+		engine string
+		flags  []string
+		err    string
+	}{
+		{
+			name:   "no magic",
+			engine: "pdflatex",
+			flags:  []string{"-pdf"},
+		}, {
+			name:   "synctex artifact",
+			output: tex.Output{Artifacts: []string{"synctex", "log"}},
+			engine: "pdflatex",
+			flags:  []string{"-pdf", "-synctex=1"},
+		}, {
+			name:  "invalid magic strictness",
+			magic: tex.MagicComments{"strict": "yes"},
+			err:   "invalid strictness: invalid strictness value: \"yes\"",
+		}, {
+			name:   "magic engine and options",
+			magic:  tex.MagicComments{"engine": "lualatex", "bib": "none", "strict": "true"},
+			engine: "lualatex",
+			flags:  []string{"-pdflua", "-bibtex-", "-halt-on-error"},
+		}, {
+			name:   "request overrides magic",
+			query:  "engine=pdflatex&strict=false&bib=biber",
+			magic:  tex.MagicComments{"engine": "lualatex", "bib": "none", "strict": "true"},
+			engine: "pdflatex",
+			flags:  []string{"-pdf", "-e", biberConfig},
+		}, {
+			name:   "tools",
+			query:  "tools=makeindex",
+			magic:  tex.MagicComments{"bib": "none"},
+			engine: "pdflatex",
+			flags:  []string{"-pdf", "-bibtex-", "-e", makeindexConfig},
+		}, {
+			name:  "conflicting tools",
+			query: "tools=biber",
+			magic: tex.MagicComments{"bib": "none"},
+			err:   `unsupported options: conflicting options: bib=none and tool "biber"`,
+		}, {
+			name:  "unknown tool",
+			query: "tools=perl",
+			err:   `invalid tools: unsupported tool: "perl"`,
+		}, {
+			name:  "magic engine restricted by image",
+			magic: tex.MagicComments{"engine": "xelatex"},
+			err:   "engine not available in image",
+		}, {
+			name:  "invalid bib tool",
+			query: "bib=makeindex",
+			err:   "invalid bibliography tool: unsupported bibliography tool: \"makeindex\"",
+		}, {
+			name:   "html output",
+			magic:  tex.MagicComments{"engine": "lualatex"},
+			output: tex.Output{Format: tex.FormatHTML},
+			engine: "lualatex",
+			flags:  []string{"-l"},
+		}, {
+			name:   "html output with tools",
+			query:  "tools=makeindex",
+			output: tex.Output{Format: tex.FormatHTML},
+			err:    `unsupported options: tool "makeindex" is not supported by make4ht`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			params, err := url.ParseQuery(tc.query)
+			require.NoError(t, err)
+
+			doc := &magicDocument{engine: pdflatex, magic: tc.magic, output: tc.output}
+			err = svc.applyMagicComments(xlog.NewDiscard(), doc, params)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.engine, doc.engine.Name())
+			assert.Equal(t, tc.flags, doc.engine.Flags()[len(doc.engine.Flags())-len(tc.flags):])
+		})
+	}
+}
+
+func TestApplyMagicComments_disallowedTool(t *testing.T) {
+	require.NoError(t, tex.SetAllowedTools([]string{"makeindex"}))
+	t.Cleanup(func() { require.NoError(t, tex.SetAllowedTools(tex.SupportedTools())) })
+
+	svc := &service{mode: "local"}
+	pdflatex, err := tex.ParseEngine("pdflatex")
+	require.NoError(t, err)
+
+	// magic comments naming a disallowed tool are ignored
+	doc := &magicDocument{engine: pdflatex, magic: tex.MagicComments{"bib": "biber"}}
+	require.NoError(t, svc.applyMagicComments(xlog.NewDiscard(), doc, url.Values{}))
+	assert.Equal(t, []string{"-pdf"}, doc.engine.Flags()[len(doc.engine.Flags())-1:])
+	assert.NotContains(t, doc.engine.Flags(), "-e")
+
+	// request parameters are still rejected
+	doc = &magicDocument{engine: pdflatex}
+	err = svc.applyMagicComments(xlog.NewDiscard(), doc, url.Values{"bib": {"biber"}})
+	assert.EqualError(t, err, `unsupported options: unsupported tool: "biber"`)
+}
+
+func TestWriteZIP(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	n, err := writeZIP(&buf, []tex.ResultFile{
+		{Name: "page-1.png", ReadCloser: io.NopCloser(strings.NewReader("one"))},
+		{Name: "page-2.png", ReadCloser: io.NopCloser(strings.NewReader("two"))},
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, buf.Len(), n)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), n)
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+	for i, expected := range []string{"one", "two"} {
+		assert.Equal(t, fmt.Sprintf("page-%d.png", i+1), zr.File[i].Name)
+		f, err := zr.File[i].Open()
+		require.NoError(t, err)
+		contents, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(contents))
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+)
+
+// validateSigningKeys ensures key names are unique, and warns about
+// expired certificates.
+func (svc *service) validateSigningKeys() error {
+	seen := make(map[string]bool, len(svc.signingKeys))
+	for _, key := range svc.signingKeys {
+		if seen[key.Name] {
+			return fmt.Errorf("duplicate signing key %q", key.Name)
+		}
+		seen[key.Name] = true
+		if !key.NotAfter.IsZero() && key.NotAfter.Before(time.Now()) {
+			svc.Logger().Warn("signing certificate has expired",
+				xlog.String("key", key.Name),
+				xlog.Any("not-after", key.NotAfter))
+		}
+	}
+	return nil
+}
+
+func (svc *service) findSigningKey(name string) (tex.SigningKey, bool) {
+	i := slices.IndexFunc(svc.signingKeys, func(k tex.SigningKey) bool { return k.Name == name })
+	if i < 0 {
+		return tex.SigningKey{}, false
+	}
+	return svc.signingKeys[i], true
+}
+
+// applySignature configures output to be signed with the key selected by
+// the sign= parameter. The sign-box= parameter places a visible signature
+// field.
+func (svc *service) applySignature(output tex.Output, params url.Values) (tex.Output, error) {
+	name, box := params.Get("sign"), params.Get("sign-box")
+	if name == "" {
+		if box != "" {
+			return output, tex.InputError("signature box without signing key", nil, tex.KV{"sign-box": box})
+		}
+		return output, nil
+	}
+	key, ok := svc.findSigningKey(name)
+	if !ok {
+		return output, tex.InputError("unknown signing key", nil, tex.KV{"sign": name})
+	}
+	output, err := output.WithSignature(key, box)
+	if err != nil {
+		return output, tex.InputError("invalid signature", err, tex.KV{"sign": name, "sign-box": box})
+	}
+	return output, nil
+}
+
+// signingKeyNames lists the names of the configured signing keys.
+func (svc *service) signingKeyNames() (names []string) {
+	for _, key := range svc.signingKeys {
+		names = append(names, key.Name)
+	}
+	return names
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/digineo/texd/tex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplySignature(t *testing.T) {
+	t.Parallel()
+
+	key := tex.SigningKey{Name: "contracts", Cert: "cert", Key: "key"}
+	svc := &service{signingKeys: []tex.SigningKey{key}}
+	require.NoError(t, svc.validateSigningKeys())
+	assert.Equal(t, []string{"contracts"}, svc.signingKeyNames())
+
+	output, err := svc.applySignature(tex.Output{}, url.Values{})
+	require.NoError(t, err)
+	assert.Nil(t, output.Signature)
+
+	output, err = svc.applySignature(tex.Output{}, url.Values{"sign": {"contracts"}, "sign-box": {"1/0,0,100,50"}})
+	require.NoError(t, err)
+	assert.Equal(t, &tex.Signature{Key: key, Box: "1/0,0,100,50"}, output.Signature)
+
+	for query, msg := range map[string]string{
+		"sign-box=1/0,0,100,50":           "signature box without signing key",
+		"sign=invoices":                   "unknown signing key",
+		"sign=contracts&sign-box=p1":      `invalid signature: invalid signature box "p1": expected PAGE/X1,Y1,X2,Y2`,
+		"sign=contracts&format=svg":       "",
+		"sign=contracts&sign-box=1/0,0,0": `invalid signature: invalid signature box "1/0,0,0": expected PAGE/X1,Y1,X2,Y2`,
+	} {
+		params, err := url.ParseQuery(query)
+		require.NoError(t, err)
+		_, err = svc.applySignature(tex.Output{}, params)
+		if msg == "" {
+			assert.NoError(t, err, query)
+		} else {
+			assert.EqualError(t, err, msg, query)
+		}
+	}
+
+	_, err = svc.applySignature(tex.Output{Format: tex.FormatSVG}, url.Values{"sign": {"contracts"}})
+	assert.EqualError(t, err, `invalid signature: signing is not supported for format "svg"`)
+
+	svc.signingKeys = append(svc.signingKeys, key)
+	assert.EqualError(t, svc.validateSigningKeys(), `duplicate signing key "contracts"`)
+}
@@ -18,11 +18,26 @@ type Status struct {
 	Engines       []string    `json:"engines"`
 	DefaultEngine string      `json:"default_engine"`
 	Queue         queueStatus `json:"queue"`
-}
 
-type queueStatus struct {
-	Length   int `json:"length"`
-	Capacity int `json:"capacity"`
+	// Tools lists the auxiliary tools clients may enable.
+	Tools []string `json:"tools,omitempty"`
+
+	// Env lists the environment variables clients may set.
+	Env []string `json:"env,omitempty"`
+
+	// SigningKeys lists the names of keys clients may sign documents with.
+	SigningKeys []string `json:"signing_keys,omitempty"`
+
+	// Profiles lists the parameters of each server-defined profile.
+	Profiles map[string]map[string]string `json:"profiles,omitempty"`
+
+	// ImageEngines lists the available engines for images with engine
+	// restrictions. Images not listed here support all engines.
+	ImageEngines map[string][]string `json:"image_engines,omitempty"`
+
+	// Distributions describes the TeX distribution of each image ("local"
+	// in local mode), as determined at startup.
+	Distributions map[string]tex.DistributionInfo `json:"distributions,omitempty"`
 }
 
 func (svc *service) HandleStatus(res http.ResponseWriter, req *http.Request) {
@@ -37,6 +52,12 @@ func (svc *service) HandleStatus(res http.ResponseWriter, req *http.Request) {
 			Length:   len(svc.jobs),
 			Capacity: cap(svc.jobs),
 		},
+		Tools:         tex.AllowedTools(),
+		Env:           tex.AllowedEnvVars(),
+		SigningKeys:   svc.signingKeyNames(),
+		Profiles:      svc.profileStatus(),
+		ImageEngines:  svc.imageEngines,
+		Distributions: svc.distributionStatus(),
 	}
 
 	res.Header().Set("Content-Type", mimeTypeJSON)
@@ -48,3 +69,8 @@ func (svc *service) HandleStatus(res http.ResponseWriter, req *http.Request) {
 			xlog.Error(err))
 	}
 }
+
+type queueStatus struct {
+	Length   int `json:"length"`
+	Capacity int `json:"capacity"`
+}
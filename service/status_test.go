@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/digineo/texd/tex"
 	"github.com/digineo/xlog"
 	"github.com/digineo/xlog/slogor"
 	"github.com/stretchr/testify/assert"
@@ -30,7 +31,10 @@ func TestHandleStatus(t *testing.T) {
 		mode:           "local",
 		compileTimeout: 3 * time.Second,
 		jobs:           make(chan struct{}, 2),
-		log:            xlog.NewDiscard(),
+		distributions: map[string]tex.DistributionInfo{
+			"": {TeXLive: "2023", Versions: map[string]string{"latexmk": "4.79"}},
+		},
+		log: xlog.NewDiscard(),
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/status", nil)
@@ -56,9 +60,34 @@ func TestHandleStatus(t *testing.T) {
 			Length:   0,
 			Capacity: 2,
 		},
+		Tools: []string{"biber", "bibtex", "makeindex", "makeglossaries"},
+		Env:   tex.SupportedEnvVars(),
+		Distributions: map[string]tex.DistributionInfo{
+			"local": {TeXLive: "2023", Versions: map[string]string{"latexmk": "4.79"}},
+		},
 	}, status)
 }
 
+func TestHandleStatus_imageEngines(t *testing.T) {
+	svc := &service{
+		mode:           "container",
+		images:         []string{"texlive:2024", "texlive-ja:2024"},
+		imageEngines:   map[string][]string{"texlive-ja:2024": {"uplatex"}},
+		compileTimeout: 3 * time.Second,
+		jobs:           make(chan struct{}, 2),
+		log:            xlog.NewDiscard(),
+	}
+
+	rec := httptest.NewRecorder()
+	svc.HandleStatus(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var status Status
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&status))
+	assert.Equal(t, []string{"texlive:2024", "texlive-ja:2024"}, status.Images)
+	assert.Equal(t, map[string][]string{"texlive-ja:2024": {"uplatex"}}, status.ImageEngines)
+}
+
 func TestHandleStatus_withFailIO(t *testing.T) {
 	var buf bytes.Buffer
 	log, err := xlog.New(
@@ -87,7 +116,7 @@ func TestHandleStatus_withFailIO(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rec.code)
 	assert.Equal(t, mimeTypeJSON, rec.h.Get("Content-Type"))
 	assert.Equal(t, strings.Join([]string{
-		"[05:20:00.000] ERROR service/status.go:46",
+		"[05:20:00.000] ERROR service/status.go:67",
 		"failed to write response",
 		`error="io: read/write on closed pipe"`,
 	}, " ")+"\n", buf.String())
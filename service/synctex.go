@@ -0,0 +1,105 @@
+package service
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/digineo/texd/service/middleware"
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+	"github.com/gorilla/mux"
+)
+
+// syncTeXForward is the response of a forward search.
+type syncTeXForward struct {
+	File  string           `json:"file"`
+	Line  int              `json:"line"` // may differ from the requested line
+	Boxes []tex.SyncTeXBox `json:"boxes"`
+}
+
+// HandleSyncTeX answers SyncTeX lookups for retained jobs (see
+// --keep-jobs), which were compiled with artifacts=synctex. Forward
+// searches map a file and line to positions in the PDF document,
+// reverse searches map a position to a file and line.
+func (svc *service) HandleSyncTeX(res http.ResponseWriter, req *http.Request) {
+	log := svc.Logger().With(middleware.RequestIDField(req.Context()))
+	result, err := svc.syncTeX(req)
+	if err != nil {
+		errorResponse(log, res, err)
+		return
+	}
+
+	res.Header().Set("Content-Type", mimeTypeJSON)
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	res.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(res).Encode(result); err != nil {
+		log.Error("failed to write response", xlog.Error(err))
+	}
+}
+
+func (svc *service) syncTeX(req *http.Request) (any, error) {
+	if svc.keepJobs == KeepJobsNever {
+		return nil, tex.InputError("jobs are not retained", nil, nil)
+	}
+	vars := mux.Vars(req)
+	s, err := tex.LoadSyncTeX(vars["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	params := req.URL.Query()
+	switch vars["direction"] {
+	case "forward":
+		file := params.Get("file")
+		line, err := intParam(params, "line")
+		if err != nil {
+			return nil, err
+		}
+		actual, boxes, err := s.Forward(file, line)
+		if err != nil {
+			return nil, tex.InputError("forward search failed", err, tex.KV{"file": file, "line": line})
+		}
+		return syncTeXForward{File: file, Line: actual, Boxes: boxes}, nil
+
+	case "reverse":
+		page, err := intParam(params, "page")
+		if err != nil {
+			return nil, err
+		}
+		x, err := coordParam(params, "x")
+		if err != nil {
+			return nil, err
+		}
+		y, err := coordParam(params, "y")
+		if err != nil {
+			return nil, err
+		}
+		pos, err := s.Reverse(page, x, y)
+		if err != nil {
+			return nil, tex.InputError("reverse search failed", err, tex.KV{"page": page})
+		}
+		return pos, nil
+	}
+	panic("not reached") // see route definition
+}
+
+// intParam parses a positive integer parameter (e.g. a line number).
+func intParam(params url.Values, name string) (int, error) {
+	n, err := strconv.Atoi(params.Get(name))
+	if err != nil || n <= 0 {
+		return 0, tex.InputError("invalid "+name, nil, tex.KV{name: params.Get(name)})
+	}
+	return n, nil
+}
+
+// coordParam parses a non-negative coordinate parameter (in PDF points).
+func coordParam(params url.Values, name string) (float64, error) {
+	n, err := strconv.ParseFloat(params.Get(name), 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, tex.InputError("invalid "+name, nil, tex.KV{name: params.Get(name)})
+	}
+	return n, nil
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSyncTeX = `SyncTeX Version:1
+Input:1:/texd/job/./main.tex
+Output:pdf
+Magnification:1000
+Unit:1
+X Offset:0
+Y Offset:0
+Content:
+{1
+(1,3:4736286,10000000:30785863,655360,0
+)
+}1
+Postamble:
+`
+
+func TestHandleSyncTeX(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, tex.SetJobBaseDir(dir))
+	t.Cleanup(func() { _ = tex.SetJobBaseDir("") })
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "01JOB"), 0o700))
+	f, err := os.Create(filepath.Join(dir, "01JOB", "main.synctex.gz"))
+	require.NoError(t, err)
+	zw := gzip.NewWriter(f)
+	_, err = zw.Write([]byte(testSyncTeX))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+
+	svc := &service{keepJobs: KeepJobsAlways, log: xlog.NewDiscard()}
+	routes := svc.routes()
+	get := func(uri string) (int, string) {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, uri, nil))
+		res := rec.Result()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, mimeTypeJSON, res.Header.Get("Content-Type"))
+		return res.StatusCode, strings.TrimSpace(string(body))
+	}
+
+	code, body := get("/jobs/01JOB/synctex/forward?file=main.tex&line=3")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"file":"main.tex","line":3,"boxes":[{"page":1,"x":72,"y":142.06,"width":468,"height":9.96}]}`, body)
+
+	code, body = get("/jobs/01JOB/synctex/reverse?page=1&x=100&y=145")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"file":"main.tex","line":3}`, body)
+
+	for uri, expected := range map[string]string{
+		"/jobs/01JOB/synctex/forward?file=main.tex&line=0":  `{"category":"input","error":"invalid line","line":"0"}`,
+		"/jobs/01JOB/synctex/forward?file=other.tex&line=1": `{"category":"input","error":"forward search failed","file":"other.tex","line":1}`,
+		"/jobs/01JOB/synctex/reverse?page=1&x=1&y=NaN":      `{"category":"input","error":"invalid y","y":"NaN"}`,
+		"/jobs/01JOB/synctex/reverse?page=2&x=1&y=1":        `{"category":"input","error":"reverse search failed","page":2}`,
+		"/jobs/01XYZ/synctex/forward?file=main.tex&line=1":  `{"category":"input","error":"unknown job","job":"01XYZ"}`,
+	} {
+		code, body := get(uri)
+		assert.Equal(t, http.StatusUnprocessableEntity, code, uri)
+		assert.Equal(t, expected, body, uri)
+	}
+
+	svc.keepJobs = KeepJobsNever
+	code, body = get("/jobs/01JOB/synctex/forward?file=main.tex&line=3")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, `{"category":"input","error":"jobs are not retained"}`, body)
+}
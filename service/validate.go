@@ -0,0 +1,140 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/digineo/texd/service/middleware"
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+)
+
+// validationReport is the response of HandleValidate.
+type validationReport struct {
+	Valid    bool   `json:"valid"`
+	Input    string `json:"input,omitempty"`
+	Engine   string `json:"engine,omitempty"`
+	Image    string `json:"image,omitempty"`
+	Problems []any  `json:"problems"`
+
+	// Warnings list likely problems, e.g. unresolved file references,
+	// which might still be provided by the TeX distribution. They don't
+	// affect Valid.
+	Warnings []any `json:"warnings,omitempty"`
+}
+
+func (r *validationReport) add(err error) {
+	r.Problems = append(r.Problems, errorBody(err))
+}
+
+func (r *validationReport) warn(err error) {
+	r.Warnings = append(r.Warnings, errorBody(err))
+}
+
+// HandleValidate performs all checks of HandleRender, which happen
+// before the document is compiled, without waiting for a queue slot. It
+// always responds with a validationReport, listing the problems found.
+func (svc *service) HandleValidate(res http.ResponseWriter, req *http.Request) {
+	log := svc.Logger().With(middleware.RequestIDField(req.Context()))
+	report := svc.validate(log, req)
+	report.Valid = len(report.Problems) == 0
+	if report.Problems == nil {
+		report.Problems = []any{}
+	}
+
+	res.Header().Set("Content-Type", mimeTypeJSON)
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	res.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(res).Encode(report); err != nil {
+		log.Error("failed to write response", xlog.Error(err))
+	}
+}
+
+func (svc *service) validate(log xlog.Logger, req *http.Request) *validationReport {
+	report := &validationReport{}
+	params, err := svc.applyProfile(req.Context(), req.URL.Query())
+	if err != nil {
+		report.add(err)
+		return report
+	}
+	opts, err := svc.parseJobOptions(params)
+	if err != nil {
+		report.add(err)
+		return report
+	}
+	report.Image = opts.image
+
+	doc := tex.NewDocument(log, opts.engine, opts.image)
+	doc.SetOutput(opts.output)
+	doc.SetEnv(opts.env)
+	defer func() {
+		if err := doc.Cleanup(); err != nil {
+			log.Error("cleanup failed", xlog.Error(err))
+		}
+	}()
+
+	if err := svc.validateFiles(log, doc, req, report); err != nil {
+		report.add(err)
+		return report // the request body is unusable
+	}
+
+	if err := svc.prepare(log, doc, params); err != nil {
+		report.add(err)
+	} else {
+		report.Input, _ = doc.MainInput()
+		report.Engine = doc.Engine().Name()
+	}
+
+	missing, err := doc.MissingFiles()
+	if err != nil {
+		report.add(err)
+	}
+	for _, dep := range missing {
+		report.warn(tex.InputError("unknown file reference", nil, tex.KV{
+			"command": dep.Command,
+			"target":  dep.Target,
+			"file":    dep.File,
+			"line":    dep.Line,
+		}))
+	}
+	// unchecked packages; scan errors were already reported above
+	if unknown, _ := svc.unknownPackages(doc); svc.noPkgCheck && len(unknown) > 0 {
+		report.warn(unknownPackageError(doc, unknown))
+	}
+	return report
+}
+
+// validateFiles is the counterpart to addFiles. Instead of failing on
+// the first invalid file, it adds all problems to the report. It only
+// returns an error, if the request body can't be read.
+func (svc *service) validateFiles(log xlog.Logger, doc tex.Document, req *http.Request, report *validationReport) error {
+	mr, err := multipartReader(req)
+	if err != nil {
+		return err
+	}
+	var missingRefs []string
+	refErr := &errMissingReference{}
+	for i := 0; ; i++ {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return tex.InputError("failed to parse request", err, tex.KV{"part": i})
+		}
+		switch err = svc.addFileFromPart(log, doc, part, i); {
+		case errors.As(err, &refErr):
+			missingRefs = append(missingRefs, refErr.ref)
+		case err != nil:
+			report.add(err)
+		}
+	}
+
+	if len(missingRefs) > 0 {
+		sort.Strings(missingRefs)
+		report.add(tex.ReferenceError(missingRefs))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/digineo/texd/exec"
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleValidate(t *testing.T) {
+	require.NoError(t, tex.SetJobBaseDir(t.TempDir()))
+	t.Cleanup(func() { _ = tex.SetJobBaseDir("") })
+
+	svc := newService(Options{
+		QueueLength: 1,
+		Mode:        "local",
+		Executor:    exec.Mock(false, mockPDF),
+	}, xlog.NewDiscard())
+	routes := svc.routes()
+	validate := func(query string, files ...[2]string) string {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, file := range files {
+			name, contents := file[0], file[1]
+			h := make(map[string][]string)
+			h["Content-Disposition"] = []string{`form-data; name="` + name + `"; filename="` + name + `"`}
+			if strings.HasPrefix(contents, "ref:") {
+				h["Content-Type"] = []string{mimeTypeTexd + "; ref=use"}
+				contents = strings.TrimPrefix(contents, "ref:")
+			}
+			fw, err := mw.CreatePart(h)
+			require.NoError(t, err)
+			_, err = fw.Write([]byte(contents))
+			require.NoError(t, err)
+		}
+		require.NoError(t, mw.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/validate"+query, &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		res := rec.Result()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, mimeTypeJSON, res.Header.Get("Content-Type"))
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return strings.TrimSpace(string(body))
+	}
+
+	body := validate("?engine=lualatex",
+		[2]string{"main.tex", "\\documentclass{article}\n\\input{intro}"},
+		[2]string{"intro.tex", "hello"},
+	)
+	assert.Equal(t, `{"valid":true,"input":"main.tex","engine":"lualatex","problems":[]}`, body)
+
+	body = validate("?engine=foo")
+	assert.Equal(t, `{"valid":false,"problems":[{"category":"input","error":"unknown engine"}]}`, body)
+
+	body = validate("",
+		[2]string{"main.tex", "\\documentclass{article}\n\\includegraphics{logo}"},
+		[2]string{"../x.tex", "invalid"},
+		[2]string{"other.tex", "ref:sha256:p5w-x0VQUh2kXyYbbv1ubkc-oZ0z7aZYNjSKVVzaZuo="},
+	)
+	assert.Equal(t, `{"valid":false,"input":"main.tex","engine":"xelatex","problems":[`+
+		`{"category":"input","error":"invalid file name","filename":"../x.tex","part":1},`+
+		`{"category":"reference","error":"unknown file references","references":["sha256:p5w-x0VQUh2kXyYbbv1ubkc-oZ0z7aZYNjSKVVzaZuo="]}],"warnings":[`+
+		`{"category":"input","command":"includegraphics","error":"unknown file reference","file":"main.tex","line":2,"target":"logo"}]}`, body)
+
+	// warnings don't affect validity
+	body = validate("", [2]string{"main.tex", "\\documentclass{article}\n\\input{chapter}"})
+	assert.Equal(t, `{"valid":true,"input":"main.tex","engine":"xelatex","problems":[],"warnings":[`+
+		`{"category":"input","command":"input","error":"unknown file reference","file":"main.tex","line":2,"target":"chapter"}]}`, body)
+
+	body = validate("?input=missing.tex", [2]string{"main.tex", `\documentclass{article}`})
+	assert.Equal(t, `{"valid":false,"problems":[{"category":"input","error":"unknown input file name"}]}`, body)
+
+	svc.packages = map[string]*tex.PackageIndex{"": tex.ParsePackageIndex([]byte("graphicx.sty\n"))}
+	body = validate("", [2]string{"main.tex", `\documentclass{article}\usepackage{graphicx,fontspec}`})
+	assert.Equal(t, `{"valid":false,"problems":[`+
+		`{"category":"input","error":"unknown package","packages":["fontspec"]}]}`, body)
+
+	svc.noPkgCheck = true
+	body = validate("", [2]string{"main.tex", `\documentclass{article}\usepackage{graphicx,fontspec}`})
+	assert.Equal(t, `{"valid":true,"input":"main.tex","engine":"xelatex","problems":[],"warnings":[`+
+		`{"category":"input","error":"unknown package","packages":["fontspec"]}]}`, body)
+}
@@ -0,0 +1,400 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/digineo/texd/metrics"
+	"github.com/digineo/texd/service/middleware"
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+	"github.com/gorilla/mux"
+)
+
+// workspaces manages persistent workspaces (see tex.Workspace), which
+// clients update file by file, and compile repeatedly (e.g. for live
+// previews).
+type workspaces struct {
+	max   int           // maximum number of workspaces, <= 0 disables them
+	idle  time.Duration // idle time before a workspace expires, <= 0 disables expiry
+	quota int64         // maximum size of a workspace, <= 0 disables check
+
+	mu    sync.Mutex
+	items map[string]*workspace
+	done  chan struct{}
+}
+
+type workspace struct {
+	*tex.Workspace
+
+	busy     sync.Mutex // held while the workspace is in use
+	removed  bool       // guarded by busy
+	lastUsed time.Time  // guarded by workspaces.mu
+}
+
+// workspaceStatus is the response to workspace requests (except for
+// compilations).
+type workspaceStatus struct {
+	ID    string   `json:"id"`
+	Files []string `json:"files"`
+	Size  int64    `json:"size"` // including auxiliary files
+	Quota int64    `json:"quota,omitempty"`
+}
+
+func newWorkspaces(max int, idle time.Duration, quota int64) *workspaces {
+	return &workspaces{
+		max:   max,
+		idle:  idle,
+		quota: quota,
+		items: make(map[string]*workspace),
+		done:  make(chan struct{}),
+	}
+}
+
+func (reg *workspaces) create(log xlog.Logger, id string) (*workspace, error) {
+	if reg.max <= 0 {
+		return nil, tex.InputError("workspaces are disabled", nil, nil)
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if len(reg.items) >= reg.max {
+		return nil, tex.QueueError("too many workspaces, please try again later", nil, tex.KV{"limit": reg.max})
+	}
+	ws, err := tex.NewWorkspace(log, id)
+	if err != nil {
+		return nil, err
+	}
+	w := &workspace{Workspace: ws, lastUsed: time.Now()}
+	reg.items[id] = w
+	return w, nil
+}
+
+// lock looks up a workspace and marks it as busy. If wait is false, lock
+// fails immediately when the workspace is already busy. Callers must
+// call release afterwards.
+func (reg *workspaces) lock(id string, wait bool) (*workspace, error) {
+	if reg.max <= 0 {
+		return nil, tex.InputError("workspaces are disabled", nil, nil)
+	}
+	reg.mu.Lock()
+	w, ok := reg.items[id]
+	if ok {
+		w.lastUsed = time.Now()
+	}
+	reg.mu.Unlock()
+	if !ok {
+		return nil, tex.InputError("unknown workspace", nil, tex.KV{"workspace": id})
+	}
+
+	if !wait {
+		if !w.busy.TryLock() {
+			return nil, tex.QueueError("workspace is busy, please try again later", nil, tex.KV{"workspace": id})
+		}
+	} else {
+		w.busy.Lock()
+	}
+	if w.removed {
+		w.busy.Unlock()
+		return nil, tex.InputError("unknown workspace", nil, tex.KV{"workspace": id})
+	}
+	return w, nil
+}
+
+func (reg *workspaces) release(w *workspace) {
+	reg.mu.Lock()
+	w.lastUsed = time.Now()
+	reg.mu.Unlock()
+	w.busy.Unlock()
+}
+
+// remove deletes a locked workspace, and releases it.
+func (reg *workspaces) remove(w *workspace) error {
+	reg.mu.Lock()
+	delete(reg.items, w.ID())
+	reg.mu.Unlock()
+	w.removed = true
+	defer w.busy.Unlock()
+	return w.Remove()
+}
+
+// expire removes all workspaces, which are not in use and haven't been
+// used since idle.
+func (reg *workspaces) expire(log xlog.Logger, now time.Time) {
+	reg.mu.Lock()
+	var expired []*workspace
+	for _, w := range reg.items {
+		if now.Sub(w.lastUsed) >= reg.idle && w.busy.TryLock() {
+			expired = append(expired, w)
+		}
+	}
+	reg.mu.Unlock()
+
+	for _, w := range expired {
+		log.Info("workspace expired", xlog.String("workspace", w.ID()))
+		if err := reg.remove(w); err != nil {
+			log.Error("failed to remove workspace", xlog.String("workspace", w.ID()), xlog.Error(err))
+		}
+	}
+}
+
+// run expires idle workspaces periodically, until close is called.
+func (reg *workspaces) run(log xlog.Logger) {
+	if reg.max <= 0 || reg.idle <= 0 {
+		return
+	}
+	t := time.NewTicker(max(min(reg.idle/2, time.Minute), time.Second))
+	defer t.Stop()
+	for {
+		select {
+		case <-reg.done:
+			return
+		case now := <-t.C:
+			reg.expire(log, now)
+		}
+	}
+}
+
+// close stops the expiry loop and removes all workspaces.
+func (reg *workspaces) close(log xlog.Logger) {
+	close(reg.done)
+	reg.expire(log, time.Now().Add(reg.idle))
+}
+
+func (w *workspace) status(quota int64) (workspaceStatus, error) {
+	size, err := w.Size()
+	if err != nil {
+		return workspaceStatus{}, err
+	}
+	files := w.Files()
+	if files == nil {
+		files = []string{} // avoid null in JSON
+	}
+	return workspaceStatus{ID: w.ID(), Files: files, Size: size, Quota: quota}, nil
+}
+
+// writeFile adds or replaces a file. When the workspace exceeds the
+// quota afterwards, the file is removed again.
+func (w *workspace) writeFile(log xlog.Logger, name string, r io.Reader, quota int64) error {
+	wc, err := w.NewWriter(name)
+	if err != nil {
+		return err
+	}
+	if quota > 0 {
+		r = io.LimitReader(r, quota+1)
+	}
+	_, err = io.Copy(wc, r)
+	if cerr := wc.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = w.RemoveFile(name)
+		return tex.InputError("cannot save file", err, tex.KV{"filename": name})
+	}
+	log.Info("updated workspace file", xlog.String("workspace", w.ID()), xlog.String("filename", name))
+
+	if quota > 0 {
+		size, err := w.Size()
+		if err != nil {
+			return err
+		}
+		if size > quota {
+			_ = w.RemoveFile(name)
+			return tex.InputError("workspace quota exceeded", nil, tex.KV{"filename": name, "quota": quota})
+		}
+	}
+	return nil
+}
+
+// enforceQuota removes auxiliary files (see tex.Workspace.RemoveAuxFiles),
+// when the workspace exceeds the quota. Compilations create these files,
+// hence the quota is checked before and after each compilation. It fails,
+// if the workspace still exceeds the quota afterwards.
+func (w *workspace) enforceQuota(log xlog.Logger, quota int64) error {
+	if quota <= 0 {
+		return nil
+	}
+	size, err := w.Size()
+	if err != nil || size <= quota {
+		return err
+	}
+	log.Warn("workspace quota exceeded, removing auxiliary files",
+		xlog.Int("size", int(size)),
+		xlog.Int("quota", int(quota)))
+	if err = w.RemoveAuxFiles(); err != nil {
+		return err
+	}
+	if size, err = w.Size(); err != nil {
+		return err
+	}
+	if size > quota {
+		return tex.InputError("workspace quota exceeded", nil, tex.KV{"quota": quota})
+	}
+	return nil
+}
+
+// HandleWorkspace serves requests creating, updating, inspecting and
+// deleting workspaces. Compilations are handled by HandleWorkspaceRender.
+func (svc *service) HandleWorkspace(res http.ResponseWriter, req *http.Request) {
+	log := svc.Logger().With(middleware.RequestIDField(req.Context()))
+	status, code, err := svc.workspace(log, req)
+	if err != nil {
+		errorResponse(log, res, err)
+		return
+	}
+	if code == http.StatusNoContent {
+		res.WriteHeader(code)
+		return
+	}
+
+	res.Header().Set("Content-Type", mimeTypeJSON)
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	res.WriteHeader(code)
+	if err := json.NewEncoder(res).Encode(status); err != nil {
+		log.Error("failed to write response", xlog.Error(err))
+	}
+}
+
+func (svc *service) workspace(log xlog.Logger, req *http.Request) (workspaceStatus, int, error) {
+	reg := svc.workspaces
+	vars := mux.Vars(req)
+	id, name := vars["id"], vars["name"]
+
+	if id == "" { // POST /workspaces
+		id, _ = middleware.GetRequestID(req)
+		w, err := reg.create(log, id)
+		if err != nil {
+			return workspaceStatus{}, 0, err
+		}
+		log.Info("created workspace", xlog.String("workspace", id))
+		status, err := w.status(reg.quota)
+		return status, http.StatusCreated, err
+	}
+
+	w, err := reg.lock(id, true)
+	if err != nil {
+		return workspaceStatus{}, 0, err
+	}
+
+	if req.Method == http.MethodDelete && name == "" {
+		log.Info("removing workspace", xlog.String("workspace", id))
+		return workspaceStatus{}, http.StatusNoContent, reg.remove(w)
+	}
+	defer reg.release(w)
+
+	switch req.Method {
+	case http.MethodPut:
+		err = w.writeFile(log, name, req.Body, reg.quota)
+	case http.MethodDelete:
+		err = w.RemoveFile(name)
+	case http.MethodPatch:
+		err = svc.patchWorkspace(log, w, req)
+	}
+	if err != nil {
+		return workspaceStatus{}, 0, err
+	}
+	status, err := w.status(reg.quota)
+	return status, http.StatusOK, err
+}
+
+// patchWorkspace adds or replaces all files of a multipart/form-data
+// request body (other files remain untouched).
+func (svc *service) patchWorkspace(log xlog.Logger, w *workspace, req *http.Request) error {
+	mr, err := multipartReader(req)
+	if err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return tex.InputError("failed to parse request", err, tex.KV{"part": i})
+		}
+		name := part.FormName()
+		if name == "" {
+			return tex.InputError("empty name", nil, tex.KV{"part": i})
+		}
+		if err = w.writeFile(log, name, part, svc.workspaces.quota); err != nil {
+			tex.ExtendError(err, tex.KV{"part": i})
+			return err
+		}
+	}
+}
+
+// HandleWorkspaceRender compiles the files of a workspace. It accepts the
+// same parameters as HandleRender, and responds likewise.
+func (svc *service) HandleWorkspaceRender(res http.ResponseWriter, req *http.Request) {
+	if svc.compileTimeout > 0 {
+		// apply global render timeout
+		ctx, cancel := context.WithTimeout(req.Context(), svc.compileTimeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+
+	log := svc.Logger().With(middleware.RequestIDField(req.Context()))
+	if wantsProgress(req) {
+		svc.streamProgress(log, res, req, svc.renderWorkspace)
+		return
+	}
+	if err := svc.renderWorkspace(log, res, req); err != nil {
+		metrics.ProcessedFailure.Inc()
+		errorResponse(log, res, err)
+	}
+}
+
+func (svc *service) renderWorkspace(log xlog.Logger, res http.ResponseWriter, req *http.Request) error {
+	id := mux.Vars(req)["id"]
+	log = log.With(xlog.String("workspace", id))
+	params, err := svc.applyProfile(req.Context(), req.URL.Query())
+	if err != nil {
+		return err
+	}
+	if profile := params.Get("profile"); profile != "" {
+		log = log.With(xlog.String("profile", profile))
+	}
+	opts, err := svc.parseJobOptions(params)
+	if err != nil {
+		return err
+	}
+
+	// Concurrent compilations would interfere with each other's
+	// auxiliary files.
+	w, err := svc.workspaces.lock(id, false)
+	if err != nil {
+		return err
+	}
+	defer svc.workspaces.release(w)
+
+	if err = w.enforceQuota(log, svc.workspaces.quota); err != nil {
+		return err
+	}
+	if err = svc.acquire(req.Context()); err != nil {
+		log.Error("failed enter queue", xlog.Error(err))
+		metrics.ProcessedRejected.Inc()
+		return err
+	}
+	defer svc.release()
+
+	doc := w.Document(log, opts.engine, opts.image)
+	doc.SetOutput(opts.output)
+	doc.SetEnv(opts.env)
+	defer func() {
+		observeRenderMetrics(doc)
+		if err := doc.Cleanup(); err != nil {
+			log.Error("cleanup failed", xlog.Error(err))
+		}
+		if err := w.enforceQuota(log, svc.workspaces.quota); err != nil {
+			log.Error("failed to enforce workspace quota", xlog.Error(err))
+		}
+	}()
+
+	if written, err := svc.compile(log, res, req, doc, params); !written {
+		return err
+	}
+	return nil // header is already written
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digineo/texd/exec"
+	"github.com/digineo/texd/service/middleware"
+	"github.com/digineo/texd/tex"
+	"github.com/digineo/xlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspaces(t *testing.T) {
+	require.NoError(t, tex.SetJobBaseDir(t.TempDir()))
+	t.Cleanup(func() { _ = tex.SetJobBaseDir("") })
+
+	svc := newService(Options{
+		QueueLength:    1,
+		Mode:           "local",
+		Executor:       exec.Mock(false, mockPDF),
+		Workspaces:     1,
+		WorkspaceIdle:  time.Minute,
+		WorkspaceQuota: 100,
+	}, xlog.NewDiscard())
+	routes := svc.routes()
+	do := func(method, uri, ct string, body io.Reader) (*http.Response, string) {
+		req := httptest.NewRequest(method, uri, body)
+		if ct != "" {
+			req.Header.Set("Content-Type", ct)
+		}
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		res := rec.Result()
+		b, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, strings.TrimSpace(string(b))
+	}
+
+	res, body := do(http.MethodPost, "/workspaces", "", nil)
+	require.Equal(t, http.StatusCreated, res.StatusCode, body)
+	var status workspaceStatus
+	require.NoError(t, json.Unmarshal([]byte(body), &status))
+	id := res.Header.Get(middleware.HeaderKey)
+	assert.Equal(t, workspaceStatus{ID: id, Files: []string{}, Quota: 100}, status)
+
+	_, body = do(http.MethodPost, "/workspaces", "", nil)
+	assert.Equal(t, `{"category":"queue","error":"too many workspaces, please try again later","limit":1}`, body)
+
+	prefix := "/workspaces/" + id
+	res, body = do(http.MethodPut, prefix+"/files/main.tex", "", strings.NewReader(`\documentclass{article}`))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, `{"id":"`+id+`","files":["main.tex"],"size":23,"quota":100}`, body)
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("chapter/intro.tex", "intro.tex")
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+	_, body = do(http.MethodPatch, prefix, mw.FormDataContentType(), &buf)
+	assert.Equal(t, `{"id":"`+id+`","files":["chapter/intro.tex","main.tex"],"size":28,"quota":100}`, body)
+
+	_, body = do(http.MethodPut, prefix+"/files/big.tex", "", strings.NewReader(strings.Repeat("x", 80)))
+	assert.Equal(t, `{"category":"input","error":"workspace quota exceeded","filename":"big.tex","quota":100}`, body)
+
+	res, body = do(http.MethodDelete, prefix+"/files/chapter/intro.tex", "", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, `{"id":"`+id+`","files":["main.tex"],"size":23,"quota":100}`, body)
+
+	// compilation
+	res, body = do(http.MethodPost, prefix+"/render", "", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, mimeTypePDF, res.Header.Get("Content-Type"))
+	assert.Equal(t, strings.TrimSpace(mockPDF), body)
+	_, body = do(http.MethodGet, prefix, "", nil)
+	assert.Equal(t, `{"id":"`+id+`","files":["main.tex"],"size":`+strconv.Itoa(23+len(mockPDF))+`,"quota":100}`, body)
+
+	// auxiliary files are removed, when a compilation exceeds the quota
+	// (the mock appends to main.pdf on each run)
+	res, _ = do(http.MethodPut, prefix+"/files/chapter.tex", "", strings.NewReader(strings.Repeat("x", 60)))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res, _ = do(http.MethodPost, prefix+"/render", "", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	_, body = do(http.MethodGet, prefix, "", nil)
+	assert.Equal(t, `{"id":"`+id+`","files":["chapter.tex","main.tex"],"size":83,"quota":100}`, body)
+	res, _ = do(http.MethodDelete, prefix+"/files/chapter.tex", "", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	w, err := svc.workspaces.lock(id, false)
+	require.NoError(t, err)
+	_, body = do(http.MethodPost, prefix+"/render", "", nil)
+	assert.Equal(t, `{"category":"queue","error":"workspace is busy, please try again later","workspace":"`+id+`"}`, body)
+
+	// busy workspaces don't expire
+	svc.workspaces.expire(xlog.NewDiscard(), time.Now().Add(time.Hour))
+	svc.workspaces.release(w)
+	res, _ = do(http.MethodGet, prefix, "", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	svc.workspaces.expire(xlog.NewDiscard(), time.Now().Add(time.Hour))
+	_, body = do(http.MethodGet, prefix, "", nil)
+	assert.Equal(t, `{"category":"input","error":"unknown workspace","workspace":"`+id+`"}`, body)
+
+	// explicit removal
+	res, body = do(http.MethodPost, "/workspaces", "", nil)
+	require.Equal(t, http.StatusCreated, res.StatusCode, body)
+	prefix = "/workspaces/" + res.Header.Get(middleware.HeaderKey)
+	res, _ = do(http.MethodDelete, prefix, "", nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res, _ = do(http.MethodGet, prefix, "", nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+
+	svc.workspaces = newWorkspaces(0, 0, 0)
+	_, body = do(http.MethodPost, "/workspaces", "", nil)
+	assert.Equal(t, `{"category":"input","error":"workspaces are disabled"}`, body)
+}
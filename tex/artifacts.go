@@ -0,0 +1,88 @@
+package tex
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// An Artifact is an auxiliary file from the working directory, which
+// clients may request alongside the result, e.g. for forward and inverse
+// search in editors (SyncTeX), or for archiving the log file.
+type Artifact struct {
+	Name string
+
+	// Ext is the file extension, replacing the main input file's one.
+	Ext string
+}
+
+// artifacts is the allow-list of auxiliary files clients may request.
+var artifacts = []Artifact{
+	{Name: "synctex", Ext: ".synctex.gz"},
+	{Name: "log", Ext: ".log"},
+	{Name: "bbl", Ext: ".bbl"},
+	{Name: "aux", Ext: ".aux"},
+}
+
+// SupportedArtifacts lists the names of all known artifacts.
+func SupportedArtifacts() (names []string) {
+	for _, a := range artifacts {
+		names = append(names, a.Name)
+	}
+	return names
+}
+
+// ParseArtifacts parses a comma separated list of artifact names.
+// Duplicates are removed, and the result is ordered like
+// SupportedArtifacts().
+func ParseArtifacts(list string) ([]string, error) {
+	var names []string
+	for name := range strings.SplitSeq(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || slices.Contains(names, name) {
+			continue
+		}
+		if !slices.Contains(SupportedArtifacts(), name) {
+			return nil, fmt.Errorf("unsupported artifact: %q", name)
+		}
+		names = append(names, name)
+	}
+
+	var sorted []string
+	for _, a := range artifacts {
+		if slices.Contains(names, a.Name) {
+			sorted = append(sorted, a.Name)
+		}
+	}
+	return sorted, nil
+}
+
+// WithArtifacts returns a copy of o, which additionally returns the
+// artifacts given as comma separated list (see ParseArtifacts). Results
+// with artifacts are always returned as archive. SyncTeX is not supported
+// for HTML output.
+func (o Output) WithArtifacts(list string) (Output, error) {
+	names, err := ParseArtifacts(list)
+	if err != nil {
+		return o, err
+	}
+	if o.Format == FormatHTML && slices.Contains(names, "synctex") {
+		return o, fmt.Errorf("artifact %q is not supported for format %q", "synctex", o.Format)
+	}
+	o.Artifacts = names
+	return o, nil
+}
+
+// artifactFile returns the file name of the named artifact, given the
+// main input file.
+func artifactFile(c Compiler, name, main string) string {
+	if name == "log" {
+		return c.LogFile(main)
+	}
+	for _, a := range artifacts {
+		if a.Name == name {
+			return replaceExt(main, a.Ext)
+		}
+	}
+	panic("not reached")
+}
@@ -0,0 +1,56 @@
+package tex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseArtifacts(t *testing.T) {
+	t.Parallel()
+
+	names, err := ParseArtifacts("")
+	require.NoError(t, err)
+	assert.Empty(t, names)
+
+	names, err = ParseArtifacts("aux, log,synctex,log")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"synctex", "log", "aux"}, names)
+
+	_, err = ParseArtifacts("log,tex")
+	assert.EqualError(t, err, `unsupported artifact: "tex"`)
+}
+
+func TestOutput_WithArtifacts(t *testing.T) {
+	t.Parallel()
+
+	o, err := Output{}.WithArtifacts("")
+	require.NoError(t, err)
+	assert.False(t, o.IsArchive())
+
+	o, err = Output{}.WithArtifacts("synctex")
+	require.NoError(t, err)
+	assert.True(t, o.IsArchive())
+	assert.Equal(t, []string{"synctex"}, o.Artifacts)
+
+	o, err = Output{Format: FormatHTML}.WithArtifacts("log")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"log"}, o.Artifacts)
+
+	_, err = Output{Format: FormatHTML}.WithArtifacts("synctex")
+	assert.EqualError(t, err, `artifact "synctex" is not supported for format "html"`)
+}
+
+func TestArtifactFile(t *testing.T) {
+	t.Parallel()
+
+	for name, file := range map[string]string{
+		"synctex": "doc/main.synctex.gz",
+		"log":     "doc/main.log",
+		"bbl":     "doc/main.bbl",
+		"aux":     "doc/main.aux",
+	} {
+		assert.Equal(t, file, artifactFile(Latexmk, name, "doc/main.tex"), name)
+	}
+}
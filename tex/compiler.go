@@ -0,0 +1,311 @@
+package tex
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// A Compiler knows how to invoke a specific TeX compiler (or build tool),
+// and where it places its output files.
+type Compiler interface {
+	// Name identifies the compiler, e.g. in engine definitions.
+	Name() string
+
+	// ValidateFlags checks whether the given custom engine flags are
+	// acceptable for this compiler.
+	ValidateFlags(flags []string) error
+
+	// Flags amends the given engine flags with compiler-specific flags
+	// derived from global settings (e.g. the shell escaping mode).
+	Flags(flags []string) []string
+
+	// OptionFlags translates per-document options into compiler flags.
+	// It fails, if the options can't be honoured by this compiler.
+	OptionFlags(opts Options) ([]string, error)
+
+	// Command builds the command line to compile the main input file.
+	// The command is executed inside the document's working directory.
+	Command(flags []string, main string) []string
+
+	// ResultFile and LogFile return the names of the compiled document
+	// and the compiler log file, relative to the working directory.
+	ResultFile(main string) string
+	LogFile(main string) string
+
+	// Failed decides whether a compilation has failed, given the error
+	// and the (error) output of the executed command.
+	Failed(runErr error, output string) bool
+}
+
+var (
+	// Latexmk compiles documents with latexmk, which in turn runs the
+	// actual TeX engine as often as needed. This is the default.
+	Latexmk Compiler = latexmk{}
+
+	// Tectonic compiles documents with Tectonic, a self-contained TeX
+	// engine with its own rerun logic.
+	Tectonic Compiler = tectonic{}
+
+	// Make4ht converts documents to HTML with make4ht (part of tex4ht).
+	// It is not available for custom engines, but used for HTML output
+	// (see Output.Engine).
+	Make4ht Compiler = make4ht{}
+
+	compilers = []Compiler{Latexmk, Tectonic}
+)
+
+type ErrUnsupportedCompiler string
+
+func (err ErrUnsupportedCompiler) Error() string {
+	return fmt.Sprintf("unsupported compiler: %q", string(err))
+}
+
+// ParseCompiler returns the compiler with the given name.
+func ParseCompiler(name string) (Compiler, error) {
+	for _, c := range compilers {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, ErrUnsupportedCompiler(name)
+}
+
+// replaceExt replaces the file extension of main with ext.
+func replaceExt(main, ext string) string {
+	if dot := strings.LastIndexByte(main, '.'); dot > 0 {
+		return main[:dot] + ext
+	}
+	return main + ext
+}
+
+// validateFlags ensures that each flag matches one of the patterns.
+func validateFlags(c Compiler, patterns []*regexp.Regexp, flags []string) error {
+	for _, flag := range flags {
+		valid := false
+		for _, re := range patterns {
+			if re.MatchString(flag) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return &ErrInvalidFlag{Compiler: c.Name(), Flag: flag}
+		}
+	}
+	return nil
+}
+
+type ErrInvalidFlag struct {
+	Compiler string
+	Flag     string
+}
+
+func (err *ErrInvalidFlag) Error() string {
+	return fmt.Sprintf("invalid or forbidden %s flag: %q", err.Compiler, err.Flag)
+}
+
+type latexmk struct{}
+
+func (latexmk) Name() string { return "latexmk" }
+
+func (c latexmk) ValidateFlags(flags []string) error {
+	for _, flag := range flags {
+		if m := engineCommandPattern.FindStringSubmatch(flag); m != nil && !validEngineCommand(m[2]) {
+			return &ErrInvalidFlag{Compiler: c.Name(), Flag: flag}
+		}
+	}
+	return validateFlags(c, latexmkFlagPatterns, flags)
+}
+
+func (latexmk) Flags(flags []string) []string {
+	switch shellEscaping {
+	case RestrictedShellEscape:
+		return flags
+	case AllowedShellEscape:
+		return append([]string{"-shell-escape"}, flags...)
+	case ForbiddenShellEscape:
+		return append([]string{"-no-shell-escape"}, flags...)
+	}
+	panic("not reached")
+}
+
+func (latexmk) OptionFlags(opts Options) (flags []string, err error) {
+	names, err := opts.tools()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Bib == "none" {
+		flags = append(flags, "-bibtex-")
+	}
+	for _, name := range names {
+		t, _ := findTool(name)
+		flags = append(flags, "-e", t.Config)
+	}
+	if opts.Strict {
+		flags = append(flags, "-halt-on-error")
+	}
+	if slices.Contains(opts.Artifacts, "synctex") {
+		flags = append(flags, "-synctex=1")
+	}
+	return flags, nil
+}
+
+func (latexmk) Command(flags []string, main string) []string {
+	lenDefaults := len(LatexmkDefaultFlags)
+	lenFlags := len(flags)
+
+	cmd := make([]string, 1+lenDefaults+lenFlags+1)
+	cmd[0] = "latexmk"
+	copy(cmd[1:], LatexmkDefaultFlags)
+	copy(cmd[1+lenDefaults:], flags)
+	cmd[1+lenDefaults+lenFlags] = main
+
+	return cmd
+}
+
+func (latexmk) ResultFile(main string) string { return replaceExt(main, ".pdf") }
+func (latexmk) LogFile(main string) string    { return replaceExt(main, ".log") }
+func (latexmk) Failed(runErr error, _ string) bool {
+	return runErr != nil
+}
+
+// tectonicFlagPatterns is an allow-list for Tectonic flags in custom
+// engine definitions. Shell escaping is controlled globally, and the
+// output directory is fixed.
+var tectonicFlagPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^(-C|--only-cached|--synctex|--untrusted)$`),
+	regexp.MustCompile(`^--reruns=[0-9]+$`),
+	regexp.MustCompile(`^--bundle=[A-Za-z0-9_./:-]+$`),
+	regexp.MustCompile(`^-Z(continue-on-errors|paper-size=[a-z0-9]+)$`),
+}
+
+// TectonicDefaultFlags are always passed to Tectonic's V2 "compile"
+// interface. Logs are kept, so that GetLogs() works like it does for
+// latexmk.
+var TectonicDefaultFlags = []string{
+	"-X", "compile",
+	"--keep-logs",
+	"--chatter", "minimal",
+}
+
+type tectonic struct{}
+
+func (tectonic) Name() string { return "tectonic" }
+
+func (c tectonic) ValidateFlags(flags []string) error {
+	return validateFlags(c, tectonicFlagPatterns, flags)
+}
+
+func (tectonic) Flags(flags []string) []string {
+	switch shellEscaping {
+	case RestrictedShellEscape:
+		return flags // Tectonic disables shell escaping by default
+	case AllowedShellEscape:
+		return append([]string{"-Z", "shell-escape"}, flags...)
+	case ForbiddenShellEscape:
+		return append([]string{"--untrusted"}, flags...)
+	}
+	panic("not reached")
+}
+
+// OptionFlags only returns flags for artifacts: Tectonic always stops at
+// the first error (unless configured with -Zcontinue-on-errors), and runs
+// biber or bibtex automatically when needed. Other tools are not supported.
+func (c tectonic) OptionFlags(opts Options) (flags []string, err error) {
+	names, err := opts.tools()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if name != "biber" && name != "bibtex" {
+			return nil, fmt.Errorf("tool %q is not supported by %s", name, c.Name())
+		}
+	}
+	if slices.Contains(opts.Artifacts, "synctex") {
+		flags = append(flags, "--synctex")
+	}
+	if slices.Contains(opts.Artifacts, "aux") || slices.Contains(opts.Artifacts, "bbl") {
+		// Tectonic removes intermediate files by default
+		flags = append(flags, "--keep-intermediates")
+	}
+	return flags, nil
+}
+
+func (tectonic) Command(flags []string, main string) []string {
+	cmd := make([]string, 0, 1+len(TectonicDefaultFlags)+len(flags)+1)
+	cmd = append(cmd, "tectonic")
+	cmd = append(cmd, TectonicDefaultFlags...)
+	cmd = append(cmd, flags...)
+	return append(cmd, main)
+}
+
+func (tectonic) ResultFile(main string) string { return replaceExt(main, ".pdf") }
+func (tectonic) LogFile(main string) string    { return replaceExt(main, ".log") }
+
+// Failed also inspects the output, since Tectonic may report errors
+// (e.g. with -Zcontinue-on-errors) and still exit successfully.
+func (tectonic) Failed(runErr error, output string) bool {
+	return runErr != nil || strings.HasPrefix(output, "error: ") || strings.Contains(output, "\nerror: ")
+}
+
+// htmlDir is the output directory for make4ht, relative to the working
+// directory (see internalPrefix).
+const htmlDir = internalPrefix + "html"
+
+type make4ht struct{}
+
+func (make4ht) Name() string { return "make4ht" }
+
+// ValidateFlags only accepts the mode flags for LuaTeX and XeTeX.
+func (c make4ht) ValidateFlags(flags []string) error {
+	for _, flag := range flags {
+		if flag != "-l" && flag != "-x" {
+			return &ErrInvalidFlag{Compiler: c.Name(), Flag: flag}
+		}
+	}
+	return nil
+}
+
+func (make4ht) Flags(flags []string) []string {
+	if shellEscaping == AllowedShellEscape {
+		return append([]string{"-s"}, flags...)
+	}
+	return flags
+}
+
+// OptionFlags rejects auxiliary tools, make4ht would need a build file
+// to run them.
+func (c make4ht) OptionFlags(opts Options) ([]string, error) {
+	names, err := opts.tools()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) > 0 {
+		return nil, fmt.Errorf("tool %q is not supported by %s", names[0], c.Name())
+	}
+	return nil, nil
+}
+
+// Command passes -no-shell-escape as LaTeX option, if shell escaping is
+// forbidden. make4ht has no flag for this, it takes the LaTeX options as
+// fourth argument after the main file (following options for tex4ht.sty,
+// tex4ht and t4ht).
+func (make4ht) Command(flags []string, main string) []string {
+	cmd := make([]string, 0, 4+len(flags)+5)
+	cmd = append(cmd, "make4ht", "-u", "-d", htmlDir)
+	cmd = append(cmd, flags...)
+	cmd = append(cmd, main)
+	if shellEscaping == ForbiddenShellEscape {
+		cmd = append(cmd, "", "", "", "-no-shell-escape")
+	}
+	return cmd
+}
+
+func (make4ht) ResultFile(main string) string { return path.Join(htmlDir, replaceExt(main, ".html")) }
+func (make4ht) LogFile(main string) string    { return replaceExt(main, ".log") }
+func (make4ht) Failed(runErr error, _ string) bool {
+	return runErr != nil
+}
@@ -0,0 +1,109 @@
+package tex
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCompiler(t *testing.T) {
+	t.Parallel()
+
+	c, err := ParseCompiler("latexmk")
+	require.NoError(t, err)
+	assert.Equal(t, Latexmk, c)
+
+	c, err = ParseCompiler("tectonic")
+	require.NoError(t, err)
+	assert.Equal(t, Tectonic, c)
+
+	_, err = ParseCompiler("context")
+	assert.EqualError(t, err, `unsupported compiler: "context"`)
+}
+
+func TestCompiler_outputFiles(t *testing.T) {
+	t.Parallel()
+
+	for _, c := range []Compiler{Latexmk, Tectonic} {
+		assert.Equal(t, "input.pdf", c.ResultFile("input.tex"), c.Name())
+		assert.Equal(t, "input.log", c.LogFile("input.tex"), c.Name())
+		assert.Equal(t, "a.b.pdf", c.ResultFile("a.b.tex"), c.Name())
+		assert.Equal(t, "noext.pdf", c.ResultFile("noext"), c.Name())
+	}
+}
+
+func TestTectonic_Command(t *testing.T) {
+	t.Cleanup(func() { shellEscaping = 0 })
+
+	engine := NewCompilerEngine("tectonic", Tectonic, "--only-cached")
+	prefix := []string{"tectonic", "-X", "compile", "--keep-logs", "--chatter", "minimal"}
+
+	for esc, flags := range map[ShellEscape][]string{
+		RestrictedShellEscape: {"--only-cached"},
+		AllowedShellEscape:    {"-Z", "shell-escape", "--only-cached"},
+		ForbiddenShellEscape:  {"--untrusted", "--only-cached"},
+	} {
+		require.NoError(t, SetShellEscaping(esc))
+
+		expected := append(append(append([]string{}, prefix...), flags...), "main.tex")
+		assert.Equal(t, expected, engine.Command("main.tex"))
+	}
+}
+
+func TestCompiler_Failed(t *testing.T) {
+	t.Parallel()
+
+	errExit := errors.New("exit status 1")
+
+	assert.False(t, Latexmk.Failed(nil, "error: ignored"))
+	assert.True(t, Latexmk.Failed(errExit, ""))
+
+	assert.False(t, Tectonic.Failed(nil, ""))
+	assert.False(t, Tectonic.Failed(nil, "warning: something\n"))
+	assert.True(t, Tectonic.Failed(errExit, ""))
+	assert.True(t, Tectonic.Failed(nil, "error: input.tex:3: Undefined control sequence\n"))
+	assert.True(t, Tectonic.Failed(nil, "note: foo\nerror: halted\n"))
+}
+
+func TestMake4ht(t *testing.T) {
+	t.Cleanup(func() { shellEscaping = 0 })
+
+	engine := NewCompilerEngine("lualatex", Make4ht, "-l")
+	assert.Equal(t, []string{"make4ht", "-u", "-d", "_texd-html", "-l", "main.tex"}, engine.Command("main.tex"))
+
+	require.NoError(t, SetShellEscaping(AllowedShellEscape))
+	assert.Equal(t, []string{"make4ht", "-u", "-d", "_texd-html", "-s", "-l", "main.tex"}, engine.Command("main.tex"))
+
+	require.NoError(t, SetShellEscaping(ForbiddenShellEscape))
+	assert.Equal(t, []string{"make4ht", "-u", "-d", "_texd-html", "-l", "main.tex", "", "", "", "-no-shell-escape"}, engine.Command("main.tex"))
+
+	assert.Equal(t, "_texd-html/main.html", Make4ht.ResultFile("main.tex"))
+	assert.Equal(t, "main.log", Make4ht.LogFile("main.tex"))
+
+	assert.NoError(t, Make4ht.ValidateFlags([]string{"-l", "-x"}))
+	assert.EqualError(t, Make4ht.ValidateFlags([]string{"-e"}), `invalid or forbidden make4ht flag: "-e"`)
+
+	flags, err := Make4ht.OptionFlags(Options{Bib: "none", Strict: true})
+	assert.NoError(t, err)
+	assert.Empty(t, flags)
+	_, err = Make4ht.OptionFlags(Options{Tools: []string{"makeindex"}})
+	assert.EqualError(t, err, `tool "makeindex" is not supported by make4ht`)
+}
+
+func TestCompiler_artifactFlags(t *testing.T) {
+	t.Parallel()
+
+	flags, err := Latexmk.OptionFlags(Options{Artifacts: []string{"synctex", "log"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-synctex=1"}, flags)
+
+	flags, err = Tectonic.OptionFlags(Options{Artifacts: []string{"synctex", "bbl", "aux"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--synctex", "--keep-intermediates"}, flags)
+
+	flags, err = Tectonic.OptionFlags(Options{Artifacts: []string{"log"}})
+	require.NoError(t, err)
+	assert.Empty(t, flags)
+}
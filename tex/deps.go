@@ -0,0 +1,210 @@
+package tex
+
+import (
+	"bufio"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// A Dependency is a file referenced by a TeX source file.
+type Dependency struct {
+	Command string `json:"command"` // e.g. "input", or "includegraphics"
+	Target  string `json:"target"`  // the command argument
+	File    string `json:"file"`    // the referencing file
+	Line    int    `json:"line"`
+
+	// Resolved is the name of the document file Target refers to, if any.
+	Resolved string `json:"resolved,omitempty"`
+}
+
+// IsPackage reports whether d refers to a LaTeX package. Packages are
+// usually provided by the TeX distribution, hence unresolved packages
+// aren't considered missing (see PackageIndex).
+func (d Dependency) IsPackage() bool {
+	return d.Command == "usepackage" || d.Command == "RequirePackage"
+}
+
+var (
+	// dependencyPattern matches commands referencing other files. Optional
+	// arguments (e.g. of \includegraphics and \usepackage) are skipped.
+	dependencyPattern = regexp.MustCompile(`\\(input|include|includegraphics|bibliography|addbibresource|usepackage|RequirePackage)\*?\s*(?:\[[^\]]*\]\s*)*\{([^}]+)\}`)
+
+	// graphicspathPattern matches \graphicspath{{dir1/}{dir2/}}.
+	graphicspathPattern = regexp.MustCompile(`\\graphicspath\s*\{((?:\s*\{[^}]*\})+)\s*\}`)
+	graphicsDirPattern  = regexp.MustCompile(`\{([^}]*)\}`)
+)
+
+// graphicsExtensions are tried in order, if an \includegraphics target
+// has no extension.
+var graphicsExtensions = []string{".pdf", ".png", ".jpg", ".jpeg", ".jbig2", ".jb2", ".eps", ".mps"}
+
+// candidates lists the file names TeX (or BibTeX/Biber) would try for the
+// target of a command, in order. The names are relative to the directory
+// TeX runs in (see Dependencies).
+func candidates(command, target string, graphicsDirs []string) []string {
+	switch command {
+	case "input":
+		// TeX tries "<name>.tex" first
+		return []string{target + ".tex", target}
+	case "include":
+		return []string{target + ".tex"}
+	case "bibliography":
+		if path.Ext(target) == ".bib" {
+			return []string{target}
+		}
+		return []string{target + ".bib"}
+	case "addbibresource":
+		return []string{target}
+	case "usepackage", "RequirePackage":
+		return []string{target + ".sty"}
+	case "includegraphics":
+		var names []string
+		for _, dir := range append([]string{""}, graphicsDirs...) {
+			name := dir + target
+			names = append(names, name)
+			if path.Ext(target) == "" {
+				for _, ext := range graphicsExtensions {
+					names = append(names, name+ext)
+				}
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// Dependencies scans all .tex, .sty and .cls files of doc for commands referencing other
+// files (\input, \include, \includegraphics, \bibliography,
+// \addbibresource, \usepackage and \RequirePackage), and resolves their targets against
+// the files of doc. Targets containing macros are skipped.
+//
+// Since latexmk changes into the directory of the main input file, targets
+// are resolved relative to that directory. Packages are also looked up
+// next to the referencing file, e.g. for package bundles.
+func (doc *document) Dependencies() ([]Dependency, error) {
+	wd, err := doc.WorkingDirectory()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(doc.files))
+	for name := range doc.files {
+		switch path.Ext(name) {
+		case ".tex", ".sty", ".cls":
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	var deps []Dependency
+	var graphicsDirs []string
+	for _, name := range names {
+		if deps, graphicsDirs, err = doc.scanDependencies(wd, name, deps, graphicsDirs); err != nil {
+			return nil, err
+		}
+	}
+	base := "."
+	if main, err := doc.MainInput(); err == nil {
+		base = path.Dir(main)
+	}
+	for i, dep := range deps {
+		dirs := []string{base}
+		if dir := path.Dir(dep.File); dep.IsPackage() && dir != base {
+			dirs = append(dirs, dir)
+		}
+		deps[i].Resolved = doc.resolve(dirs, candidates(dep.Command, dep.Target, graphicsDirs))
+	}
+	return deps, nil
+}
+
+// resolve returns the first candidate found in one of the given
+// directories, or an empty string.
+func (doc *document) resolve(dirs, candidates []string) string {
+	for _, dir := range dirs {
+		for _, c := range candidates {
+			if name, ok := cleanpath(path.Join(dir, c)); ok && doc.HasFile(name) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// MissingFiles returns the dependencies which can't be resolved to a file
+// of the document, except for packages.
+func (doc *document) MissingFiles() ([]Dependency, error) {
+	deps, err := doc.Dependencies()
+	if err != nil {
+		return nil, err
+	}
+	var missing []Dependency
+	for _, dep := range deps {
+		if dep.Resolved == "" && !dep.IsPackage() {
+			missing = append(missing, dep)
+		}
+	}
+	return missing, nil
+}
+
+// scanDependencies appends the dependencies of file name to deps, and
+// the directories declared with \graphicspath to graphicsDirs.
+func (doc *document) scanDependencies(wd, name string, deps []Dependency, graphicsDirs []string) ([]Dependency, []string, error) {
+	f, err := doc.fs.Open(path.Join(wd, name))
+	if err != nil {
+		return nil, nil, UnknownError("failed to open file", err, KV{"filename": name})
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := stripComment(s.Text())
+		for _, m := range graphicspathPattern.FindAllStringSubmatch(line, -1) {
+			for _, dir := range graphicsDirPattern.FindAllStringSubmatch(m[1], -1) {
+				if d := strings.TrimSpace(dir[1]); d != "" && !slices.Contains(graphicsDirs, d) {
+					graphicsDirs = append(graphicsDirs, d)
+				}
+			}
+		}
+		for _, m := range dependencyPattern.FindAllStringSubmatch(line, -1) {
+			for _, target := range splitTargets(m[1], m[2]) {
+				deps = append(deps, Dependency{Command: m[1], Target: target, File: name, Line: n})
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, nil, UnknownError("failed to read file", err, KV{"filename": name})
+	}
+	return deps, graphicsDirs, nil
+}
+
+// splitTargets splits the argument of commands accepting a list of
+// targets, and drops targets containing macros.
+func splitTargets(command, arg string) []string {
+	list := []string{arg}
+	if command == "bibliography" || command == "usepackage" || command == "RequirePackage" {
+		list = strings.Split(arg, ",")
+	}
+	targets := list[:0]
+	for _, target := range list {
+		target = strings.TrimSpace(target)
+		if target != "" && !strings.ContainsAny(target, `\#`) {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// stripComment removes a trailing comment from line.
+func stripComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++ // skip escaped character
+		case '%':
+			return line[:i]
+		}
+	}
+	return line
+}
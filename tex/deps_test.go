@@ -0,0 +1,90 @@
+package tex
+
+import (
+	"testing"
+
+	"github.com/digineo/xlog"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocument_Dependencies(t *testing.T) {
+	t.Parallel()
+
+	doc := NewDocument(xlog.NewDiscard(), DefaultEngine, "").(*document) //nolint:forcetypeassert
+	doc.fs = afero.NewMemMapFs()
+
+	require.NoError(t, doc.AddFile("main.tex", `\documentclass{article}
+\usepackage[utf8]{inputenc}\usepackage{custom, graphicx}
+\graphicspath{{img/}{ assets/ }}
+\addbibresource{refs.bib}
+\begin{document}
+\include{chapters/intro}
+\input{chapters/outro.tex} % \input{commented}
+\includegraphics[width=\textwidth]{logo}\includegraphics{logo.PNG}
+\includegraphics{\imagedir/photo} 100\% \input{missing}
+\bibliography{refs,other.bib}
+\end{document}`))
+	require.NoError(t, doc.AddFile("chapters/intro.tex", `\includegraphics*[page=2]{diagram}`))
+	require.NoError(t, doc.AddFile("custom.sty", `\RequirePackage{xcolor}`))
+	require.NoError(t, doc.AddFile("refs.bib", ""))
+	require.NoError(t, doc.AddFile("img/logo.png", "png"))
+	require.NoError(t, doc.AddFile("assets/diagram.pdf", "pdf"))
+
+	deps, err := doc.Dependencies()
+	require.NoError(t, err)
+	assert.Equal(t, []Dependency{
+		{Command: "includegraphics", Target: "diagram", File: "chapters/intro.tex", Line: 1, Resolved: "assets/diagram.pdf"},
+		{Command: "RequirePackage", Target: "xcolor", File: "custom.sty", Line: 1},
+		{Command: "usepackage", Target: "inputenc", File: "main.tex", Line: 2},
+		{Command: "usepackage", Target: "custom", File: "main.tex", Line: 2, Resolved: "custom.sty"},
+		{Command: "usepackage", Target: "graphicx", File: "main.tex", Line: 2},
+		{Command: "addbibresource", Target: "refs.bib", File: "main.tex", Line: 4, Resolved: "refs.bib"},
+		{Command: "include", Target: "chapters/intro", File: "main.tex", Line: 6, Resolved: "chapters/intro.tex"},
+		{Command: "input", Target: "chapters/outro.tex", File: "main.tex", Line: 7},
+		{Command: "includegraphics", Target: "logo", File: "main.tex", Line: 8, Resolved: "img/logo.png"},
+		{Command: "includegraphics", Target: "logo.PNG", File: "main.tex", Line: 8},
+		{Command: "input", Target: "missing", File: "main.tex", Line: 9},
+		{Command: "bibliography", Target: "refs", File: "main.tex", Line: 10, Resolved: "refs.bib"},
+		{Command: "bibliography", Target: "other.bib", File: "main.tex", Line: 10},
+	}, deps)
+
+	missing, err := doc.MissingFiles()
+	require.NoError(t, err)
+	assert.Equal(t, []Dependency{
+		{Command: "input", Target: "chapters/outro.tex", File: "main.tex", Line: 7},
+		{Command: "includegraphics", Target: "logo.PNG", File: "main.tex", Line: 8},
+		{Command: "input", Target: "missing", File: "main.tex", Line: 9},
+		{Command: "bibliography", Target: "other.bib", File: "main.tex", Line: 10},
+	}, missing)
+}
+
+func TestDocument_Dependencies_subdirectory(t *testing.T) {
+	t.Parallel()
+
+	doc := NewDocument(xlog.NewDiscard(), DefaultEngine, "").(*document) //nolint:forcetypeassert
+	doc.fs = afero.NewMemMapFs()
+
+	// latexmk runs in the directory of the main input
+	require.NoError(t, doc.AddFile("sub/main.tex", `\input{chapter}
+\includegraphics{../shared/logo}\input{sub/chapter}
+\usepackage{custom,bundle}`))
+	require.NoError(t, doc.AddFile("sub/chapter.tex", ""))
+	require.NoError(t, doc.AddFile("sub/custom.sty", ""))
+	require.NoError(t, doc.AddFile("lib/bundle.sty", `\RequirePackage{bundle-extra}`))
+	require.NoError(t, doc.AddFile("lib/bundle-extra.sty", ""))
+	require.NoError(t, doc.AddFile("shared/logo.png", "png"))
+	require.NoError(t, doc.SetMainInput("sub/main.tex"))
+
+	deps, err := doc.Dependencies()
+	require.NoError(t, err)
+	assert.Equal(t, []Dependency{
+		{Command: "RequirePackage", Target: "bundle-extra", File: "lib/bundle.sty", Line: 1, Resolved: "lib/bundle-extra.sty"},
+		{Command: "input", Target: "chapter", File: "sub/main.tex", Line: 1, Resolved: "sub/chapter.tex"},
+		{Command: "includegraphics", Target: "../shared/logo", File: "sub/main.tex", Line: 2, Resolved: "shared/logo.png"},
+		{Command: "input", Target: "sub/chapter", File: "sub/main.tex", Line: 2},
+		{Command: "usepackage", Target: "custom", File: "sub/main.tex", Line: 3, Resolved: "sub/custom.sty"},
+		{Command: "usepackage", Target: "bundle", File: "sub/main.tex", Line: 3},
+	}, deps)
+}
@@ -0,0 +1,183 @@
+package tex
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// UnknownErrorCode is reported by Diagnose, if no ErrorPattern matches.
+const UnknownErrorCode = "unknown"
+
+// An ErrorPattern maps a well-known TeX (or latexmk) failure to a stable
+// error code, and a hint for users. Named groups of the pattern are
+// reported as error extras, and can be referenced in the hint as
+// "${name}".
+type ErrorPattern struct {
+	Code    string
+	Pattern *regexp.Regexp
+	Hint    string
+}
+
+// errorCodePattern restricts the names of error codes.
+var errorCodePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// errorPatterns is ordered by priority: specific errors come first, as
+// they usually cause later, more generic errors.
+var errorPatterns = []ErrorPattern{
+	{
+		Code:    "missing_package",
+		Pattern: regexp.MustCompile("^! LaTeX Error: File `(?P<package>[^']+)\\.sty' not found"),
+		Hint:    "The package ${package} is not available. Upload ${package}.sty, or use an image providing it.",
+	},
+	{
+		Code:    "missing_class",
+		Pattern: regexp.MustCompile("^! LaTeX Error: File `(?P<class>[^']+)\\.cls' not found"),
+		Hint:    "The document class ${class} is not available. Upload ${class}.cls, or use an image providing it.",
+	},
+	{
+		Code:    "missing_file",
+		Pattern: regexp.MustCompile("^! (?:LaTeX Error: File|I can't find file) `(?P<file>[^']+)'"),
+		Hint:    "The file ${file} is missing. Check its name (which is case sensitive), and make sure it was uploaded.",
+	},
+	{
+		Code:    "missing_font",
+		Pattern: regexp.MustCompile(`^! Package fontspec Error: The font "(?P<font>[^"]+)" cannot be found`),
+		Hint:    "The font ${font} is not available. Upload the font file, or use an image providing it.",
+	},
+	{
+		Code:    "missing_font",
+		Pattern: regexp.MustCompile(`^! Font \S+=(?P<font>\S+) .*not loadable`),
+		Hint:    "The font ${font} is not available. Upload the font file, or use an image providing it.",
+	},
+	{
+		Code:    "undefined_control_sequence",
+		Pattern: regexp.MustCompile(`^! Undefined control sequence`),
+		Hint:    "A command is not defined. Check for typos, or load the package defining it.",
+	},
+	{
+		Code:    "undefined_environment",
+		Pattern: regexp.MustCompile(`^! LaTeX Error: Environment (?P<environment>\S+) undefined`),
+		Hint:    "The environment ${environment} is not defined. Check for typos, or load the package defining it.",
+	},
+	{
+		Code:    "missing_begin_document",
+		Pattern: regexp.MustCompile(`^! LaTeX Error: Missing \\begin\{document\}`),
+		Hint:    `The document body was started too early. Check the preamble for stray text, or a broken \documentclass.`,
+	},
+	{
+		Code:    "missing_math_mode",
+		Pattern: regexp.MustCompile(`^! Missing \$ inserted`),
+		Hint:    "A math command is used outside of math mode, or a $ is missing.",
+	},
+	{
+		Code:    "unbalanced_braces",
+		Pattern: regexp.MustCompile(`^(?:! Too many \}'s|! Extra \}, or forgotten|! Missing \} inserted|Runaway argument\?|! File ended while scanning)`),
+		Hint:    "Braces are not balanced. Check for a missing { or }.",
+	},
+	{
+		Code:    "max_runs_exceeded",
+		Pattern: regexp.MustCompile(`^Latexmk: Maximum runs of \S+ reached`),
+		Hint:    "The document did not stabilize. Check for references or labels changing on each run.",
+	},
+	{
+		Code:    "emergency_stop",
+		Pattern: regexp.MustCompile(`^! Emergency stop`),
+		Hint:    "TeX stopped early. The log file contains details.",
+	},
+}
+
+// ParseErrorPattern parses an error pattern definition of the form
+// "code=params", where params is a URL query string with a (required)
+// "pattern" and an (optional) "hint" value:
+//
+//	shell_escape=pattern=^!+Package+minted+Error:+You+must+invoke&hint=Enable+shell+escaping.
+func ParseErrorPattern(def string) (ErrorPattern, error) {
+	code, rawParams, ok := strings.Cut(def, "=")
+	if !ok {
+		return ErrorPattern{}, fmt.Errorf("invalid error pattern %q: expected code=params", def)
+	}
+	if !errorCodePattern.MatchString(code) || code == UnknownErrorCode {
+		return ErrorPattern{}, fmt.Errorf("invalid error pattern %q: invalid code", def)
+	}
+	params, err := url.ParseQuery(rawParams)
+	if err != nil {
+		return ErrorPattern{}, fmt.Errorf("invalid error pattern %q: %w", def, err)
+	}
+	if params.Get("pattern") == "" {
+		return ErrorPattern{}, fmt.Errorf("invalid error pattern %q: missing pattern", def)
+	}
+	re, err := regexp.Compile(params.Get("pattern"))
+	if err != nil {
+		return ErrorPattern{}, fmt.Errorf("invalid error pattern %q: %w", def, err)
+	}
+	return ErrorPattern{Code: code, Pattern: re, Hint: params.Get("hint")}, nil
+}
+
+// AddErrorPattern adds a custom error pattern. Custom patterns take
+// precedence over built-in ones (and previously added patterns).
+func AddErrorPattern(p ErrorPattern) {
+	errorPatterns = slices.Insert(errorPatterns, 0, p)
+}
+
+// ErrorCodes lists the known error codes.
+func ErrorCodes() []string {
+	var codes []string
+	for _, p := range errorPatterns {
+		if !slices.Contains(codes, p.Code) {
+			codes = append(codes, p.Code)
+		}
+	}
+	return codes
+}
+
+// lineNumberPattern matches the location TeX reports after an error.
+var lineNumberPattern = regexp.MustCompile(`^l\.(\d+) `)
+
+// lineNumberLookahead limits the search for the location of an error.
+const lineNumberLookahead = 10
+
+// Diagnose searches the compiler output (usually the log file) for
+// well-known failures, and returns the error code and the extras to add
+// to a CompilationError ("code", "hint", the pattern's named groups, and
+// the "line" in the input file, if TeX reported one). If no pattern
+// matches, the code is UnknownErrorCode, and extra is nil.
+func Diagnose(output []byte) (code string, extra KV) {
+	var lines []string
+	s := bufio.NewScanner(bytes.NewReader(output))
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+
+	for _, p := range errorPatterns {
+		for i, line := range lines {
+			m := p.Pattern.FindStringSubmatchIndex(line)
+			if m == nil {
+				continue
+			}
+			extra = KV{"code": p.Code}
+			for j, name := range p.Pattern.SubexpNames() {
+				if name != "" && m[2*j] >= 0 {
+					extra[name] = line[m[2*j]:m[2*j+1]]
+				}
+			}
+			if p.Hint != "" {
+				extra["hint"] = string(p.Pattern.ExpandString(nil, p.Hint, line, m))
+			}
+			for _, next := range lines[i+1 : min(len(lines), i+1+lineNumberLookahead)] {
+				if l := lineNumberPattern.FindStringSubmatch(next); l != nil {
+					extra["line"], _ = strconv.Atoi(l[1])
+					break
+				}
+			}
+			return p.Code, extra
+		}
+	}
+	return UnknownErrorCode, nil
+}
@@ -0,0 +1,78 @@
+package tex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnose(t *testing.T) {
+	for _, tc := range []struct {
+		log   string
+		code  string
+		extra KV
+	}{
+		{
+			log:  "This is XeTeX\n! Emergency stop.\n",
+			code: "emergency_stop",
+		}, {
+			log:   "! LaTeX Error: File `fancy.sty' not found.\n\nType X to quit.\n\nl.4 \\usepackage\n{xcolor}\n! Emergency stop.\n",
+			code:  "missing_package",
+			extra: KV{"package": "fancy", "line": 4},
+		}, {
+			log:   "! Undefined control sequence.\nl.12 \\foo\n",
+			code:  "undefined_control_sequence",
+			extra: KV{"line": 12},
+		}, {
+			log:   "! Package fontspec Error: The font \"Comic Sans\" cannot be found.\n",
+			code:  "missing_font",
+			extra: KV{"font": "Comic Sans"},
+		}, {
+			log:  "Latexmk: Maximum runs of pdflatex reached without getting stable files\n",
+			code: "max_runs_exceeded",
+		}, {
+			log:  "! Something else.\n",
+			code: UnknownErrorCode,
+		},
+	} {
+		code, extra := Diagnose([]byte(tc.log))
+		assert.Equal(t, tc.code, code)
+		if code == UnknownErrorCode {
+			assert.Nil(t, extra)
+			continue
+		}
+		assert.Equal(t, code, extra["code"])
+		assert.NotEmpty(t, extra["hint"])
+		for k, v := range tc.extra {
+			assert.Equal(t, v, extra[k], "%s: %s", code, k)
+		}
+	}
+}
+
+func TestParseErrorPattern(t *testing.T) {
+	for _, def := range []string{
+		"shell_escape",
+		"Invalid=pattern=x",
+		"unknown=pattern=x",
+		"shell_escape=hint=x",
+		"shell_escape=pattern=(",
+		"shell_escape=pattern=%zz",
+	} {
+		_, err := ParseErrorPattern(def)
+		assert.Error(t, err, def)
+	}
+
+	p, err := ParseErrorPattern(`shell_escape=pattern=^!+Package+(?P<package>\w%2B)+Error:+You+must+invoke&hint=Enable+shell+escape+for+${package}.`)
+	require.NoError(t, err)
+	assert.Equal(t, "shell_escape", p.Code)
+
+	saved := errorPatterns
+	t.Cleanup(func() { errorPatterns = saved })
+	AddErrorPattern(p)
+	assert.Equal(t, "shell_escape", ErrorCodes()[0])
+
+	code, extra := Diagnose([]byte("! Package minted Error: You must invoke LaTeX with the -shell-escape flag.\n! Emergency stop.\n"))
+	assert.Equal(t, "shell_escape", code)
+	assert.Equal(t, KV{"code": "shell_escape", "package": "minted", "hint": "Enable shell escape for minted."}, extra)
+}
@@ -0,0 +1,74 @@
+package tex
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DistributionPrograms lists the programs whose versions are reported by
+// DistributionCommand. pyhanko (for signing, see SigningKey) is not part
+// of TeX Live, and listed to detect whether it is installed.
+var DistributionPrograms = []string{"latexmk", "pdftex", "xetex", "luatex", "pyhanko"}
+
+// DistributionCommand prints the version banners of DistributionPrograms
+// (as "<program>: <banner>", missing programs are skipped), and the
+// TEXMFDIST directory. Its output can be parsed with ParseDistribution.
+var DistributionCommand = []string{"sh", "-c", `for p in ` + strings.Join(DistributionPrograms, " ") + `; do
+	command -v "$p" >/dev/null && echo "$p: $("$p" --version 2>&1 | grep -m1 .)"
+done
+echo "texmfdist: $(kpsewhich -var-value TEXMFDIST 2>/dev/null)"`}
+
+// DistributionInfo describes a TeX distribution.
+type DistributionInfo struct {
+	// TeXLive is the release year of TeX Live, if applicable.
+	TeXLive string `json:"texlive,omitempty"`
+
+	// Versions maps the names of DistributionPrograms to their versions.
+	// Missing programs are omitted.
+	Versions map[string]string `json:"versions,omitempty"`
+}
+
+var (
+	texLivePattern = regexp.MustCompile(`TeX Live (\d{4})`)
+	texmfPattern   = regexp.MustCompile(`/(\d{4})/`)
+
+	// latexmk and LuaTeX state "Version x.y", other programs start their
+	// banner with the version
+	versionPattern       = regexp.MustCompile(`Version (\S+)`)
+	bannerVersionPattern = regexp.MustCompile(`\d[\w.-]*`)
+)
+
+// ParseDistribution parses the output of DistributionCommand.
+func ParseDistribution(out []byte) DistributionInfo {
+	info := DistributionInfo{Versions: make(map[string]string)}
+	var texmfdist string
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		key, value, ok := strings.Cut(s.Text(), ": ")
+		if !ok {
+			continue
+		}
+		if key == "texmfdist" {
+			texmfdist = value
+			continue
+		}
+		if !slices.Contains(DistributionPrograms, key) {
+			continue
+		}
+		if m := versionPattern.FindStringSubmatch(value); m != nil {
+			info.Versions[key] = m[1]
+		} else if v := bannerVersionPattern.FindString(value); v != "" {
+			info.Versions[key] = v
+		}
+		if m := texLivePattern.FindStringSubmatch(value); m != nil && info.TeXLive == "" {
+			info.TeXLive = m[1]
+		}
+	}
+	if m := texmfPattern.FindStringSubmatch(texmfdist); m != nil && info.TeXLive == "" {
+		info.TeXLive = m[1] // e.g. /usr/local/texlive/2023/texmf-dist
+	}
+	return info
+}
@@ -0,0 +1,38 @@
+package tex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDistribution(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, DistributionInfo{
+		TeXLive: "2023",
+		Versions: map[string]string{
+			"latexmk": "4.79",
+			"pdftex":  "3.141592653-2.6-1.40.25",
+			"xetex":   "3.141592653-2.6-0.999995",
+			"luatex":  "1.17.0",
+			"pyhanko": "0.25.1",
+		},
+	}, ParseDistribution([]byte(`latexmk: Latexmk, John Collins, 7 Jan. 2023. Version 4.79
+pdftex: pdfTeX 3.141592653-2.6-1.40.25 (TeX Live 2023/Debian)
+xetex: XeTeX 3.141592653-2.6-0.999995 (TeX Live 2023/Debian)
+luatex: This is LuaTeX, Version 1.17.0 (TeX Live 2023/Debian)
+pyhanko: pyHanko, version 0.25.1
+texmfdist: /usr/share/texlive/texmf-dist
+`)))
+
+	assert.Equal(t, DistributionInfo{
+		TeXLive:  "2022",
+		Versions: map[string]string{"pdftex": "3.14159265-2.6-1.40.21"},
+	}, ParseDistribution([]byte(`pdftex: pdfTeX 3.14159265-2.6-1.40.21
+other: Version 1.0
+texmfdist: /usr/local/texlive/2022/texmf-dist
+`)))
+
+	assert.Equal(t, DistributionInfo{Versions: map[string]string{}}, ParseDistribution([]byte("texmfdist: \n")))
+}
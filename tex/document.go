@@ -2,10 +2,13 @@ package tex
 
 import (
 	"bytes"
+	"errors"
 	"io"
+	"io/fs"
+	"maps"
 	"os"
 	"path"
-	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 
@@ -50,6 +53,7 @@ type File struct {
 	name  string
 	flags candidateFlags
 	size  int
+	magic MagicComments
 }
 
 func (f *File) isCandidate() bool      { return f.flags&flagCandidate > 0 }
@@ -62,10 +66,19 @@ type fileWriter struct {
 	off  int    // how many bytes were written to buf
 	wc   io.WriteCloser
 	file *File
+	scan bool        // whether to fill buf (for main candidates and other TeX files)
+	enc  *transcoder // converts input to UTF-8, see SetEncodingDetection
 }
 
 func (w *fileWriter) Write(p []byte) (int, error) {
-	if w.file.isCandidate() {
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.write(p)
+}
+
+func (w *fileWriter) write(p []byte) (int, error) {
+	if w.scan {
 		// fill buf, if buf has capacity
 		if pos := len(w.buf); w.off < pos {
 			if n := pos - w.off; n > len(p) {
@@ -86,6 +99,18 @@ func (w *fileWriter) Write(p []byte) (int, error) {
 }
 
 func (w *fileWriter) Close() error {
+	if w.enc != nil {
+		if err := w.enc.Close(); err != nil {
+			_ = w.wc.Close()
+			return err
+		}
+	}
+	if w.scan {
+		if mc := parseMagicComments(w.buf[:w.off]); mc != nil {
+			w.log.Info("found magic comments", xlog.Any("magic", mc))
+			w.file.magic = mc
+		}
+	}
 	if w.file.isCandidate() {
 		if bytes.HasPrefix(w.buf, []byte(Mark)) {
 			w.log.Info("found mark")
@@ -140,6 +165,10 @@ type Document interface {
 
 	// Cleanup removes the working directory and any contents. You need
 	// to read/copy the result PDF with GetResult() before cleaning up.
+	//
+	// For documents of a Workspace, Cleanup only removes converted and
+	// post-processed files, and keeps the sources as well as auxiliary
+	// files for the next compilation.
 	Cleanup() error
 
 	// Image declares which Docker image should be used when compiling
@@ -150,6 +179,24 @@ type Document interface {
 	// Engine defines the LaTeX engine to compile the document with.
 	Engine() Engine
 
+	// SetEngine replaces the engine given to NewDocument, e.g. after
+	// evaluating MagicComments().
+	SetEngine(engine Engine)
+
+	// MagicComments returns the settings declared in magic comments of
+	// the main input file, restricted to the keys allowed by
+	// SetMagicComments. Returns nil, if the main input file can't be
+	// determined.
+	MagicComments() MagicComments
+
+	// Dependencies returns the files and packages referenced in any .tex,
+	// .sty or .cls file (see Dependency).
+	Dependencies() ([]Dependency, error)
+
+	// MissingFiles returns the files referenced by Dependencies, which
+	// were not added to the document. Packages are not included.
+	MissingFiles() ([]Dependency, error)
+
 	// SetMainInput marks a previously added file (either through AddFile
 	// or NewWriter) as main input file ("jobname") for LaTeX.
 	//
@@ -161,8 +208,14 @@ type Document interface {
 	// given name, and stop guessing the main input file.
 	SetMainInput(name string) error
 
+	// HasFile reports whether a file with the given name was added
+	// (through AddFile or NewWriter).
+	HasFile(name string) bool
+
 	// MainInput tries to guess the main input file for the LaTeX
-	// compiler. Candidates taken from .tex files in the root working
+	// compiler. If any .tex file declares a main input file with a magic
+	// comment (e.g. "% !TEX root = main.tex"), this file is used.
+	// Otherwise, candidates are taken from .tex files in the root working
 	// directory:
 	//	- highest precedence have files starting with a "%!texd" mark
 	//	- if none of those exists, use files with a \documentclass in the
@@ -176,8 +229,45 @@ type Document interface {
 	// GetResult returns a handle to read the compiled PDF. If MainInput()
 	// returns an error, GetResult will wrap it in an InputError. If the
 	// PDF file does not exist, GetResult will return a CompilationError.
+	// For reproducible builds (see Output.WithReproducible), GetResult
+	// normalizes the trailer IDs of the PDF file first.
 	GetResult() (io.ReadCloser, error)
 
+	// SetOutput selects the output format. By default, the compiled
+	// PDF document is returned.
+	SetOutput(output Output)
+
+	// Output returns the selected output format.
+	Output() Output
+
+	// SetEnv sets environment variables for the compiler and all steps
+	// (see ParseEnv). It replaces previously set variables.
+	SetEnv(env map[string]string)
+
+	// Environ lists additional environment variables (as "NAME=value")
+	// for the compiler and all steps. It includes the variables set with
+	// SetEnv, and those required by the output settings (e.g. for
+	// reproducible builds), which take precedence.
+	Environ() []string
+
+	// Steps lists commands to run in the working directory after a
+	// successful compilation, e.g. to post-process the PDF document, or
+	// to convert it into the selected output format.
+	Steps() []Step
+
+	// GetResults is the multi-file counterpart to GetResult. It returns
+	// handles to read all output files in the selected format, e.g. one
+	// image per page. For PDF output, this is equivalent to GetResult.
+	// If no output file exists, GetResults returns a CompilationError.
+	//
+	// The caller must close all returned files.
+	GetResults() ([]ResultFile, error)
+
+	// GetArtifacts returns handles to read the auxiliary files selected
+	// with Output.WithArtifacts. Missing files (e.g. the .bbl file of a
+	// document without bibliography) are skipped.
+	GetArtifacts() ([]ResultFile, error)
+
 	// GetLogs returns a handle to read the TeX compiler logs. If MainInput()
 	// returns an error, GetLogs will wrap it in an InputError. If the
 	// log file does not exist, GetLogs will return a CompilationError.
@@ -197,10 +287,16 @@ type document struct {
 	log    xlog.Logger
 	image  string
 	engine Engine
+	output Output
+	env    map[string]string
 
 	mkWorkDirName string
 	mkWorkDir     *sync.Once
 	mkWorkDirErr  error
+
+	// persistent documents belong to a Workspace, their working
+	// directory outlives the document
+	persistent bool
 }
 
 var _ Document = (*document)(nil)
@@ -219,6 +315,46 @@ func NewDocument(log xlog.Logger, engine Engine, image string) Document {
 func (doc *document) Image() string  { return doc.image }
 func (doc *document) Engine() Engine { return doc.engine }
 
+func (doc *document) SetOutput(output Output) { doc.output = output }
+func (doc *document) Output() Output          { return doc.output }
+
+func (doc *document) Steps() []Step {
+	main, err := doc.MainInput()
+	if err != nil {
+		return nil
+	}
+	return doc.output.steps(doc.engine.Compiler().ResultFile(main))
+}
+
+func (doc *document) SetEngine(engine Engine) {
+	doc.log.Debug("setting engine", xlog.String("engine", engine.Name()))
+	doc.engine = engine
+}
+
+func (doc *document) SetEnv(env map[string]string) {
+	doc.env = maps.Clone(env)
+}
+
+func (doc *document) Environ() []string {
+	return environ(doc.env, doc.output)
+}
+
+func (doc *document) HasFile(name string) bool {
+	_, ok := doc.files[toNFC(name)]
+	return ok
+}
+
+func (doc *document) MagicComments() MagicComments {
+	main, err := doc.MainInput()
+	if err != nil {
+		return nil
+	}
+	if f := doc.files[main]; f != nil {
+		return f.magic
+	}
+	return nil
+}
+
 func (doc *document) WorkingDirectory() (string, error) {
 	doc.mkWorkDir.Do(doc.createWorkDir)
 	return doc.workdir, doc.mkWorkDirErr
@@ -226,7 +362,7 @@ func (doc *document) WorkingDirectory() (string, error) {
 
 func (doc *document) createWorkDir() {
 	if doc.mkWorkDirName != "" {
-		doc.workdir = filepath.Join(baseJobDir, doc.mkWorkDirName)
+		doc.workdir = jobDir(doc.mkWorkDirName)
 		return
 	}
 
@@ -263,6 +399,12 @@ func (doc *document) AddFile(name, contents string) error {
 }
 
 func (doc *document) NewWriter(name string) (wc io.WriteCloser, err error) {
+	return doc.newWriter(name, false)
+}
+
+// newWriter implements NewWriter. If replace is true, existing files are
+// truncated instead of being rejected as duplicate (see Workspace).
+func (doc *document) newWriter(name string, replace bool) (wc io.WriteCloser, err error) {
 	file := &File{}
 
 	defer func() {
@@ -278,13 +420,14 @@ func (doc *document) NewWriter(name string) (wc io.WriteCloser, err error) {
 		}
 	}()
 
+	name = normalizeName(doc.log, name)
 	var ok bool
 	if file.name, ok = cleanpath(name); !ok {
 		err = InputError("invalid file name", nil, nil)
 		return wc, err
 	}
 
-	if _, exists := doc.files[name]; exists {
+	if _, exists := doc.files[name]; exists && !replace {
 		err = InputError("duplicate file name", nil, nil)
 		return wc, err
 	} else {
@@ -304,7 +447,11 @@ func (doc *document) NewWriter(name string) (wc io.WriteCloser, err error) {
 		}
 	}
 
-	f, osErr := doc.fs.OpenFile(path.Join(wd, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, o_rw)
+	flags := os.O_CREATE | os.O_APPEND | os.O_WRONLY
+	if replace {
+		flags = os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	}
+	f, osErr := doc.fs.OpenFile(path.Join(wd, name), flags, o_rw)
 	if osErr != nil {
 		err = InputError("cannot create file", osErr, nil)
 		return wc, err
@@ -316,12 +463,17 @@ func (doc *document) NewWriter(name string) (wc io.WriteCloser, err error) {
 		file.flags |= flagCandidate
 	}
 
-	return &fileWriter{
+	w := &fileWriter{
 		log:  log,
 		file: file,
 		wc:   f,
 		buf:  make([]byte, guessLimit),
-	}, nil
+		scan: file.isCandidate() || strings.HasSuffix(file.name, ".tex"),
+	}
+	if cat := categoryFromName(file.name); detectEncoding && (cat == texFile || cat == dataFile) {
+		w.enc = newTranscoder(log, w.write, cat == texFile)
+	}
+	return w, nil
 }
 
 func (doc *document) SetMainInput(name string) error {
@@ -343,6 +495,9 @@ func (doc *document) MainInput() (string, error) {
 	if doc.mainInput != "" {
 		return doc.mainInput, nil
 	}
+	if root, err := doc.magicRoot(); root != "" || err != nil {
+		return root, err
+	}
 
 	var withDocClass, withMark, others []*File
 
@@ -375,10 +530,43 @@ func (doc *document) MainInput() (string, error) {
 	return "", InputError("cannot determine main input file: no candidates", nil, nil)
 }
 
-// openFile opens an auxiliary file for reading. Auxiliary files are files
-// with the same name stem as the main input file, but with a different
-// extension.
-func (doc *document) openFile(ext string) (io.ReadCloser, error) {
+// magicRoot returns the main input file declared by magic comments in
+// any file. Relative names are resolved against the declaring file's
+// directory, and all declarations must agree.
+func (doc *document) magicRoot() (string, error) {
+	var roots []string
+	for _, f := range doc.files {
+		decl, ok := f.magic[MagicInput]
+		if !ok {
+			continue
+		}
+		root, ok := cleanpath(path.Join(path.Dir(f.name), decl))
+		if !ok || doc.files[root] == nil {
+			return "", InputError("unknown main input file in magic comment", nil, KV{
+				"filename": decl,
+				"file":     f.name,
+			})
+		}
+		if !slices.Contains(roots, root) {
+			roots = append(roots, root)
+		}
+	}
+	if len(roots) > 1 {
+		slices.Sort(roots)
+		return "", InputError("cannot determine main input file: conflicting magic comments", nil, KV{
+			"candidates": roots,
+		})
+	}
+	if len(roots) == 1 {
+		return roots[0], nil
+	}
+	return "", nil
+}
+
+// openFile opens an output file for reading. Output files are created by
+// the compiler, and their name is usually derived from the main input
+// file name (see Compiler.ResultFile and Compiler.LogFile).
+func (doc *document) openFile(outputName func(main string) string) (io.ReadCloser, error) {
 	input, err := doc.MainInput()
 	if err != nil { // unlikely at this point
 		return nil, InputError("no main input specified", err, nil)
@@ -389,7 +577,7 @@ func (doc *document) openFile(ext string) (io.ReadCloser, error) {
 		return nil, InputError("invalid main input file name", nil, nil)
 	}
 
-	output := input[:extpos] + ext
+	output := outputName(input)
 	f, err := doc.fs.Open(path.Join(doc.workdir, output))
 	if err != nil {
 		return nil, CompilationError("failed to open output file for reading", err, KV{
@@ -401,16 +589,143 @@ func (doc *document) openFile(ext string) (io.ReadCloser, error) {
 
 func (doc *document) GetResult() (io.ReadCloser, error) {
 	doc.log.Debug("fetching result")
-	return doc.openFile(".pdf")
+	resultFile := func(main string) string {
+		return doc.output.ResultFile(doc.engine.Compiler().ResultFile(main))
+	}
+	if doc.output.Reproducible && doc.output.IsPDF() {
+		if err := doc.normalizeResult(resultFile); err != nil {
+			return nil, err
+		}
+	}
+	return doc.openFile(resultFile)
+}
+
+// normalizeResult replaces the trailer IDs of the result PDF with a hash
+// of its content (see normalizeTrailerIDs).
+func (doc *document) normalizeResult(outputName func(main string) string) error {
+	main, err := doc.MainInput()
+	if err != nil { // unlikely at this point
+		return InputError("no main input specified", err, nil)
+	}
+	name := path.Join(doc.workdir, outputName(main))
+	afs := afero.Afero{Fs: doc.fs}
+	pdf, err := afs.ReadFile(name)
+	if err != nil {
+		return CompilationError("failed to open output file for reading", err, KV{
+			"file": outputName(main),
+		})
+	}
+	if !normalizeTrailerIDs(pdf) {
+		doc.log.Warn("no trailer ID found", xlog.String("file", outputName(main)))
+		return nil
+	}
+	if err = afs.WriteFile(name, pdf, o_rw); err != nil {
+		return CompilationError("failed to normalize output file", err, KV{
+			"file": outputName(main),
+		})
+	}
+	return nil
+}
+
+// A ResultFile is an output file, opened for reading.
+type ResultFile struct {
+	Name string // file name, relative to the working directory
+	io.ReadCloser
+}
+
+func (doc *document) GetResults() ([]ResultFile, error) {
+	if doc.output.IsPDF() {
+		main, err := doc.MainInput()
+		if err != nil { // unlikely at this point
+			return nil, InputError("no main input specified", err, nil)
+		}
+		f, err := doc.GetResult()
+		if err != nil {
+			return nil, err
+		}
+		return []ResultFile{{doc.engine.Compiler().ResultFile(main), f}}, nil
+	}
+
+	doc.log.Debug("fetching results", xlog.String("format", doc.output.Format))
+	var names []string
+	if doc.output.Format == FormatHTML {
+		// make4ht copies all output files into htmlDir
+		root := path.Join(doc.workdir, htmlDir)
+		err := afero.Walk(doc.fs, root, func(name string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				names = append(names, strings.TrimPrefix(name, doc.workdir+"/"))
+			}
+			return err
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, CompilationError("failed to list output files", err, nil)
+		}
+	} else {
+		entries, err := afero.ReadDir(doc.fs, doc.workdir)
+		if err != nil {
+			return nil, CompilationError("failed to list output files", err, nil)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && doc.output.isOutputFile(entry.Name()) {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+
+	results := make([]ResultFile, 0, len(names))
+	for _, name := range names {
+		f, err := doc.fs.Open(path.Join(doc.workdir, name))
+		if err != nil {
+			for _, r := range results {
+				_ = r.Close()
+			}
+			return nil, CompilationError("failed to open output file for reading", err, KV{
+				"file": name,
+			})
+		}
+		if doc.output.Format == FormatHTML {
+			name = strings.TrimPrefix(name, htmlDir+"/")
+		} else {
+			name = strings.TrimPrefix(name, internalPrefix)
+		}
+		results = append(results, ResultFile{name, f})
+	}
+	if len(results) == 0 {
+		return nil, CompilationError("no output files", nil, KV{"format": doc.output.Format})
+	}
+	return results, nil
+}
+
+func (doc *document) GetArtifacts() ([]ResultFile, error) {
+	results := make([]ResultFile, 0, len(doc.output.Artifacts))
+	for _, name := range doc.output.Artifacts {
+		var file string
+		f, err := doc.openFile(func(main string) string {
+			file = artifactFile(doc.engine.Compiler(), name, main)
+			return file
+		})
+		if errors.Is(err, fs.ErrNotExist) {
+			doc.log.Debug("artifact not found", xlog.String("file", file))
+			continue
+		}
+		if err != nil {
+			for _, r := range results {
+				_ = r.Close()
+			}
+			return nil, err
+		}
+		results = append(results, ResultFile{file, f})
+	}
+	return results, nil
 }
 
 func (doc *document) GetLogs() (io.ReadCloser, error) {
 	doc.log.Debug("fetching logs")
-	return doc.openFile(".log")
+	return doc.openFile(doc.engine.Compiler().LogFile)
 }
 
 func cleanpath(name string) (clean string, ok bool) {
-	clean = path.Clean(name)
+	clean = path.Clean(toNFC(name))
 	if /* current directory */ clean == "." ||
 		/* forbidden file name */ isForbidden(name) ||
 		/* directory traversal */ strings.HasPrefix(clean, "..") ||
@@ -449,6 +764,9 @@ func isMainCandidate(name string) bool {
 }
 
 func (doc *document) Cleanup() error {
+	if doc.persistent {
+		return doc.removeInternalFiles()
+	}
 	if doc.workdir != "" {
 		if err := doc.fs.RemoveAll(doc.workdir); err != nil {
 			return InputError("cleanup failed", err, nil)
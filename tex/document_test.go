@@ -21,7 +21,7 @@ func TestFile_flags(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
 
-	subject := File{"", 0, 0}
+	subject := File{}
 	assert.False(subject.isCandidate())
 	assert.False(subject.hasDocumentClass())
 	assert.False(subject.hasTexdMark())
@@ -61,6 +61,7 @@ func testFileWriter(t *testing.T, s string, candidate bool) {
 		file: f,
 		wc:   &nopCloser{Writer: &buf},
 		buf:  make([]byte, 4),
+		scan: candidate,
 	}
 
 	n, err := subject.Write([]byte(s))
@@ -254,6 +255,8 @@ func TestDocument(t *testing.T) {
 	subject.addFile("chapter/bar.tex", `\chapter{A Bar Runs Into A Priest}`, 0)
 	require.True(subject.isDir("chapter"))
 	require.Len(subject.files, 4)
+	require.True(subject.HasFile("chapter/bar.tex"))
+	require.False(subject.HasFile("chapter/baz.tex"))
 
 	// try adding an invalid file
 	err = subject.AddFile("../O_o.tex", "")
@@ -374,3 +377,199 @@ func TestDocument_WorkingDirectory(t *testing.T) {
 	_, err = subject.WorkingDirectory()
 	require.Error(t, err)
 }
+
+func TestDocument_magicComments(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	subject := documentHelper{ //nolint:forcetypeassert
+		t:        t,
+		fs:       afero.Afero{Fs: afero.NewMemMapFs()},
+		document: NewDocument(xlog.NewDiscard(), DefaultEngine, "").(*document),
+	}
+	subject.document.fs = subject.fs
+
+	require.NoError(subject.AddFile("a.tex", "%!texd\n\\documentclass{article}"))
+	require.NoError(subject.AddFile("main.tex", "% !TEX program = lualatex\n% !BIB program = biber\n\\documentclass{book}"))
+	assert.Nil(subject.MagicComments()) // a.tex wins, without magic comments
+
+	// root declarations in sub directories are relative
+	require.NoError(subject.AddFile("chapters/intro.tex", "% !TEX root = ../main.tex\n\\chapter{Intro}"))
+	main, err := subject.MainInput()
+	require.NoError(err)
+	assert.Equal("main.tex", main)
+	assert.Equal(MagicComments{"engine": "lualatex", "bib": "biber"}, subject.MagicComments())
+
+	// conflicting declarations
+	require.NoError(subject.AddFile("chapters/outro.tex", "%!texd input=../a.tex"))
+	_, err = subject.MainInput()
+	assert.EqualError(err, "cannot determine main input file: conflicting magic comments")
+	assert.Nil(subject.MagicComments())
+
+	// explicit main input wins
+	require.NoError(subject.SetMainInput("a.tex"))
+	main, err = subject.MainInput()
+	require.NoError(err)
+	assert.Equal("a.tex", main)
+
+	// unknown file
+	other := NewDocument(xlog.NewDiscard(), DefaultEngine, "").(*document) //nolint:forcetypeassert
+	other.fs = afero.NewMemMapFs()
+	require.NoError(other.AddFile("a.tex", "% !TEX root = b.tex\n"))
+	_, err = other.MainInput()
+	assert.EqualError(err, "unknown main input file in magic comment")
+
+	// SetEngine
+	subject.SetEngine(NewEngine("foo"))
+	assert.Equal("foo", subject.Engine().Name())
+}
+
+func TestDocument_GetResults(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	subject := documentHelper{ //nolint:forcetypeassert
+		t:        t,
+		fs:       afero.Afero{Fs: afero.NewMemMapFs()},
+		document: NewDocument(xlog.NewDiscard(), DefaultEngine, "").(*document),
+	}
+	subject.document.fs = subject.fs
+	require.NoError(subject.AddFile("main.tex", `\documentclass{article}`))
+
+	readAll := func(results []ResultFile) map[string]string {
+		contents := make(map[string]string)
+		for _, r := range results {
+			b, err := io.ReadAll(r)
+			require.NoError(err)
+			require.NoError(r.Close())
+			contents[r.Name] = string(b)
+		}
+		return contents
+	}
+
+	// PDF output
+	_, err := subject.GetResults()
+	require.EqualError(err, "failed to open output file for reading: open "+subject.join("main.pdf")+": file does not exist")
+	require.NoError(subject.fs.WriteFile(subject.join("main.pdf"), []byte("%PDF"), o_rw))
+	results, err := subject.GetResults()
+	require.NoError(err)
+	require.Equal(map[string]string{"main.pdf": "%PDF"}, readAll(results))
+	require.Empty(subject.Steps())
+
+	// PNG output
+	subject.SetOutput(Output{Format: FormatPNG, DPI: 72})
+	require.Equal(FormatPNG, subject.Output().Format)
+	require.Len(subject.Steps(), 1)
+	_, err = subject.GetResults()
+	require.EqualError(err, "no output files")
+
+	for _, name := range []string{"_texd-page-01.png", "_texd-page-02.png", "_texd-page.svg"} {
+		require.NoError(subject.fs.WriteFile(subject.join(name), []byte(name), o_rw))
+	}
+	results, err = subject.GetResults()
+	require.NoError(err)
+	require.Equal(map[string]string{
+		"page-01.png": "_texd-page-01.png",
+		"page-02.png": "_texd-page-02.png",
+	}, readAll(results))
+}
+
+func TestDocument_GetResults_html(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	subject := documentHelper{ //nolint:forcetypeassert
+		t:        t,
+		fs:       afero.Afero{Fs: afero.NewMemMapFs()},
+		document: NewDocument(xlog.NewDiscard(), DefaultEngine, "").(*document),
+	}
+	subject.document.fs = subject.fs
+	require.NoError(subject.AddFile("main.tex", `\documentclass{article}`))
+	subject.SetOutput(Output{Format: FormatHTML})
+	require.Empty(subject.Steps())
+
+	_, err := subject.GetResults()
+	require.EqualError(err, "no output files")
+
+	for _, name := range []string{"main.html", "main.css", "img/logo.png"} {
+		require.NoError(subject.fs.MkdirAll(path.Dir(subject.join(htmlDir, name)), o_rwx))
+		require.NoError(subject.fs.WriteFile(subject.join(htmlDir, name), []byte(name), o_rw))
+	}
+	results, err := subject.GetResults()
+	require.NoError(err)
+
+	var names []string
+	for _, r := range results {
+		names = append(names, r.Name)
+		require.NoError(r.Close())
+	}
+	require.Equal([]string{"img/logo.png", "main.css", "main.html"}, names)
+}
+
+func TestDocument_GetResults_reproducible(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	subject := documentHelper{ //nolint:forcetypeassert
+		t:        t,
+		fs:       afero.Afero{Fs: afero.NewMemMapFs()},
+		document: NewDocument(xlog.NewDiscard(), DefaultEngine, "").(*document),
+	}
+	subject.document.fs = subject.fs
+	require.NoError(subject.AddFile("main.tex", `\documentclass{article}`))
+	require.Empty(subject.Environ())
+
+	output, err := Output{}.WithReproducible(42)
+	require.NoError(err)
+	subject.SetOutput(output)
+	require.Equal([]string{"FORCE_SOURCE_DATE=1", "SOURCE_DATE_EPOCH=42"}, subject.Environ())
+
+	const pdf = "%PDF\ntrailer << /ID [<0123456789abcdef> <fedcba9876543210>] >>\n"
+	require.NoError(subject.fs.WriteFile(subject.join("main.pdf"), []byte(pdf), o_rw))
+	results, err := subject.GetResults()
+	require.NoError(err)
+	require.Len(results, 1)
+
+	b, err := io.ReadAll(results[0])
+	require.NoError(err)
+	require.NoError(results[0].Close())
+	require.Len(b, len(pdf))
+	require.NotContains(string(b), "0123456789abcdef")
+}
+
+func TestDocument_GetArtifacts(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	subject := documentHelper{ //nolint:forcetypeassert
+		t:        t,
+		fs:       afero.Afero{Fs: afero.NewMemMapFs()},
+		document: NewDocument(xlog.NewDiscard(), DefaultEngine, "").(*document),
+	}
+	subject.document.fs = subject.fs
+	require.NoError(subject.AddFile("main.tex", `\documentclass{article}`))
+
+	results, err := subject.GetArtifacts()
+	require.NoError(err)
+	require.Empty(results)
+
+	output, err := Output{}.WithArtifacts("synctex,log,bbl")
+	require.NoError(err)
+	subject.SetOutput(output)
+	for _, name := range []string{"main.synctex.gz", "main.log"} {
+		require.NoError(subject.fs.WriteFile(subject.join(name), []byte(name), o_rw))
+	}
+
+	results, err = subject.GetArtifacts()
+	require.NoError(err)
+	var names []string
+	for _, r := range results {
+		b, err := io.ReadAll(r)
+		require.NoError(err)
+		require.NoError(r.Close())
+		require.Equal(r.Name, string(b))
+		names = append(names, r.Name)
+	}
+	require.Equal([]string{"main.synctex.gz", "main.log"}, names) // no main.bbl
+}
@@ -0,0 +1,253 @@
+package tex
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/digineo/xlog"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// detectEncoding enables transcoding of TeX and data files to UTF-8.
+var detectEncoding = false
+
+// SetEncodingDetection globally configures whether TeX and data files
+// (see Metrics) are converted to UTF-8 when they are written, and whether
+// file names are normalized to Unicode NFC.
+//
+// The source encoding is determined by a byte order mark (which is
+// removed), a magic comment ("%!texd encoding=latin1", TeX files only),
+// or, as fallback, by the first non-ASCII character: files, which aren't
+// valid UTF-8 at that point, are assumed to be encoded in Windows-1252
+// (a superset of ISO-8859-1). TeX files declaring a (non UTF-8) input
+// encoding with inputenc are left untouched.
+func SetEncodingDetection(enabled bool) {
+	detectEncoding = enabled
+}
+
+// EncodingDetection returns whether encoding detection is enabled.
+func EncodingDetection() bool {
+	return detectEncoding
+}
+
+// toNFC converts name to Unicode NFC, if encoding detection is enabled.
+// Some clients (notably on macOS) send decomposed file names, which don't
+// match the (usually composed) references in TeX files. It is applied to
+// all names passing through cleanpath, so that lookups match as well.
+func toNFC(name string) string {
+	if !detectEncoding {
+		return name
+	}
+	return norm.NFC.String(name)
+}
+
+// normalizeName is like toNFC, but logs the conversion.
+func normalizeName(log xlog.Logger, name string) string {
+	if nfc := toNFC(name); nfc != name {
+		log.Info("normalized file name",
+			xlog.String("filename", nfc),
+			xlog.String("original", name))
+		return nfc
+	}
+	return name
+}
+
+// byteOrderMarks maps BOMs to their encoding.
+var byteOrderMarks = []struct {
+	bom  []byte
+	name string
+	enc  encoding.Encoding
+}{
+	{[]byte{0xEF, 0xBB, 0xBF}, "utf-8", nil}, // already UTF-8, only strip the BOM
+	{[]byte{0xFE, 0xFF}, "utf-16be", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)},
+	{[]byte{0xFF, 0xFE}, "utf-16le", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)},
+}
+
+// transcoder converts its input to UTF-8, and passes the result to write.
+// It buffers the first KiB to look for a byte order mark and magic
+// comments. Without either, it passes ASCII text through until the first
+// non-ASCII character decides about the encoding.
+type transcoder struct {
+	log   xlog.Logger
+	write func([]byte) (int, error)
+	magic bool // whether to look for an encoding declaration
+
+	started bool
+	head    []byte // the first KiB, until started
+	tail    []byte // an incomplete rune, while undecided
+
+	decided bool
+	sink    io.Writer // destination after decision
+	flush   io.Closer // flushes sink, if transcoding
+}
+
+func newTranscoder(log xlog.Logger, write func([]byte) (int, error), magic bool) *transcoder {
+	return &transcoder{log: log, write: write, magic: magic}
+}
+
+// Write implements io.Writer.
+func (t *transcoder) Write(p []byte) (int, error) {
+	if !t.started {
+		t.head = append(t.head, p...)
+		if len(t.head) < guessLimit {
+			return len(p), nil
+		}
+		if err := t.start(false); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if err := t.convert(p, false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close flushes pending data. It does not close the destination.
+func (t *transcoder) Close() error {
+	var err error
+	if !t.started {
+		err = t.start(true)
+	} else if !t.decided {
+		err = t.convert(nil, true)
+	}
+	if err == nil && t.flush != nil {
+		err = t.flush.Close()
+	}
+	return err
+}
+
+// start evaluates the buffered head for a byte order mark or an encoding
+// declaration.
+func (t *transcoder) start(final bool) error {
+	head := t.head
+	t.started, t.head = true, nil
+
+	for _, b := range byteOrderMarks {
+		if bytes.HasPrefix(head, b.bom) {
+			t.log.Info("stripped byte order mark", xlog.String("encoding", b.name))
+			head = head[len(b.bom):]
+			t.decide(b.enc, b.name, "bom")
+			return t.convert(head, final)
+		}
+	}
+
+	if t.magic {
+		if name := declaredInputEncoding(head); name != "" {
+			// (pdf)LaTeX reads the file in the declared encoding, so
+			// transcoding would garble it
+			t.log.Info("keeping declared input encoding", xlog.String("encoding", name))
+			t.decide(nil, name, "inputenc")
+			return t.convert(head, final)
+		}
+		if name := parseMagicComments(head)[MagicEncoding]; name != "" {
+			enc, err := htmlindex.Get(name)
+			if err != nil {
+				t.log.Warn("ignoring unknown encoding", xlog.String("encoding", name))
+			} else {
+				t.decide(enc, name, "magic comment")
+			}
+		}
+	}
+	return t.convert(head, final)
+}
+
+// inputencPattern matches input encoding declarations, i.e.
+// \usepackage[latin1]{inputenc} and \inputencoding{latin1}.
+var inputencPattern = regexp.MustCompile(`\\(?:usepackage\s*\[([^\]]*)\]\s*\{inputenc\}|inputencoding\s*\{([^}]*)\})`)
+
+// declaredInputEncoding returns the first input encoding declared in
+// head, unless it is UTF-8.
+func declaredInputEncoding(head []byte) string {
+	s := bufio.NewScanner(bytes.NewReader(head))
+	for s.Scan() {
+		m := inputencPattern.FindStringSubmatch(stripComment(s.Text()))
+		if m == nil {
+			continue
+		}
+		// the last package option wins
+		opts := strings.Split(m[1]+m[2], ",")
+		switch name := strings.TrimSpace(opts[len(opts)-1]); name {
+		case "", "utf8", "utf8x":
+			return ""
+		default:
+			return name
+		}
+	}
+	return ""
+}
+
+// decide sets the source encoding. A nil enc means UTF-8.
+func (t *transcoder) decide(enc encoding.Encoding, name, reason string) {
+	t.decided = true
+	t.sink = writerFunc(t.write)
+	if enc == nil || enc == unicode.UTF8 {
+		return
+	}
+	t.log.Info("transcoding to UTF-8",
+		xlog.String("encoding", name),
+		xlog.String("reason", reason))
+	w := transform.NewWriter(t.sink, enc.NewDecoder())
+	t.sink, t.flush = w, w
+}
+
+// convert writes p, or its UTF-8 representation, to the destination.
+// While undecided, p is checked for non-ASCII characters. Incomplete
+// runes at the end of p are retained, unless final is set.
+func (t *transcoder) convert(p []byte, final bool) error {
+	if t.decided {
+		_, err := t.sink.Write(p)
+		return err
+	}
+
+	if len(t.tail) > 0 {
+		p = append(t.tail, p...)
+		t.tail = nil
+	}
+	i := bytes.IndexFunc(p, func(r rune) bool { return r >= utf8.RuneSelf })
+	if i < 0 {
+		_, err := t.write(p)
+		return err
+	}
+	if _, err := t.write(p[:i]); err != nil {
+		return err
+	}
+	p = p[i:]
+	if !final && !utf8.FullRune(p) {
+		t.tail = bytes.Clone(p)
+		return nil
+	}
+	if isUTF8(p, final) {
+		t.decide(nil, "utf-8", "detected")
+	} else {
+		t.decide(charmap.Windows1252, "windows-1252", "detected")
+	}
+	_, err := t.sink.Write(p)
+	return err
+}
+
+// isUTF8 reports whether p is valid UTF-8. An incomplete rune at the end
+// of p is accepted, unless final is set.
+func isUTF8(p []byte, final bool) bool {
+	for len(p) > 0 {
+		r, n := utf8.DecodeRune(p)
+		if r == utf8.RuneError && n == 1 {
+			return !final && !utf8.FullRune(p)
+		}
+		p = p[n:]
+	}
+	return true
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
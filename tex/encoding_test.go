@@ -0,0 +1,99 @@
+package tex
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/digineo/xlog"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscoder(t *testing.T) {
+	t.Parallel()
+
+	preamble := strings.Repeat("% ascii only\n", 100) // exceeds guessLimit
+
+	for name, tc := range map[string]struct {
+		input    string
+		magic    bool
+		expected string
+	}{
+		"ascii":            {"hello", false, "hello"},
+		"utf-8":            {preamble + "Grüße", false, preamble + "Grüße"},
+		"latin-1":          {preamble + "Gr\xfc\xdfe", false, preamble + "Grüße"},
+		"windows-1252":     {"\x84quoted\x93 \x80", false, "„quoted“ €"},
+		"short latin-1":    {"\xe9", false, "é"},
+		"utf-8 bom":        {"\xef\xbb\xbf%!texd\nGrüße", false, "%!texd\nGrüße"},
+		"utf-16le bom":     {"\xff\xfeG\x00r\x00\xfc\x00", false, "Grü"},
+		"utf-16be bom":     {"\xfe\xff\x00G\x00r\x00\xfc", false, "Grü"},
+		"magic latin-1":    {"%!texd encoding=latin1\n\xc3\xa9", true, "%!texd encoding=latin1\nÃ©"},
+		"magic ignored":    {"%!texd encoding=latin1\n\xc3\xa9", false, "%!texd encoding=latin1\né"},
+		"magic unknown":    {"%!texd encoding=klingon\n\xe9", true, "%!texd encoding=klingon\né"},
+		"magic overridden": {"\xef\xbb\xbf%!texd encoding=latin1\n\xc3\xa9", true, "%!texd encoding=latin1\né"},
+		"inputenc latin-1": {"\\usepackage[latin1]{inputenc}\n\xe9", true, "\\usepackage[latin1]{inputenc}\n\xe9"},
+		"inputenc magic":   {"%!texd encoding=latin1\n\\usepackage[T1]{fontenc}\\usepackage[utf8,ansinew]{inputenc}\n\xe9", true, "%!texd encoding=latin1\n\\usepackage[T1]{fontenc}\\usepackage[utf8,ansinew]{inputenc}\n\xe9"},
+		"inputencoding":    {"\\inputencoding{latin9}\xe9", true, "\\inputencoding{latin9}\xe9"},
+		"inputenc utf-8":   {"\\usepackage[utf8]{inputenc}\n\xe9", true, "\\usepackage[utf8]{inputenc}\né"},
+		"inputenc comment": {"% \\usepackage[latin1]{inputenc}\n\xe9", true, "% \\usepackage[latin1]{inputenc}\né"},
+		"inputenc data":    {"\\usepackage[latin1]{inputenc}\n\xe9", false, "\\usepackage[latin1]{inputenc}\né"},
+	} {
+		for _, chunkSize := range []int{1, 3, 4096} {
+			var buf bytes.Buffer
+			subject := newTranscoder(xlog.NewDiscard(), buf.Write, tc.magic)
+			for in := []byte(tc.input); len(in) > 0; {
+				n, err := subject.Write(in[:min(chunkSize, len(in))])
+				require.NoError(t, err)
+				in = in[n:]
+			}
+			require.NoError(t, subject.Close())
+			assert.Equal(t, tc.expected, buf.String(), "%s (chunk size %d)", name, chunkSize)
+		}
+	}
+}
+
+func TestDocument_encodingDetection(t *testing.T) {
+	SetEncodingDetection(true)
+	t.Cleanup(func() { SetEncodingDetection(false) })
+
+	doc := NewDocument(xlog.NewDiscard(), DefaultEngine, "").(*document) //nolint:forcetypeassert
+	doc.fs = afero.NewMemMapFs()
+	wd, err := doc.WorkingDirectory()
+	require.NoError(t, err)
+
+	read := func(name string) string {
+		t.Helper()
+		f, err := doc.fs.Open(wd + "/" + name)
+		require.NoError(t, err)
+		defer f.Close()
+		contents, err := io.ReadAll(f)
+		require.NoError(t, err)
+		return string(contents)
+	}
+
+	// decomposed file name
+	require.NoError(t, doc.AddFile("Gru\u0308n.tex", "\xef\xbb\xbf%!texd\n\\input{data.csv} % grün"))
+	require.NoError(t, doc.AddFile("data.csv", "gr\xfcn;gelb\n"))
+	require.NoError(t, doc.AddFile("image.png", "\x89PNG\xfc"))
+
+	assert.Contains(t, doc.files, "Grün.tex")
+	assert.True(t, doc.files["Grün.tex"].hasTexdMark())
+	assert.Equal(t, "%!texd\n\\input{data.csv} % grün", read("Grün.tex"))
+	assert.Equal(t, "grün;gelb\n", read("data.csv"))
+	assert.Equal(t, "\x89PNG\xfc", read("image.png"))
+
+	// lookups with decomposed names
+	assert.True(t, doc.HasFile("Gru\u0308n.tex"))
+	require.NoError(t, doc.SetMainInput("Gru\u0308n.tex"))
+	assert.Equal(t, "Grün.tex", doc.mainInput)
+	names, err := ParseFileList("Gru\u0308n.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Grün.pdf"}, names)
+
+	SetEncodingDetection(false)
+	require.NoError(t, doc.AddFile("legacy.tex", "gr\xfcn"))
+	assert.Equal(t, "gr\xfcn", read("legacy.tex"))
+}
@@ -0,0 +1,114 @@
+package tex
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// A Secret is a confidential value, e.g. a password. It is redacted when
+// formatted, marshaled, or logged.
+type Secret string
+
+const redacted = "[redacted]"
+
+func (Secret) String() string               { return redacted }
+func (Secret) GoString() string             { return redacted }
+func (Secret) MarshalText() ([]byte, error) { return []byte(redacted), nil }
+func (Secret) LogValue() slog.Value         { return slog.StringValue(redacted) }
+
+// Permissions clients may grant for encrypted documents.
+const (
+	PermissionPrint  = "print"  // print in high resolution
+	PermissionCopy   = "copy"   // extract text and images
+	PermissionModify = "modify" // modify, annotate, fill forms, assemble
+)
+
+// Permissions lists all known permissions.
+var Permissions = []string{PermissionPrint, PermissionCopy, PermissionModify}
+
+// Encryption configures the encryption of the result PDF (256-bit AES).
+// Permissions not listed are denied.
+type Encryption struct {
+	UserPassword  Secret   `json:"user_password"`
+	OwnerPassword Secret   `json:"owner_password"`
+	Permissions   []string `json:"permissions"`
+}
+
+// Validate checks the permissions and passwords. Passwords can't contain
+// line breaks, and an empty owner password is replaced with a random one
+// (since encryption without owner password is insecure).
+func (e *Encryption) Validate() error {
+	for _, p := range e.Permissions {
+		if !slices.Contains(Permissions, p) {
+			return fmt.Errorf("unsupported permission: %q", p)
+		}
+	}
+	for _, pw := range []Secret{e.UserPassword, e.OwnerPassword} {
+		if strings.ContainsAny(string(pw), "\r\n") {
+			return fmt.Errorf("passwords must not contain line breaks")
+		}
+	}
+	if e.OwnerPassword == "" {
+		e.OwnerPassword = Secret(rand.Text())
+	}
+	return nil
+}
+
+// WithEncryption returns a copy of o, which encrypts the result PDF.
+// Encryption is only supported for PDF output, and can't be combined
+// with signatures or the pdfa post-processor (PDF/A forbids encryption).
+func (o Output) WithEncryption(e *Encryption) (Output, error) {
+	if !o.IsPDF() {
+		return o, fmt.Errorf("encryption is not supported for format %q", o.Format)
+	}
+	if o.Signature != nil {
+		return o, fmt.Errorf("encrypting signed documents is not supported")
+	}
+	if slices.Contains(o.PostProcess, "pdfa") {
+		return o, fmt.Errorf(`encryption can't be combined with post-processor "pdfa"`)
+	}
+	if o.Reproducible {
+		return o, fmt.Errorf("encryption can't be combined with reproducible builds")
+	}
+	if err := e.Validate(); err != nil {
+		return o, err
+	}
+	o.Encryption = e
+	return o, nil
+}
+
+// encryptStep returns the qpdf invocation encrypting the PDF file in.
+// The arguments are passed in a file (see Step.Secrets), to keep the
+// passwords off command lines, logs, and error messages.
+func (e *Encryption) encryptStep(in string, linearize bool) Step {
+	out := internalPrefix + "encrypt.pdf"
+	argsFile := internalPrefix + "encrypt.args"
+
+	args := []string{"--encrypt", string(e.UserPassword), string(e.OwnerPassword), "256"}
+	if !slices.Contains(e.Permissions, PermissionPrint) {
+		args = append(args, "--print=none")
+	}
+	if !slices.Contains(e.Permissions, PermissionCopy) {
+		args = append(args, "--extract=n")
+	}
+	if !slices.Contains(e.Permissions, PermissionModify) {
+		args = append(args, "--modify=none")
+	}
+	args = append(args, "--")
+	if linearize {
+		// encryption rewrites the file, keep it linearized
+		args = append(args, "--linearize")
+	}
+	args = append(args, in, out)
+
+	return Step{
+		Name:    "encrypt",
+		Cmd:     []string{"qpdf", "@" + argsFile},
+		Input:   in,
+		Output:  out,
+		Secrets: map[string]Secret{argsFile: Secret(strings.Join(args, "\n") + "\n")},
+	}
+}
@@ -0,0 +1,78 @@
+package tex
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecret(t *testing.T) {
+	t.Parallel()
+
+	step := Step{Name: "encrypt", Secrets: map[string]Secret{"args": "hunter2"}}
+
+	assert.NotContains(t, fmt.Sprintf("%v %+v %#v %s", step, step, step, step.Secrets["args"]), "hunter2")
+
+	buf, err := json.Marshal(step)
+	require.NoError(t, err)
+	assert.NotContains(t, string(buf), "hunter2")
+
+	var log bytes.Buffer
+	slog.New(slog.NewJSONHandler(&log, nil)).Info("test", "step", step, "secret", step.Secrets["args"])
+	slog.New(slog.NewTextHandler(&log, nil)).Info("test", "step", step, "secret", step.Secrets["args"])
+	assert.NotContains(t, log.String(), "hunter2")
+	assert.Contains(t, log.String(), redacted)
+}
+
+func TestEncryption_Validate(t *testing.T) {
+	t.Parallel()
+
+	e := Encryption{UserPassword: "user", Permissions: []string{"print"}}
+	require.NoError(t, e.Validate())
+	assert.NotEmpty(t, e.OwnerPassword, "random owner password")
+
+	e = Encryption{Permissions: []string{"print", "fill"}}
+	assert.EqualError(t, e.Validate(), `unsupported permission: "fill"`)
+
+	e = Encryption{UserPassword: "a\nb"}
+	assert.EqualError(t, e.Validate(), "passwords must not contain line breaks")
+}
+
+func TestOutput_WithEncryption(t *testing.T) {
+	t.Parallel()
+
+	_, err := Output{Format: FormatSVG}.WithEncryption(&Encryption{})
+	assert.EqualError(t, err, `encryption is not supported for format "svg"`)
+	_, err = Output{PostProcess: []string{"pdfa"}}.WithEncryption(&Encryption{})
+	assert.EqualError(t, err, `encryption can't be combined with post-processor "pdfa"`)
+
+	o, err := Output{}.WithPostProcess("linearize")
+	require.NoError(t, err)
+	o, err = o.WithEncryption(&Encryption{
+		UserPassword:  "1990-01-31",
+		OwnerPassword: "owner",
+		Permissions:   []string{"print"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "_texd-encrypt.pdf", o.ResultFile("main.pdf"))
+
+	steps := o.steps("main.pdf")
+	require.Len(t, steps, 2)
+	assert.Equal(t, Step{
+		Name:   "encrypt",
+		Cmd:    []string{"qpdf", "@_texd-encrypt.args"},
+		Input:  "_texd-linearize.pdf",
+		Output: "_texd-encrypt.pdf",
+		Secrets: map[string]Secret{"_texd-encrypt.args": Secret(strings.Join([]string{
+			"--encrypt", "1990-01-31", "owner", "256",
+			"--extract=n", "--modify=none", "--",
+			"--linearize", "_texd-linearize.pdf", "_texd-encrypt.pdf",
+		}, "\n") + "\n")},
+	}, steps[1])
+}
@@ -2,29 +2,59 @@ package tex
 
 import (
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
 )
 
 type Engine struct {
-	name  string
-	flags []string
+	name     string
+	flags    []string
+	compiler Compiler
 }
 
+// NewEngine creates an engine, which compiles documents with latexmk.
 func NewEngine(name string, latexmkFlags ...string) Engine {
-	return Engine{name: name, flags: latexmkFlags}
+	return Engine{name: name, flags: latexmkFlags, compiler: Latexmk}
+}
+
+// NewCompilerEngine creates an engine, which compiles documents with the
+// given compiler.
+func NewCompilerEngine(name string, compiler Compiler, flags ...string) Engine {
+	return Engine{name: name, flags: flags, compiler: compiler}
 }
 
 func (e Engine) Name() string   { return e.name }
 func (e Engine) String() string { return e.name }
+
+// Compiler returns the engine's compiler, which defaults to Latexmk.
+func (e Engine) Compiler() Compiler {
+	if e.compiler == nil {
+		return Latexmk
+	}
+	return e.compiler
+}
+
+// Flags returns the flags passed to the compiler, including flags
+// reflecting the shell escaping mode.
 func (e Engine) Flags() []string {
-	switch shellEscaping {
-	case RestrictedShellEscape:
-		return e.flags
-	case AllowedShellEscape:
-		return append([]string{"-shell-escape"}, e.flags...)
-	case ForbiddenShellEscape:
-		return append([]string{"-no-shell-escape"}, e.flags...)
+	return e.Compiler().Flags(e.flags)
+}
+
+// Command builds the command line to compile the given main input file.
+func (e Engine) Command(main string) []string {
+	return e.Compiler().Command(e.Flags(), main)
+}
+
+// WithOptions returns a copy of the engine, whose flags additionally
+// reflect the given per-document options.
+func (e Engine) WithOptions(opts Options) (Engine, error) {
+	flags, err := e.Compiler().OptionFlags(opts)
+	if err != nil || len(flags) == 0 {
+		return e, err
 	}
-	panic("not reached")
+	e.flags = append(slices.Clip(e.flags), flags...)
+	return e, nil
 }
 
 var (
@@ -67,25 +97,189 @@ func (err ErrUnsupportedEngine) Error() string {
 	return fmt.Sprintf("unsupported TeX engine: %q", string(err))
 }
 
+// enginePattern restricts the names of custom engines.
+var enginePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// latexmkFlagPatterns is an allow-list for latexmk flags in custom engine
+// definitions. Notably absent are -e and -r (which allow injecting Perl
+// code), -outdir, -auxdir and -jobname (which would break result
+// retrieval), as well as -shell-escape (see SetShellEscaping).
+var latexmkFlagPatterns = []*regexp.Regexp{
+	// output formats and processing chains
+	regexp.MustCompile(`^-(dvi|dvi-|ps|ps-|pdf|pdf-|pdfdvi|pdfps|pdfxe|pdflua|xdv|dvilua)$`),
+	// engine commands (further restricted by validEngineCommand)
+	engineCommandPattern,
+	// bibliography handling
+	regexp.MustCompile(`^-(bibtex|bibtex-|bibtex-cond|bibtex-cond1|bibfudge|bibfudge-)$`),
+	// options passed through to the engine
+	regexp.MustCompile(`^-(file-line-error|halt-on-error|recorder|recorder-|8bit)$`),
+	regexp.MustCompile(`^-synctex=-?[0-9]+$`),
+	regexp.MustCompile(`^-interaction=(batchmode|nonstopmode|scrollmode|errorstopmode)$`),
+}
+
+// engineCommandPattern matches latexmk flags redefining the command of
+// an engine.
+var engineCommandPattern = regexp.MustCompile(`^-(latex|pdflatex|xelatex|lualatex)=(.*)$`)
+
+// engineBinaries are the TeX programs engine commands may run.
+var engineBinaries = []string{
+	"latex", "pdflatex", "xelatex", "lualatex", "dvilualatex",
+	"platex", "uplatex", "eptex", "euptex",
+}
+
+// engineCommandOptions is an allow-list for the options in engine
+// commands. %O and %S are replaced by latexmk with its options and the
+// source file, respectively.
+var engineCommandOptions = []*regexp.Regexp{
+	regexp.MustCompile(`^%[OS]$`),
+	regexp.MustCompile(`^-(file-line-error|halt-on-error|recorder|8bit)$`),
+	regexp.MustCompile(`^-synctex=-?[0-9]+$`),
+	regexp.MustCompile(`^-interaction=(batchmode|nonstopmode|scrollmode|errorstopmode)$`),
+	regexp.MustCompile(`^-kanji(-internal)?=(utf8|euc|sjis|jis|uptex)$`),
+	regexp.MustCompile(`^-output-format=(dvi|pdf)$`),
+}
+
+// shellEscapeOptions enable shell escaping in TeX programs, which is only
+// controlled by SetShellEscaping.
+var shellEscapeOptions = []string{"shell-escape", "shell-restricted", "enable-write18"}
+
+// validEngineCommand reports whether cmd (the value of an engine command
+// flag) runs a known TeX program with allowed options only.
+func validEngineCommand(cmd string) bool {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 || !slices.Contains(engineBinaries, fields[0]) {
+		return false
+	}
+	for _, opt := range fields[1:] {
+		if slices.Contains(shellEscapeOptions, strings.TrimLeft(opt, "-")) {
+			return false
+		}
+		if !slices.ContainsFunc(engineCommandOptions, func(re *regexp.Regexp) bool { return re.MatchString(opt) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateLatexmkFlags ensures that each flag matches a known and safe
+// latexmk option pattern.
+func ValidateLatexmkFlags(flags []string) error {
+	return Latexmk.ValidateFlags(flags)
+}
+
+// compilerPrefix matches an optional compiler name in engine definitions.
+var compilerPrefix = regexp.MustCompile(`^\s*([a-z]+):`)
+
+// ParseEngineDefinition parses a custom engine definition of the form
+// "name=[compiler:]flags", where flags is a space separated list of
+// compiler flags. The compiler defaults to "latexmk". Flags containing
+// spaces can be quoted with single or double quotes:
+//
+//	uplatex=-pdfdvi "-latex=uplatex -kanji=utf8 %O %S"
+//	tectonic=tectonic:--only-cached
+//
+// The name and the flags are validated (see Compiler.ValidateFlags).
+func ParseEngineDefinition(def string) (Engine, error) {
+	name, rawFlags, ok := strings.Cut(def, "=")
+	if !ok {
+		return Engine{}, fmt.Errorf("invalid engine definition %q: expected name=flags", def)
+	}
+	name = strings.TrimSpace(name)
+	if !enginePattern.MatchString(name) {
+		return Engine{}, fmt.Errorf("invalid engine definition %q: invalid name", def)
+	}
+
+	compiler := Latexmk
+	if m := compilerPrefix.FindStringSubmatch(rawFlags); m != nil {
+		c, err := ParseCompiler(m[1])
+		if err != nil {
+			return Engine{}, fmt.Errorf("invalid engine definition %q: %w", def, err)
+		}
+		compiler = c
+		rawFlags = rawFlags[len(m[0]):]
+	}
+
+	flags, err := splitFlags(rawFlags)
+	if err != nil {
+		return Engine{}, fmt.Errorf("invalid engine definition %q: %w", def, err)
+	}
+	if len(flags) == 0 && compiler == Latexmk {
+		return Engine{}, fmt.Errorf("invalid engine definition %q: no flags given", def)
+	}
+	if err := compiler.ValidateFlags(flags); err != nil {
+		return Engine{}, fmt.Errorf("invalid engine definition %q: %w", def, err)
+	}
+	return NewCompilerEngine(name, compiler, flags...), nil
+}
+
+// splitFlags splits s at white space, but keeps quoted parts together.
+func splitFlags(s string) (flags []string, err error) {
+	var (
+		cur     strings.Builder
+		quote   rune
+		inField bool
+	)
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inField = r, true
+		case r == ' ' || r == '\t':
+			if inField {
+				flags = append(flags, cur.String())
+				cur.Reset()
+				inField = false
+			}
+		default:
+			cur.WriteRune(r)
+			inField = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inField {
+		flags = append(flags, cur.String())
+	}
+	return flags, nil
+}
+
+// AddEngine makes a custom engine available. If an engine with the
+// same name already exists, it is replaced. The engine's flags must
+// be valid for the engine's compiler.
+//
+// Note that DefaultEngine is not updated, call SetDefaultEngine after
+// adding all custom engines.
+func AddEngine(engine Engine) error {
+	if !enginePattern.MatchString(engine.name) {
+		return ErrUnsupportedEngine(engine.name)
+	}
+	if err := engine.Compiler().ValidateFlags(engine.flags); err != nil {
+		return err
+	}
+	for i := range engines {
+		if engines[i].name == engine.name {
+			engines[i] = engine
+			return nil
+		}
+	}
+	engines = append(engines, engine)
+	return nil
+}
+
 var LatexmkDefaultFlags = []string{
 	"-cd",           // change to directory
 	"-silent",       // reduce diagnostics and run engine with -interaction=batchmode
 	"-pv-", "-pvc-", // turn off (continuous) file previewing
 }
 
-// LatexmkCmd builds a command line for latexmk invocation.
+// LatexmkCmd builds a command line for latexmk invocation, regardless
+// of the engine's compiler. Use Command() to respect the compiler.
 func (e Engine) LatexmkCmd(main string) []string {
-	lenDefaults := len(LatexmkDefaultFlags)
-	flags := e.Flags()
-	lenFlags := len(flags)
-
-	cmd := make([]string, 1+lenDefaults+lenFlags+1)
-	cmd[0] = "latexmk"
-	copy(cmd[1:], LatexmkDefaultFlags)
-	copy(cmd[1+lenDefaults:], flags)
-	cmd[1+lenDefaults+lenFlags] = main
-
-	return cmd
+	return Latexmk.Command(Latexmk.Flags(e.flags), main)
 }
 
 type ShellEscape int
@@ -59,3 +59,121 @@ func TestSetShellEscape(t *testing.T) {
 	require.EqualError(SetShellEscaping(maxShellEscape), "unexpected shell escaping value: 3")
 	require.EqualError(SetShellEscaping(maxShellEscape+1), "unexpected shell escaping value: 4")
 }
+
+func TestValidateLatexmkFlags(t *testing.T) {
+	t.Parallel()
+
+	for _, flag := range []string{
+		"-pdf", "-pdfdvi", "-pdfxe", "-pdflua", "-dvi", "-ps-",
+		"-latex=uplatex", "-latex=platex -kanji=utf8 %O %S",
+		"-pdflatex=pdflatex -file-line-error -synctex=1 %O %S",
+		"-bibtex", "-bibtex-cond", "-halt-on-error", "-synctex=1",
+		"-interaction=nonstopmode",
+	} {
+		assert.NoError(t, ValidateLatexmkFlags([]string{flag}), flag)
+	}
+
+	for _, flag := range []string{
+		"", "pdf", "-e", "-r", "-shell-escape", "-outdir=/tmp", "-jobname=x",
+		"-latex=uplatex; rm -rf /", "-latex=$(id)", "-latex=`id`",
+		"-latex=a|b", "-interaction=foo", "-synctex=x",
+		"-latex=", "-latex=sh -c id", "-latex=/usr/bin/pdflatex",
+		"-pdflatex=pdflatex -shell-escape %O %S", "-pdflatex=pdflatex --shell-escape %O %S",
+		"-lualatex=lualatex -enable-write18 %O %S", "-xelatex=xelatex -shell-restricted %O %S",
+		"-latex=uplatex -output-directory=/tmp %O %S", "-latex=uplatex %O %S extra.tex",
+	} {
+		assert.EqualError(t, ValidateLatexmkFlags([]string{"-pdf", flag}),
+			(&ErrInvalidFlag{"latexmk", flag}).Error(), flag)
+	}
+}
+
+func TestParseEngineDefinition(t *testing.T) {
+	t.Parallel()
+
+	for def, expected := range map[string]Engine{
+		"uplatex=-pdfdvi -latex=uplatex": NewEngine("uplatex", "-pdfdvi", "-latex=uplatex"),
+		"tectonic=tectonic:":             NewCompilerEngine("tectonic", Tectonic),
+		"tt=tectonic: --only-cached":     NewCompilerEngine("tt", Tectonic, "--only-cached"),
+		"lmk=latexmk:-pdf":               NewEngine("lmk", "-pdf"),
+		`platex= -pdfdvi  "-latex=platex -kanji=utf8 %O %S" `: NewEngine("platex",
+			"-pdfdvi", "-latex=platex -kanji=utf8 %O %S"),
+		"lualatex=-pdflua -synctex=1": NewEngine("lualatex", "-pdflua", "-synctex=1"),
+		"dvi='-dvi'":                  NewEngine("dvi", "-dvi"),
+	} {
+		actual, err := ParseEngineDefinition(def)
+		require.NoError(t, err, def)
+		assert.Equal(t, expected, actual, def)
+	}
+
+	for def, msg := range map[string]string{
+		"uplatex":                      "expected name=flags",
+		"=-pdf":                        "invalid name",
+		"Foo=-pdf":                     "invalid name",
+		"foo=":                         "no flags given",
+		`foo="-pdf`:                    "unterminated quote",
+		"foo=-pdf -e 'system'":         `invalid or forbidden latexmk flag: "-e"`,
+		"foo=context:--batch":          `unsupported compiler: "context"`,
+		"foo=tectonic:-Z shell-escape": `invalid or forbidden tectonic flag: "-Z"`,
+	} {
+		_, err := ParseEngineDefinition(def)
+		require.Error(t, err, def)
+		assert.Contains(t, err.Error(), msg, def)
+	}
+}
+
+func TestAddEngine(t *testing.T) {
+	orig := append([]Engine(nil), engines...)
+	t.Cleanup(func() { engines = orig })
+
+	require.NoError(t, AddEngine(NewEngine("uplatex", "-pdfdvi", "-latex=uplatex")))
+	require.NoError(t, AddEngine(NewEngine("pdflatex", "-pdf", "-halt-on-error")))
+	assert.Equal(t, []string{"xelatex", "pdflatex", "lualatex", "uplatex"}, SupportedEngines())
+
+	e, err := ParseEngine("pdflatex")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-pdf", "-halt-on-error"}, e.flags)
+
+	assert.EqualError(t, AddEngine(NewEngine("Bad")), `unsupported TeX engine: "Bad"`)
+	assert.EqualError(t, AddEngine(NewEngine("bad", "-e")), `invalid or forbidden latexmk flag: "-e"`)
+	assert.Len(t, SupportedEngines(), 4)
+}
+
+func TestEngine_WithOptions(t *testing.T) {
+	t.Parallel()
+
+	withOptions := func(e Engine, opts Options) Engine {
+		t.Helper()
+		e, err := e.WithOptions(opts)
+		require.NoError(t, err)
+		return e
+	}
+
+	engine := NewEngine("noname", "-pdf")
+	assert.Equal(t, engine, withOptions(engine, Options{}))
+
+	strict := withOptions(engine, Options{Bib: "biber", Strict: true})
+	assert.Equal(t, []string{"-pdf", "-e", findToolConfig("biber"), "-halt-on-error"}, strict.flags)
+	assert.Equal(t, []string{"-pdf"}, engine.flags) // unchanged
+
+	none := withOptions(engine, Options{Bib: "none", Tools: []string{"makeindex"}})
+	assert.Equal(t, []string{"-pdf", "-bibtex-", "-e", findToolConfig("makeindex")}, none.flags)
+	assert.Equal(t, []string{
+		"latexmk", "-cd", "-silent", "-pv-", "-pvc-",
+		"-pdf", "-bibtex-", "-e", findToolConfig("makeindex"), "main.tex",
+	}, none.LatexmkCmd("main.tex")[:10])
+
+	_, err := engine.WithOptions(Options{Bib: "none", Tools: []string{"biber"}})
+	assert.EqualError(t, err, `conflicting options: bib=none and tool "biber"`)
+	_, err = engine.WithOptions(Options{Bib: "bibtex", Tools: []string{"biber"}})
+	assert.EqualError(t, err, `conflicting tools: "biber" and "bibtex"`)
+
+	tectonic := NewCompilerEngine("tt", Tectonic)
+	assert.Equal(t, tectonic, withOptions(tectonic, Options{Bib: "biber", Strict: true}))
+	_, err = tectonic.WithOptions(Options{Tools: []string{"makeglossaries"}})
+	assert.EqualError(t, err, `tool "makeglossaries" is not supported by tectonic`)
+}
+
+func findToolConfig(name string) string {
+	t, _ := findTool(name)
+	return t.Config
+}
@@ -0,0 +1,187 @@
+package tex
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// An EnvVar is an environment variable clients may set for a job, e.g.
+// to select the locale or time zone for \today.
+type EnvVar struct {
+	Name string
+
+	// Validate checks the value.
+	Validate func(value string) error
+}
+
+// maxEnvValueLength limits the length of environment variable values.
+const maxEnvValueLength = 256
+
+var (
+	localePattern = regexp.MustCompile(`^[A-Za-z0-9_.@:/,+-]*$`)
+	epochPattern  = regexp.MustCompile(`^[0-9]{1,19}$`)
+	dirPattern    = regexp.MustCompile(`^[A-Za-z0-9_.+-]+$`)
+)
+
+func validateLocale(value string) error {
+	if !localePattern.MatchString(value) {
+		return fmt.Errorf("invalid characters")
+	}
+	return nil
+}
+
+func validateEpoch(value string) error {
+	if !epochPattern.MatchString(value) {
+		return fmt.Errorf("expected Unix timestamp")
+	}
+	return nil
+}
+
+func validateFlag(value string) error {
+	if value != "0" && value != "1" {
+		return fmt.Errorf("expected 0 or 1")
+	}
+	return nil
+}
+
+// validateRelPath accepts a path relative to the working directory,
+// optionally with trailing slashes (kpathsea searches subdirectories
+// for "dir//"). Absolute paths, parent directories and kpathsea
+// expansions ($VAR, ~, {a,b}, !!) are rejected, so jobs can't access
+// files outside their working directory.
+func validateRelPath(value string) error {
+	for elem := range strings.SplitSeq(strings.TrimRight(value, "/"), "/") {
+		if elem == ".." || !dirPattern.MatchString(elem) {
+			return fmt.Errorf("expected relative path in working directory")
+		}
+	}
+	return nil
+}
+
+// validatePathList accepts a colon separated list of relative paths (see
+// validateRelPath). Empty elements are retained, since they expand to the
+// default search path.
+func validatePathList(value string) error {
+	for elem := range strings.SplitSeq(value, ":") {
+		if elem == "" {
+			continue
+		}
+		if err := validateRelPath(elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var envVars = []EnvVar{
+	{Name: "TZ", Validate: validateLocale},
+	{Name: "LANG", Validate: validateLocale},
+	{Name: "LANGUAGE", Validate: validateLocale},
+	{Name: "LC_ALL", Validate: validateLocale},
+	{Name: "LC_COLLATE", Validate: validateLocale},
+	{Name: "LC_CTYPE", Validate: validateLocale},
+	{Name: "LC_TIME", Validate: validateLocale},
+	{Name: "SOURCE_DATE_EPOCH", Validate: validateEpoch},
+	{Name: "FORCE_SOURCE_DATE", Validate: validateFlag},
+	{Name: "TEXINPUTS", Validate: validatePathList},
+	{Name: "BIBINPUTS", Validate: validatePathList},
+	{Name: "BSTINPUTS", Validate: validatePathList},
+	{Name: "TEXMFVAR", Validate: validateRelPath},
+}
+
+// allowedEnvVars restricts the environment variables clients may set.
+var allowedEnvVars = SupportedEnvVars()
+
+// SupportedEnvVars lists the names of all known environment variables.
+func SupportedEnvVars() (names []string) {
+	for _, v := range envVars {
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+// AllowedEnvVars lists the names of environment variables clients may set.
+func AllowedEnvVars() []string {
+	return slices.Clone(allowedEnvVars)
+}
+
+// SetAllowedEnvVars globally restricts the environment variables clients
+// may set.
+func SetAllowedEnvVars(names []string) error {
+	for _, name := range names {
+		if _, ok := findEnvVar(name); !ok {
+			return ErrUnsupportedEnvVar(name)
+		}
+	}
+	allowedEnvVars = slices.Clone(names)
+	return nil
+}
+
+type ErrUnsupportedEnvVar string
+
+func (err ErrUnsupportedEnvVar) Error() string {
+	return fmt.Sprintf("unsupported environment variable: %q", string(err))
+}
+
+func findEnvVar(name string) (EnvVar, bool) {
+	for _, v := range envVars {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return EnvVar{}, false
+}
+
+// ParseEnv parses a list of "NAME=value" definitions. Each variable must
+// be allowed (see SetAllowedEnvVars), and may only be defined once.
+func ParseEnv(defs []string) (map[string]string, error) {
+	if len(defs) == 0 {
+		return nil, nil
+	}
+	env := make(map[string]string, len(defs))
+	for _, def := range defs {
+		name, value, ok := strings.Cut(def, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid environment variable %q: expected NAME=value", def)
+		}
+		v, ok := findEnvVar(name)
+		if !ok || !slices.Contains(allowedEnvVars, name) {
+			return nil, ErrUnsupportedEnvVar(name)
+		}
+		if _, dup := env[name]; dup {
+			return nil, fmt.Errorf("duplicate environment variable %q", name)
+		}
+		if len(value) > maxEnvValueLength {
+			return nil, fmt.Errorf("invalid environment variable %q: exceeds %d bytes", name, maxEnvValueLength)
+		}
+		if err := v.Validate(value); err != nil {
+			return nil, fmt.Errorf("invalid environment variable %q: %w", name, err)
+		}
+		env[name] = value
+	}
+	return env, nil
+}
+
+// environ merges the environment variables set by the client with those
+// required by the output settings (which take precedence), as sorted
+// list of "NAME=value" pairs.
+func environ(env map[string]string, o Output) []string {
+	merged := make(map[string]string, len(env)+2)
+	maps.Copy(merged, env)
+	for _, kv := range o.environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		merged[name] = value
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+
+	list := make([]string, 0, len(merged))
+	for _, name := range slices.Sorted(maps.Keys(merged)) {
+		list = append(list, name+"="+merged[name])
+	}
+	return list
+}
@@ -0,0 +1,78 @@
+package tex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnv(t *testing.T) {
+	t.Parallel()
+
+	env, err := ParseEnv(nil)
+	require.NoError(t, err)
+	assert.Nil(t, env)
+
+	env, err = ParseEnv([]string{
+		"TZ=Europe/Berlin",
+		"LANG=de_DE.UTF-8",
+		"TEXINPUTS=./styles//:",
+		"TEXMFVAR=cache",
+		"SOURCE_DATE_EPOCH=1700000000",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"TZ":                "Europe/Berlin",
+		"LANG":              "de_DE.UTF-8",
+		"TEXINPUTS":         "./styles//:",
+		"TEXMFVAR":          "cache",
+		"SOURCE_DATE_EPOCH": "1700000000",
+	}, env)
+
+	for def, msg := range map[string]string{
+		"TZ":                   `invalid environment variable "TZ": expected NAME=value`,
+		"PATH=/tmp":            `unsupported environment variable: "PATH"`,
+		"LANG=$(id)":           `invalid environment variable "LANG": invalid characters`,
+		"SOURCE_DATE_EPOCH=-1": `invalid environment variable "SOURCE_DATE_EPOCH": expected Unix timestamp`,
+		"FORCE_SOURCE_DATE=2":  `invalid environment variable "FORCE_SOURCE_DATE": expected 0 or 1`,
+		"TEXINPUTS=/etc//":     `invalid environment variable "TEXINPUTS": expected relative path in working directory`,
+		"TEXINPUTS=a:../b":     `invalid environment variable "TEXINPUTS": expected relative path in working directory`,
+		"BIBINPUTS=$HOME":      `invalid environment variable "BIBINPUTS": expected relative path in working directory`,
+		"TEXMFVAR=":            `invalid environment variable "TEXMFVAR": expected relative path in working directory`,
+		"TEXMFVAR=~/cache":     `invalid environment variable "TEXMFVAR": expected relative path in working directory`,
+	} {
+		_, err := ParseEnv([]string{def})
+		assert.EqualError(t, err, msg, def)
+	}
+
+	_, err = ParseEnv([]string{"TZ=UTC", "TZ=CET"})
+	assert.EqualError(t, err, `duplicate environment variable "TZ"`)
+}
+
+func TestSetAllowedEnvVars(t *testing.T) {
+	t.Cleanup(func() { allowedEnvVars = SupportedEnvVars() })
+
+	require.NoError(t, SetAllowedEnvVars([]string{"TZ"}))
+	assert.Equal(t, []string{"TZ"}, AllowedEnvVars())
+
+	_, err := ParseEnv([]string{"LANG=C"})
+	assert.EqualError(t, err, `unsupported environment variable: "LANG"`)
+
+	assert.EqualError(t, SetAllowedEnvVars([]string{"HOME"}), `unsupported environment variable: "HOME"`)
+	assert.Equal(t, []string{"TZ"}, AllowedEnvVars()) // unchanged
+}
+
+func TestEnviron(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, environ(nil, Output{}))
+
+	env := map[string]string{"TZ": "UTC", "SOURCE_DATE_EPOCH": "1"}
+	assert.Equal(t, []string{"SOURCE_DATE_EPOCH=1", "TZ=UTC"}, environ(env, Output{}))
+
+	o, err := Output{}.WithReproducible(42)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"FORCE_SOURCE_DATE=1", "SOURCE_DATE_EPOCH=42", "TZ=UTC"}, environ(env, o))
+	assert.Equal(t, "1", env["SOURCE_DATE_EPOCH"], "unmodified")
+}
@@ -0,0 +1,275 @@
+package tex
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Step is a command, which runs in the document's working directory
+// after a successful compilation (e.g. to convert the result).
+type Step struct {
+	// Name identifies the step in logs and errors.
+	Name string
+
+	// Cmd is the command line to execute.
+	Cmd []string
+
+	// Input and Output name the files a post-processing step reads and
+	// writes (relative to the working directory). Both are empty for
+	// steps creating multiple files.
+	Input, Output string
+
+	// Secrets are files, which are written to the working directory just
+	// before the step runs, and removed right afterwards. They are used
+	// to pass confidential arguments (e.g. passwords).
+	Secrets map[string]Secret
+
+	// Prepare, if present, is called with the working directory just
+	// before the step runs, e.g. to derive input files from the output
+	// of previous steps.
+	Prepare func(dir string) error `json:"-"`
+}
+
+// Supported output formats.
+const (
+	FormatPDF       = "pdf"       // the compiled document (default)
+	FormatPNG       = "png"       // one PNG image per page
+	FormatSVG       = "svg"       // one SVG image per page
+	FormatThumbnail = "thumbnail" // a small PNG image of the first page
+	FormatHTML      = "html"      // HTML, CSS and images, converted by make4ht
+)
+
+// Defaults and limits for Output.DPI.
+const (
+	DefaultDPI = 150
+	MaxDPI     = 600
+
+	// thumbnailSize is the size of the longer edge of thumbnails, in pixels.
+	thumbnailSize = 256
+)
+
+// File name prefixes for converted pages. Client files containing an
+// underscore are rejected by cleanpath, hence they can't be confused with
+// converter output.
+const (
+	internalPrefix = "_texd-"
+	outputPrefix   = internalPrefix + "page"
+)
+
+// Output describes the requested output format. The zero value selects
+// the compiled PDF document.
+type Output struct {
+	Format string
+
+	// DPI is the resolution for PNG images.
+	DPI int
+
+	// FirstPage and LastPage restrict the converted pages (1-based,
+	// inclusive). A zero value means "unbounded".
+	FirstPage, LastPage int
+
+	// PostProcess lists the post-processors applied to the PDF document
+	// (see WithPostProcess).
+	PostProcess []string
+
+	// Artifacts lists auxiliary files to return alongside the result
+	// (see WithArtifacts).
+	Artifacts []string
+
+	// Reproducible enables reproducible builds, using SourceDateEpoch
+	// as creation date (see WithReproducible).
+	Reproducible    bool
+	SourceDateEpoch int64
+
+	// Merge, if present, merges other PDF files with the compiled
+	// document as first post-processing step (see WithMerge).
+	Merge *Merge
+
+	// Metadata, if present, is applied to the PDF document after
+	// merging (see WithMetadata).
+	Metadata *Metadata
+
+	// Encryption, if present, encrypts the PDF document as last
+	// post-processing step (see WithEncryption).
+	Encryption *Encryption
+
+	// Signature, if present, signs the PDF document as last
+	// post-processing step (see WithSignature).
+	Signature *Signature
+}
+
+// ParseOutput validates the output format, resolution and page range.
+// Pages are given as "N", "N-M", "N-" or "-M".
+func ParseOutput(format, dpi, pages string) (o Output, err error) {
+	switch format {
+	case "", FormatPDF:
+		o.Format = FormatPDF
+		if dpi != "" || pages != "" {
+			return o, fmt.Errorf("dpi and pages are not supported for format %q", FormatPDF)
+		}
+		return o, nil
+	case FormatHTML:
+		o.Format = format
+		if dpi != "" || pages != "" {
+			return o, fmt.Errorf("dpi and pages are not supported for format %q", FormatHTML)
+		}
+		return o, nil
+	case FormatPNG, FormatSVG, FormatThumbnail:
+		o.Format = format
+	default:
+		return o, fmt.Errorf("unsupported output format: %q", format)
+	}
+
+	o.DPI = DefaultDPI
+	if dpi != "" {
+		if o.DPI, err = strconv.Atoi(dpi); err != nil || o.DPI < 1 || o.DPI > MaxDPI {
+			return o, fmt.Errorf("invalid dpi %q: expected a number between 1 and %d", dpi, MaxDPI)
+		}
+	}
+
+	if pages != "" {
+		first, last, isRange := strings.Cut(pages, "-")
+		if o.FirstPage, err = parsePage(first); err != nil {
+			return o, fmt.Errorf("invalid page range %q", pages)
+		}
+		if !isRange {
+			o.LastPage = o.FirstPage
+		} else if o.LastPage, err = parsePage(last); err != nil {
+			return o, fmt.Errorf("invalid page range %q", pages)
+		}
+		if o.FirstPage == 0 && o.LastPage == 0 || o.LastPage > 0 && o.FirstPage > o.LastPage {
+			return o, fmt.Errorf("invalid page range %q", pages)
+		}
+	}
+	return o, nil
+}
+
+func parsePage(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid page number %q", s)
+	}
+	return n, nil
+}
+
+// IsPDF reports whether the compiled PDF is returned unchanged.
+func (o Output) IsPDF() bool {
+	return o.Format == "" || o.Format == FormatPDF
+}
+
+// IsArchive reports whether results are always returned as archive, even
+// if there's only a single output file.
+func (o Output) IsArchive() bool {
+	return o.Format == FormatHTML || len(o.Artifacts) > 0
+}
+
+// MimeType returns the content type of a single output file.
+func (o Output) MimeType() string {
+	switch o.Format {
+	case FormatPNG, FormatThumbnail:
+		return "image/png"
+	case FormatSVG:
+		return "image/svg+xml"
+	}
+	return "application/pdf"
+}
+
+// Engine returns the engine producing the requested format. For HTML
+// output, this is a make4ht engine, which uses the same TeX engine
+// family as the given engine. All other formats use the given engine.
+func (o Output) Engine(e Engine) (Engine, error) {
+	if o.Format != FormatHTML {
+		return e, nil
+	}
+	if e.Compiler() != Latexmk {
+		return e, fmt.Errorf("format %q is not supported by %s", FormatHTML, e.Compiler().Name())
+	}
+
+	var flags []string
+	for _, flag := range e.flags {
+		switch {
+		case flag == "-pdflua" || flag == "-dvilua" || strings.HasPrefix(flag, "-lualatex="):
+			flags = []string{"-l"}
+		case flag == "-pdfxe" || flag == "-xdv" || strings.HasPrefix(flag, "-xelatex="):
+			flags = []string{"-x"}
+		}
+	}
+	return NewCompilerEngine(e.name, Make4ht, flags...), nil
+}
+
+// steps returns the commands post-processing the compiled PDF (pdf) and
+// converting it into the requested format. The converters (pdftoppm from
+// Poppler, and dvisvgm) are part of common TeX Live installations.
+func (o Output) steps(pdf string) []Step {
+	steps, pdf := o.postProcessSteps(pdf)
+
+	switch o.Format {
+	case FormatPNG:
+		cmd := []string{"pdftoppm", "-png", "-r", strconv.Itoa(o.DPI)}
+		cmd = append(cmd, o.pdftoppmRange(o.FirstPage, o.LastPage)...)
+		steps = append(steps, Step{Name: "png", Cmd: append(cmd, pdf, outputPrefix)})
+
+	case FormatThumbnail:
+		first := max(o.FirstPage, 1)
+		cmd := []string{"pdftoppm", "-png", "-singlefile", "-scale-to", strconv.Itoa(thumbnailSize)}
+		cmd = append(cmd, o.pdftoppmRange(first, first)...)
+		steps = append(steps, Step{Name: "thumbnail", Cmd: append(cmd, pdf, outputPrefix)})
+
+	case FormatSVG:
+		first, last := strconv.Itoa(max(o.FirstPage, 1)), ""
+		if o.LastPage > 0 {
+			last = strconv.Itoa(o.LastPage)
+		}
+		steps = append(steps, Step{Name: "svg", Cmd: []string{
+			"dvisvgm", "--pdf",
+			"--page=" + first + "-" + last,
+			"--output=" + outputPrefix + "-%p.svg",
+			pdf,
+		}})
+	}
+	return steps
+}
+
+func (Output) pdftoppmRange(first, last int) (flags []string) {
+	if first > 0 {
+		flags = append(flags, "-f", strconv.Itoa(first))
+	}
+	if last > 0 {
+		flags = append(flags, "-l", strconv.Itoa(last))
+	}
+	return flags
+}
+
+// PageFile returns the file name a converter creates for the given page
+// (without zero-padding). This is mostly useful for tests, and to
+// simulate conversions (see exec.Mock).
+func (o Output) PageFile(page int) string {
+	switch o.Format {
+	case FormatThumbnail:
+		return outputPrefix + ".png"
+	case FormatPNG:
+		return outputPrefix + "-" + strconv.Itoa(page) + ".png"
+	case FormatSVG:
+		return outputPrefix + "-" + strconv.Itoa(page) + ".svg"
+	}
+	return ""
+}
+
+// isOutputFile reports whether name is a converted page, as created by
+// the commands from steps().
+func (o Output) isOutputFile(name string) bool {
+	if !strings.HasPrefix(name, outputPrefix) || strings.ContainsRune(name, '/') {
+		return false
+	}
+	switch o.Format {
+	case FormatPNG, FormatThumbnail:
+		return strings.HasSuffix(name, ".png")
+	case FormatSVG:
+		return strings.HasSuffix(name, ".svg")
+	}
+	return false
+}
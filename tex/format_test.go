@@ -0,0 +1,122 @@
+package tex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOutput(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		format, dpi, pages string
+		expected           Output
+	}{
+		{"", "", "", Output{Format: "pdf"}},
+		{"pdf", "", "", Output{Format: "pdf"}},
+		{"png", "", "", Output{Format: "png", DPI: 150}},
+		{"png", "300", "2", Output{Format: "png", DPI: 300, FirstPage: 2, LastPage: 2}},
+		{"svg", "", "2-5", Output{Format: "svg", DPI: 150, FirstPage: 2, LastPage: 5}},
+		{"svg", "", "3-", Output{Format: "svg", DPI: 150, FirstPage: 3}},
+		{"thumbnail", "", "-4", Output{Format: "thumbnail", DPI: 150, LastPage: 4}},
+		{"html", "", "", Output{Format: "html"}},
+	} {
+		actual, err := ParseOutput(tc.format, tc.dpi, tc.pages)
+		require.NoError(t, err, tc)
+		assert.Equal(t, tc.expected, actual, tc)
+	}
+
+	for _, tc := range []struct{ format, dpi, pages, err string }{
+		{"docx", "", "", `unsupported output format: "docx"`},
+		{"pdf", "300", "", `dpi and pages are not supported for format "pdf"`},
+		{"html", "", "1", `dpi and pages are not supported for format "html"`},
+		{"png", "0", "", `invalid dpi "0": expected a number between 1 and 600`},
+		{"png", "1200", "", `invalid dpi "1200": expected a number between 1 and 600`},
+		{"png", "", "-", `invalid page range "-"`},
+		{"png", "", "0", `invalid page range "0"`},
+		{"png", "", "5-2", `invalid page range "5-2"`},
+		{"png", "", "a-b", `invalid page range "a-b"`},
+	} {
+		_, err := ParseOutput(tc.format, tc.dpi, tc.pages)
+		assert.EqualError(t, err, tc.err, tc)
+	}
+}
+
+func TestOutput_steps(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, Output{Format: "pdf"}.steps("main.pdf"))
+
+	assert.Equal(t, []Step{{Name: "png", Cmd: []string{
+		"pdftoppm", "-png", "-r", "150", "-f", "2", "-l", "3", "main.pdf", "_texd-page",
+	}}}, Output{Format: "png", DPI: 150, FirstPage: 2, LastPage: 3}.steps("main.pdf"))
+
+	assert.Equal(t, []Step{{Name: "thumbnail", Cmd: []string{
+		"pdftoppm", "-png", "-singlefile", "-scale-to", "256", "-f", "1", "-l", "1", "main.pdf", "_texd-page",
+	}}}, Output{Format: "thumbnail", DPI: 150}.steps("main.pdf"))
+
+	assert.Equal(t, []Step{{Name: "svg", Cmd: []string{
+		"dvisvgm", "--pdf", "--page=1-", "--output=_texd-page-%p.svg", "main.pdf",
+	}}}, Output{Format: "svg", DPI: 150}.steps("main.pdf"))
+}
+
+func TestOutput_files(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	png := Output{Format: "png"}
+	assert.Equal("image/png", png.MimeType())
+	assert.Equal("_texd-page-3.png", png.PageFile(3))
+	assert.True(png.isOutputFile("_texd-page-03.png"))
+	assert.False(png.isOutputFile("_texd-page-03.svg"))
+	assert.False(png.isOutputFile("page-03.png"))
+
+	svg := Output{Format: "svg"}
+	assert.Equal("image/svg+xml", svg.MimeType())
+	assert.Equal("_texd-page-1.svg", svg.PageFile(1))
+	assert.True(svg.isOutputFile(svg.PageFile(1)))
+
+	thumb := Output{Format: "thumbnail"}
+	assert.Equal("image/png", thumb.MimeType())
+	assert.Equal("_texd-page.png", thumb.PageFile(7))
+	assert.True(thumb.isOutputFile(thumb.PageFile(1)))
+
+	pdf := Output{}
+	assert.Equal("application/pdf", pdf.MimeType())
+	assert.True(pdf.IsPDF())
+	assert.False(pdf.isOutputFile("main.pdf"))
+}
+
+func TestOutput_Engine(t *testing.T) {
+	t.Parallel()
+
+	for _, out := range []Output{{}, {Format: FormatPNG}} {
+		e, err := out.Engine(DefaultEngine)
+		require.NoError(t, err)
+		assert.Equal(t, DefaultEngine, e)
+	}
+
+	html := Output{Format: FormatHTML}
+	assert.True(t, html.IsArchive())
+	for _, tc := range []struct {
+		engine Engine
+		flags  []string
+	}{
+		{NewEngine("xelatex", "-pdfxe"), []string{"-x"}},
+		{NewEngine("lualatex", "-pdflua"), []string{"-l"}},
+		{NewEngine("pdflatex", "-pdf"), nil},
+		{NewEngine("custom", "-pdf", "-lualatex=foo"), []string{"-l"}},
+		{NewEngine("uplatex", "-pdfdvi", "-latex=upla"), nil},
+	} {
+		e, err := html.Engine(tc.engine)
+		require.NoError(t, err)
+		assert.Equal(t, tc.engine.Name(), e.Name())
+		assert.Equal(t, Make4ht, e.Compiler())
+		assert.Equal(t, tc.flags, e.flags, tc.engine.Name())
+	}
+
+	_, err := html.Engine(NewCompilerEngine("tectonic", Tectonic))
+	assert.EqualError(t, err, `format "html" is not supported by tectonic`)
+}
@@ -0,0 +1,113 @@
+package tex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// srgbProfile is an ICC (v2.1) display profile for the sRGB color space,
+// which the pdfa post-processor embeds as output intent. It is generated,
+// since Ghostscript installations ship their profiles in varying places.
+var srgbProfile = newSRGBProfile()
+
+// D50 is the illuminant of the ICC profile connection space.
+var iccD50 = [3]float64{0.9642, 1.0, 0.8249}
+
+// newSRGBProfile builds a matrix/TRC profile with the sRGB primaries
+// (chromatically adapted to D50) and a sampled sRGB tone curve.
+func newSRGBProfile() []byte {
+	type tag struct {
+		sig  string
+		data []byte
+	}
+	trc := iccCurve(1024)
+	tags := []tag{
+		{"desc", iccDescription("sRGB")},
+		{"cprt", iccText("No copyright, use freely")},
+		{"wtpt", iccXYZ(iccD50)},
+		{"rXYZ", iccXYZ([3]float64{0.4361, 0.2225, 0.0139})},
+		{"gXYZ", iccXYZ([3]float64{0.3851, 0.7169, 0.0971})},
+		{"bXYZ", iccXYZ([3]float64{0.1431, 0.0606, 0.7141})},
+		{"rTRC", trc},
+		{"gTRC", trc},
+		{"bTRC", trc},
+	}
+
+	var table, data bytes.Buffer
+	offset := 128 + 4 + 12*len(tags)
+	shared := map[*byte]int{} // tags may share their data
+	for _, t := range tags {
+		pos, ok := shared[&t.data[0]]
+		if !ok {
+			pos = offset + data.Len()
+			shared[&t.data[0]] = pos
+			data.Write(t.data)
+			for data.Len()%4 != 0 {
+				data.WriteByte(0)
+			}
+		}
+		table.WriteString(t.sig)
+		_ = binary.Write(&table, binary.BigEndian, [2]uint32{uint32(pos), uint32(len(t.data))})
+	}
+
+	size := offset + data.Len()
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(size))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000) // version 2.1
+	copy(header[12:], "mntr")
+	copy(header[16:], "RGB ")
+	copy(header[20:], "XYZ ")
+	for i, v := range []uint16{2000, 1, 1} { // creation date
+		binary.BigEndian.PutUint16(header[24+2*i:], v)
+	}
+	copy(header[36:], "acsp")
+	copy(header[68:], iccXYZ(iccD50)[8:]) // illuminant
+
+	profile := make([]byte, 0, size)
+	profile = append(profile, header...)
+	profile = binary.BigEndian.AppendUint32(profile, uint32(len(tags)))
+	profile = append(profile, table.Bytes()...)
+	return append(profile, data.Bytes()...)
+}
+
+// iccXYZ encodes an XYZType tag.
+func iccXYZ(xyz [3]float64) []byte {
+	b := append([]byte("XYZ "), 0, 0, 0, 0)
+	for _, v := range xyz {
+		b = binary.BigEndian.AppendUint32(b, uint32(int32(math.Round(v*65536))))
+	}
+	return b
+}
+
+// iccCurve encodes a curveType tag sampling the sRGB tone curve.
+func iccCurve(n int) []byte {
+	b := append([]byte("curv"), 0, 0, 0, 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(n))
+	for i := range n {
+		v := float64(i) / float64(n-1)
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		b = binary.BigEndian.AppendUint16(b, uint16(math.Round(v*65535)))
+	}
+	return b
+}
+
+// iccText encodes a textType tag.
+func iccText(s string) []byte {
+	b := append([]byte("text"), 0, 0, 0, 0)
+	return append(append(b, s...), 0)
+}
+
+// iccDescription encodes a textDescriptionType tag, with an ASCII
+// description only.
+func iccDescription(s string) []byte {
+	b := append([]byte("desc"), 0, 0, 0, 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)+1))
+	b = append(append(b, s...), 0)
+	b = append(b, make([]byte, 4+4+2+1+67)...) // empty Unicode and ScriptCode descriptions
+	return b
+}
@@ -0,0 +1,149 @@
+package tex
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Keys for settings, which documents may declare in magic comments.
+const (
+	MagicEngine = "engine" // TeX engine, see SupportedEngines()
+	MagicInput  = "input"  // main input file, relative to the declaring file
+	MagicBib    = "bib"    // bibliography tool, see BibTools
+	MagicStrict = "strict" // stop at the first error, see Options.Strict
+
+	// source encoding, see SetEncodingDetection
+	MagicEncoding = "encoding"
+)
+
+// MagicKeys lists all known magic comment keys.
+var MagicKeys = []string{MagicEngine, MagicInput, MagicBib, MagicStrict, MagicEncoding}
+
+// MagicComments holds settings declared in the first lines of a TeX
+// file. Recognized are texd's own mark with key=value pairs, and the
+// conventions established by TeXShop, TeXstudio and others:
+//
+//	%!texd engine=lualatex bib=biber strict=true
+//	% !TEX program = lualatex
+//	% !TEX root = main.tex
+//	% !BIB program = biber
+//
+// Only the leading comment block of the first KiB is searched.
+type MagicComments map[string]string
+
+var (
+	magicTexd = regexp.MustCompile(`^%\s*!texd(?:\s+(.*))?$`)
+	magicTeX  = regexp.MustCompile(`^%\s*!(?i:(TEX|BIB))\s+(?i:(?:TS-)?(program|root))\s*=\s*(\S+)\s*$`)
+)
+
+// allowedMagicComments restricts the keys documents may declare.
+var allowedMagicComments = slices.Clone(MagicKeys)
+
+// SetMagicComments globally configures which settings documents may
+// declare in magic comments. An empty list disables magic comments
+// entirely (the %!texd mark is still used to find the main input file).
+func SetMagicComments(keys []string) error {
+	for _, key := range keys {
+		if !slices.Contains(MagicKeys, key) {
+			return fmt.Errorf("unknown magic comment key: %q", key)
+		}
+	}
+	allowedMagicComments = slices.Clone(keys)
+	return nil
+}
+
+// AllowedMagicComments returns the keys documents may declare.
+func AllowedMagicComments() []string {
+	return slices.Clone(allowedMagicComments)
+}
+
+// parseMagicComments extracts magic comments from the leading comment
+// block in buf. Later declarations override earlier ones. Returns nil,
+// if no (allowed) magic comment was found.
+func parseMagicComments(buf []byte) (mc MagicComments) {
+	set := func(key, value string) {
+		if value == "" || !slices.Contains(allowedMagicComments, key) {
+			return
+		}
+		if mc == nil {
+			mc = make(MagicComments)
+		}
+		mc[key] = value
+	}
+
+	for line := range bytes.Lines(buf) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] != '%' {
+			break // end of leading comment block
+		}
+
+		if m := magicTexd.FindSubmatch(line); m != nil {
+			for _, field := range strings.Fields(string(m[1])) {
+				if key, value, ok := strings.Cut(field, "="); ok {
+					set(key, value)
+				}
+			}
+			continue
+		}
+		if m := magicTeX.FindSubmatch(line); m != nil {
+			prog, key, value := strings.ToUpper(string(m[1])), strings.ToLower(string(m[2])), string(m[3])
+			switch {
+			case prog == "TEX" && key == "program":
+				set(MagicEngine, value)
+			case prog == "TEX" && key == "root":
+				set(MagicInput, value)
+			case prog == "BIB" && key == "program":
+				set(MagicBib, value)
+			}
+		}
+	}
+	return mc
+}
+
+// BibTools lists the accepted values for Options.Bib. An empty value
+// lets the compiler decide whether and how to process bibliographies.
+var BibTools = []string{"biber", "bibtex", "none"}
+
+// Options are per-document compiler settings, which are either given
+// as request parameters, or declared in magic comments.
+type Options struct {
+	// Bib selects the bibliography tool (see BibTools).
+	Bib string
+
+	// Strict stops the compilation at the first error.
+	Strict bool
+
+	// Tools lists auxiliary tools to enable (see ParseTools).
+	Tools []string
+
+	// Artifacts lists the auxiliary files to produce and keep (see
+	// Output.WithArtifacts). It is not settable by magic comments.
+	Artifacts []string
+}
+
+// ParseBibTool validates the name of a bibliography tool.
+func ParseBibTool(name string) (string, error) {
+	if name == "" || slices.Contains(BibTools, name) {
+		return name, nil
+	}
+	return "", fmt.Errorf("unsupported bibliography tool: %q", name)
+}
+
+// ParseStrict parses a strictness value. An empty value means false.
+func ParseStrict(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	strict, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid strictness value: %q", value)
+	}
+	return strict, nil
+}
@@ -0,0 +1,98 @@
+package tex
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMagicComments(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		input    string
+		expected MagicComments
+	}{
+		{"empty", "", nil},
+		{"plain mark", "%!texd\n\\documentclass{article}", nil},
+		{
+			"texd mark",
+			"%!texd engine=lualatex bib=biber strict=true\n",
+			MagicComments{"engine": "lualatex", "bib": "biber", "strict": "true"},
+		},
+		{
+			"texd mark ignores unknown keys",
+			"%!texd foo=bar input=main.tex junk\n",
+			MagicComments{"input": "main.tex"},
+		},
+		{
+			"TeXShop conventions",
+			"% !TEX program = lualatex\r\n% !TEX root = ../main.tex\r\n% !BIB program = biber\r\n",
+			MagicComments{"engine": "lualatex", "input": "../main.tex", "bib": "biber"},
+		},
+		{
+			"TS-program and case insensitivity",
+			"%!tex TS-program=xelatex\n",
+			MagicComments{"engine": "xelatex"},
+		},
+		{
+			"later declarations override",
+			"% !TEX program = pdflatex\n%!texd engine=lualatex\n",
+			MagicComments{"engine": "lualatex"},
+		},
+		{
+			"leading blank lines",
+			"\n\n   % !TEX program = pdflatex\n",
+			MagicComments{"engine": "pdflatex"},
+		},
+		{
+			"stops at first non-comment line",
+			"\\documentclass{article}\n% !TEX program = pdflatex\n",
+			nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, parseMagicComments([]byte(tc.input)))
+		})
+	}
+}
+
+func TestSetMagicComments(t *testing.T) {
+	t.Cleanup(func() { allowedMagicComments = slices.Clone(MagicKeys) })
+
+	require.NoError(t, SetMagicComments([]string{MagicInput}))
+	assert.Equal(t, []string{"input"}, AllowedMagicComments())
+	assert.Equal(t, MagicComments{"input": "main.tex"},
+		parseMagicComments([]byte("%!texd engine=lualatex input=main.tex")))
+
+	require.NoError(t, SetMagicComments(nil))
+	assert.Nil(t, parseMagicComments([]byte("% !TEX program = lualatex")))
+
+	assert.EqualError(t, SetMagicComments([]string{"engine", "foo"}),
+		`unknown magic comment key: "foo"`)
+	assert.Empty(t, AllowedMagicComments()) // unchanged
+}
+
+func TestParseBibTool(t *testing.T) {
+	for _, name := range []string{"", "biber", "bibtex", "none"} {
+		actual, err := ParseBibTool(name)
+		assert.NoError(t, err)
+		assert.Equal(t, name, actual)
+	}
+	_, err := ParseBibTool("makeindex")
+	assert.EqualError(t, err, `unsupported bibliography tool: "makeindex"`)
+}
+
+func TestParseStrict(t *testing.T) {
+	for value, expected := range map[string]bool{
+		"": false, "false": false, "0": false,
+		"true": true, "1": true,
+	} {
+		actual, err := ParseStrict(value)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual, "value %q", value)
+	}
+	_, err := ParseStrict("maybe")
+	assert.EqualError(t, err, `invalid strictness value: "maybe"`)
+}
@@ -0,0 +1,89 @@
+package tex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxMergeFiles limits the number of PDF files merged into a document.
+const maxMergeFiles = 32
+
+// Merge lists PDF files from the working directory (uploaded files, or
+// files from the reference store), which are merged with the compiled
+// document.
+type Merge struct {
+	Prepend []string
+	Append  []string
+}
+
+// ParseFileList parses a comma separated list of PDF file names. The names
+// must follow the same rules as file names given to AddFile.
+func ParseFileList(list string) (names []string, err error) {
+	for name := range strings.SplitSeq(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		clean, ok := cleanpath(name)
+		if !ok {
+			return nil, fmt.Errorf("invalid file name: %q", name)
+		}
+		if !strings.HasSuffix(strings.ToLower(clean), ".pdf") {
+			return nil, fmt.Errorf("not a PDF file: %q", name)
+		}
+		names = append(names, clean)
+	}
+	if len(names) > maxMergeFiles {
+		return nil, fmt.Errorf("too many files: %d (maximum is %d)", len(names), maxMergeFiles)
+	}
+	return names, nil
+}
+
+// WithMerge returns a copy of o, which merges the PDF files given as comma
+// separated lists (see ParseFileList) with the compiled document, before
+// any other post-processing step. Merging is not supported for HTML output.
+func (o Output) WithMerge(prependList, appendList string) (Output, error) {
+	var m Merge
+	var err error
+	if m.Prepend, err = ParseFileList(prependList); err != nil {
+		return o, fmt.Errorf("invalid prepend list: %w", err)
+	}
+	if m.Append, err = ParseFileList(appendList); err != nil {
+		return o, fmt.Errorf("invalid append list: %w", err)
+	}
+	if len(m.Prepend)+len(m.Append) == 0 {
+		o.Merge = nil
+		return o, nil
+	}
+	if len(m.Prepend)+len(m.Append) > maxMergeFiles {
+		return o, fmt.Errorf("too many files: %d (maximum is %d)", len(m.Prepend)+len(m.Append), maxMergeFiles)
+	}
+	if o.Format == FormatHTML {
+		return o, fmt.Errorf("merging is not supported for format %q", o.Format)
+	}
+	o.Merge = &m
+	return o, nil
+}
+
+// Files lists the files to merge.
+func (m *Merge) Files() []string {
+	return append(append([]string{}, m.Prepend...), m.Append...)
+}
+
+// mergeStep returns the qpdf invocation merging the PDF file in with the
+// other files. The file in is the primary input (referenced as "."), so
+// its document-level structures (document info, outlines, named
+// destinations) are retained, while those of the other files are not.
+func (m *Merge) mergeStep(in string) Step {
+	out := internalPrefix + "merge.pdf"
+	cmd := []string{"qpdf", in, "--pages"}
+	cmd = append(cmd, m.Prepend...)
+	cmd = append(cmd, ".")
+	cmd = append(cmd, m.Append...)
+	return Step{
+		Name:   "merge",
+		Cmd:    append(cmd, "--", out),
+		Input:  in,
+		Output: out,
+	}
+}
@@ -0,0 +1,62 @@
+package tex
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFileList(t *testing.T) {
+	t.Parallel()
+
+	names, err := ParseFileList(" cover.pdf, ./terms/agb.PDF,,cover.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cover.pdf", "terms/agb.PDF", "cover.pdf"}, names)
+
+	names, err = ParseFileList("")
+	require.NoError(t, err)
+	assert.Nil(t, names)
+
+	for list, msg := range map[string]string{
+		"../agb.pdf":     `invalid file name: "../agb.pdf"`,
+		"terms_2024.pdf": `invalid file name: "terms_2024.pdf"`,
+		"agb.tex":        `not a PDF file: "agb.tex"`,
+		strings.Repeat("a.pdf,", maxMergeFiles+1): "too many files: 33 (maximum is 32)",
+	} {
+		_, err := ParseFileList(list)
+		assert.EqualError(t, err, msg, list)
+	}
+}
+
+func TestOutput_WithMerge(t *testing.T) {
+	t.Parallel()
+
+	o, err := Output{}.WithMerge("", "")
+	require.NoError(t, err)
+	assert.Nil(t, o.Merge)
+
+	o, err = Output{PostProcess: []string{"linearize"}}.WithMerge("cover.pdf", "agb.pdf,privacy.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cover.pdf", "agb.pdf", "privacy.pdf"}, o.Merge.Files())
+
+	steps := o.steps("main.pdf")
+	require.Len(t, steps, 2)
+	assert.Equal(t, Step{
+		Name: "merge",
+		Cmd: []string{
+			"qpdf", "main.pdf", "--pages", "cover.pdf", ".", "agb.pdf", "privacy.pdf", "--", "_texd-merge.pdf",
+		},
+		Input:  "main.pdf",
+		Output: "_texd-merge.pdf",
+	}, steps[0])
+	assert.Equal(t, "_texd-merge.pdf", steps[1].Input)
+
+	_, err = Output{}.WithMerge("cover.tex", "")
+	assert.EqualError(t, err, `invalid prepend list: not a PDF file: "cover.tex"`)
+	_, err = Output{}.WithMerge(strings.Repeat("a.pdf,", 20), strings.Repeat("b.pdf,", 20))
+	assert.EqualError(t, err, "too many files: 40 (maximum is 32)")
+	_, err = Output{Format: FormatHTML}.WithMerge("", "agb.pdf")
+	assert.EqualError(t, err, `merging is not supported for format "html"`)
+}
@@ -0,0 +1,241 @@
+package tex
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits for metadata values.
+const (
+	maxMetadataLength = 1024     // characters per document info entry
+	MaxXMPSize        = 32 << 10 // bytes
+)
+
+// Metadata describes document information to apply to the result PDF.
+// Empty fields are left untouched.
+type Metadata struct {
+	Title    string
+	Author   string
+	Subject  string
+	Keywords string
+
+	// XMP is a custom XMP packet, which replaces the document's metadata
+	// stream.
+	XMP []byte
+}
+
+// IsZero reports whether no metadata is present.
+func (m Metadata) IsZero() bool {
+	return m.Title == "" && m.Author == "" && m.Subject == "" && m.Keywords == "" && len(m.XMP) == 0
+}
+
+// Fields returns the non-empty document info entries, keyed by their
+// lower case name (title, author, subject, keywords).
+func (m Metadata) Fields() map[string]string {
+	fields := make(map[string]string, 4)
+	for key, value := range map[string]string{
+		"title":    m.Title,
+		"author":   m.Author,
+		"subject":  m.Subject,
+		"keywords": m.Keywords,
+	} {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// Validate checks the lengths and encodings of the values, and whether
+// the XMP packet is well-formed XML.
+func (m Metadata) Validate() error {
+	for key, value := range m.Fields() {
+		if !utf8.ValidString(value) {
+			return fmt.Errorf("invalid %s: not valid UTF-8", key)
+		}
+		if utf8.RuneCountInString(value) > maxMetadataLength {
+			return fmt.Errorf("invalid %s: exceeds %d characters", key, maxMetadataLength)
+		}
+	}
+	if len(m.XMP) == 0 {
+		return nil
+	}
+	if len(m.XMP) > MaxXMPSize {
+		return fmt.Errorf("invalid XMP packet: exceeds %d bytes", MaxXMPSize)
+	}
+	dec := xml.NewDecoder(bytes.NewReader(m.XMP))
+	for {
+		_, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid XMP packet: %w", err)
+		}
+	}
+}
+
+// WithMetadata returns a copy of o, which applies the given metadata to
+// the result PDF. Metadata is only supported for PDF output. Since the
+// PDF/A conversion writes its own XMP packet (derived from the document
+// info), a custom XMP packet can't be combined with the pdfa
+// post-processor.
+func (o Output) WithMetadata(m Metadata) (Output, error) {
+	if m.IsZero() {
+		o.Metadata = nil
+		return o, nil
+	}
+	if !o.IsPDF() {
+		return o, fmt.Errorf("metadata is not supported for format %q", o.Format)
+	}
+	if len(m.XMP) > 0 && slices.Contains(o.PostProcess, "pdfa") {
+		// would replace the PDF/A identification written by Ghostscript
+		return o, errors.New(`custom XMP packets can't be combined with post-processor "pdfa"`)
+	}
+	if err := m.Validate(); err != nil {
+		return o, err
+	}
+	o.Metadata = &m
+	return o, nil
+}
+
+// Files of the metadata steps, relative to the working directory.
+const (
+	metadataExport = internalPrefix + "metadata.json"        // document structure
+	metadataUpdate = internalPrefix + "metadata-update.json" // changes to apply
+)
+
+// metadataSteps returns the qpdf invocations applying the metadata to the
+// PDF file in. The first step exports the document structure (without
+// stream data) as qpdf JSON. The second step derives the changes from it
+// (see Metadata.writeUpdate), and applies them. Unlike rewriting the file
+// with Ghostscript, this leaves the content untouched.
+func (m Metadata) metadataSteps(in string) []Step {
+	out := internalPrefix + "metadata.pdf"
+	return []Step{{
+		Name: "metadata",
+		Cmd:  []string{"qpdf", in, "--json-output=2", "--json-stream-data=none", metadataExport},
+	}, {
+		Name:    "metadata",
+		Cmd:     []string{"qpdf", in, "--update-from-json=" + metadataUpdate, out},
+		Input:   in,
+		Output:  out,
+		Prepare: m.writeUpdate,
+	}}
+}
+
+// qpdfObject is an object in qpdf's JSON format (version 2). Names,
+// strings and references are encoded as JSON strings ("/Name", "u:text",
+// "1 0 R").
+type qpdfObject struct {
+	Value  any         `json:"value,omitempty"`
+	Stream *qpdfStream `json:"stream,omitempty"`
+}
+
+type qpdfStream struct {
+	Dict map[string]any `json:"dict"`
+	Data []byte         `json:"data,omitempty"`
+}
+
+// writeUpdate reads the document structure exported by qpdf from the
+// working directory dir, and writes the changes applying the metadata.
+func (m Metadata) writeUpdate(dir string) error {
+	export, err := os.Open(filepath.Join(dir, metadataExport))
+	if err != nil {
+		return err
+	}
+	defer export.Close()
+
+	update, err := m.update(export)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, metadataUpdate), update, 0o600)
+}
+
+// update returns the qpdf JSON update for the exported document r. The
+// document info entries are merged into the existing info dictionary (or
+// a new one), and a custom XMP packet replaces the catalog's metadata
+// stream.
+func (m Metadata) update(r io.Reader) ([]byte, error) {
+	var export struct {
+		QPDF []json.RawMessage `json:"qpdf"`
+	}
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("invalid qpdf JSON: %w", err)
+	}
+	if len(export.QPDF) != 2 {
+		return nil, errors.New("invalid qpdf JSON: unexpected structure")
+	}
+	var header struct {
+		MaxObjectID int `json:"maxobjectid"`
+	}
+	objects := make(map[string]qpdfObject)
+	if err := json.Unmarshal(export.QPDF[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid qpdf JSON: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(export.QPDF[1]))
+	dec.UseNumber() // retain numbers as written
+	if err := dec.Decode(&objects); err != nil {
+		return nil, fmt.Errorf("invalid qpdf JSON: %w", err)
+	}
+	trailer, ok := objects["trailer"].Value.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid qpdf JSON: missing trailer")
+	}
+
+	changes := make(map[string]qpdfObject)
+	nextID := header.MaxObjectID
+	newRef := func() string {
+		nextID++
+		return fmt.Sprintf("%d 0 R", nextID)
+	}
+	lookup := func(ref any) (string, map[string]any) {
+		s, _ := ref.(string)
+		dict, _ := objects["obj:"+s].Value.(map[string]any)
+		return s, dict
+	}
+
+	if fields := m.Fields(); len(fields) > 0 {
+		ref, info := lookup(trailer["/Info"])
+		if info == nil {
+			info, _ = trailer["/Info"].(map[string]any) // direct object
+			if info == nil {
+				info = make(map[string]any, len(fields))
+			}
+			ref = newRef()
+			trailer["/Info"] = ref
+			changes["trailer"] = qpdfObject{Value: trailer}
+		}
+		for key, value := range fields {
+			info["/"+strings.ToUpper(key[:1])+key[1:]] = "u:" + value
+		}
+		changes["obj:"+ref] = qpdfObject{Value: info}
+	}
+	if len(m.XMP) > 0 {
+		root, catalog := lookup(trailer["/Root"])
+		if catalog == nil {
+			return nil, errors.New("invalid qpdf JSON: missing document catalog")
+		}
+		ref := newRef()
+		changes["obj:"+ref] = qpdfObject{Stream: &qpdfStream{
+			Dict: map[string]any{"/Type": "/Metadata", "/Subtype": "/XML"},
+			Data: m.XMP,
+		}}
+		catalog["/Metadata"] = ref
+		changes["obj:"+root] = qpdfObject{Value: catalog}
+	}
+
+	return json.Marshal(map[string]any{
+		"qpdf": []any{export.QPDF[0], changes},
+	})
+}
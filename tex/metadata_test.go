@@ -0,0 +1,153 @@
+package tex
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testXMP = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"/></x:xmpmeta>
+<?xpacket end="w"?>`
+
+func TestMetadata_Validate(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, Metadata{Title: "Rechnung Nr. 42", XMP: []byte(testXMP)}.Validate())
+
+	for msg, m := range map[string]Metadata{
+		"invalid title: not valid UTF-8":                                 {Title: "\xff"},
+		"invalid author: exceeds 1024 characters":                        {Author: strings.Repeat("ä", 1025)},
+		"invalid XMP packet: exceeds 32768 bytes":                        {XMP: make([]byte, MaxXMPSize+1)},
+		"invalid XMP packet: XML syntax error on line 1: unexpected EOF": {XMP: []byte("<x:xmpmeta>")},
+	} {
+		assert.EqualError(t, m.Validate(), msg)
+	}
+}
+
+func TestOutput_WithMetadata(t *testing.T) {
+	t.Parallel()
+
+	o, err := Output{}.WithMetadata(Metadata{})
+	require.NoError(t, err)
+	assert.Nil(t, o.Metadata)
+	assert.Nil(t, o.steps("main.pdf"))
+
+	o, err = Output{PostProcess: []string{"linearize"}}.WithMetadata(Metadata{
+		Title:    "Über (uns)",
+		Keywords: "a, b",
+		XMP:      []byte("<x/>"),
+	})
+	require.NoError(t, err)
+	steps := o.steps("main.pdf")
+	require.Len(t, steps, 3)
+	assert.Equal(t, Step{
+		Name: "metadata",
+		Cmd:  []string{"qpdf", "main.pdf", "--json-output=2", "--json-stream-data=none", "_texd-metadata.json"},
+	}, steps[0])
+	assert.Equal(t, []string{
+		"qpdf", "main.pdf", "--update-from-json=_texd-metadata-update.json", "_texd-metadata.pdf",
+	}, steps[1].Cmd)
+	assert.Equal(t, "main.pdf", steps[1].Input)
+	assert.Equal(t, "_texd-metadata.pdf", steps[1].Output)
+	require.NotNil(t, steps[1].Prepare)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "_texd-metadata.json"), []byte(qpdfExport), 0o600))
+	require.NoError(t, steps[1].Prepare(dir))
+	update, err := os.ReadFile(filepath.Join(dir, "_texd-metadata-update.json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"qpdf": [
+		{"jsonversion": 2, "maxobjectid": 4},
+		{
+			"obj:1 0 R": {"value": {"/Type": "/Catalog", "/Pages": "2 0 R", "/Metadata": "5 0 R"}},
+			"obj:4 0 R": {"value": {"/Producer": "u:pdfTeX", "/Title": "u:Über (uns)", "/Keywords": "u:a, b"}},
+			"obj:5 0 R": {"stream": {"dict": {"/Type": "/Metadata", "/Subtype": "/XML"}, "data": "PHgvPg=="}}
+		}
+	]}`, string(update))
+	assert.Equal(t, "_texd-metadata.pdf", steps[2].Input)
+
+	_, err = Output{Format: FormatPNG}.WithMetadata(Metadata{Title: "x"})
+	assert.EqualError(t, err, `metadata is not supported for format "png"`)
+	_, err = Output{PostProcess: []string{"pdfa"}}.WithMetadata(Metadata{XMP: []byte("<x/>")})
+	assert.EqualError(t, err, `custom XMP packets can't be combined with post-processor "pdfa"`)
+}
+
+func TestOutput_WithMetadata_order(t *testing.T) {
+	t.Parallel()
+
+	for list, expected := range map[string][]string{
+		"compress":                {"compress", "metadata", "metadata"},
+		"pdfa":                    {"metadata", "metadata", "pdfa"},
+		"compress,pdfa,linearize": {"compress", "metadata", "metadata", "pdfa", "linearize"},
+	} {
+		o, err := Output{}.WithPostProcess(list)
+		require.NoError(t, err)
+		o, err = o.WithMetadata(Metadata{Title: "x"})
+		require.NoError(t, err)
+
+		var names []string
+		for _, step := range o.steps("main.pdf") {
+			names = append(names, step.Name)
+		}
+		assert.Equal(t, expected, names, list)
+	}
+
+	// custom XMP packets survive the compression
+	o, err := Output{PostProcess: []string{"compress"}}.WithMetadata(Metadata{XMP: []byte("<x/>")})
+	require.NoError(t, err)
+	assert.Equal(t, "_texd-metadata.pdf", o.ResultFile("main.pdf"))
+}
+
+// qpdfExport is the structure of a single page document, as exported by
+// qpdf --json-output=2 --json-stream-data=none.
+const qpdfExport = `{
+  "version": 2,
+  "parameters": {"decodelevel": "generalized"},
+  "qpdf": [
+    {"jsonversion": 2, "maxobjectid": 4},
+    {
+      "obj:1 0 R": {"value": {"/Type": "/Catalog", "/Pages": "2 0 R"}},
+      "obj:2 0 R": {"value": {"/Type": "/Pages", "/Kids": ["3 0 R"], "/Count": 1}},
+      "obj:3 0 R": {"value": {"/Type": "/Page", "/Parent": "2 0 R", "/MediaBox": [0, 0, 595.276, 841.89]}},
+      "obj:4 0 R": {"value": {"/Producer": "u:pdfTeX"}},
+      "trailer": {"value": {"/Root": "1 0 R", "/Info": "4 0 R", "/Size": 5}}
+    }
+  ]
+}`
+
+func TestMetadata_update(t *testing.T) {
+	t.Parallel()
+
+	// without info dictionary
+	export := strings.Replace(qpdfExport, `, "/Info": "4 0 R"`, "", 1)
+	update, err := Metadata{Author: "ACME"}.update(strings.NewReader(export))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"qpdf": [
+		{"jsonversion": 2, "maxobjectid": 4},
+		{
+			"obj:5 0 R": {"value": {"/Author": "u:ACME"}},
+			"trailer": {"value": {"/Root": "1 0 R", "/Info": "5 0 R", "/Size": 5}}
+		}
+	]}`, string(update))
+
+	// numbers are retained
+	update, err = Metadata{XMP: []byte("<x/>")}.update(strings.NewReader(
+		strings.Replace(qpdfExport, `"/Pages": "2 0 R"}`, `"/Pages": "2 0 R", "/Version": 1.70}`, 1)))
+	require.NoError(t, err)
+	assert.Contains(t, string(update), `"/Version":1.70`)
+
+	for export, msg := range map[string]string{
+		"{":                  "invalid qpdf JSON: unexpected EOF",
+		`{"qpdf": [{}]}`:     "invalid qpdf JSON: unexpected structure",
+		`{"qpdf": [{}, {}]}`: "invalid qpdf JSON: missing trailer",
+		`{"qpdf": [{}, {"trailer": {"value": {}}}]}`: "invalid qpdf JSON: missing document catalog",
+	} {
+		_, err := Metadata{XMP: []byte("<x/>")}.update(strings.NewReader(export))
+		assert.EqualError(t, err, msg, export)
+	}
+}
@@ -94,7 +94,7 @@ func (doc *document) Metrics() (m Metrics) {
 	m.Result = -1
 	if input, err := doc.MainInput(); err == nil {
 		if extpos := strings.LastIndexByte(input, '.'); extpos > 0 {
-			path := path.Join(doc.workdir, input[:extpos]+".pdf")
+			path := path.Join(doc.workdir, doc.engine.Compiler().ResultFile(input))
 			if s, err := doc.fs.Stat(path); err == nil {
 				m.Result = int(s.Size())
 			}
@@ -0,0 +1,65 @@
+package tex
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"slices"
+	"strings"
+)
+
+// PackageIndexCommand prints the names of all LaTeX packages (.sty files)
+// listed in the ls-R databases of a TeX distribution. Its output can be
+// parsed with ParsePackageIndex.
+var PackageIndexCommand = []string{"sh", "-c", `kpsewhich -all ls-R | xargs cat | grep '\.sty$'`}
+
+// A PackageIndex lists the LaTeX packages provided by a TeX distribution.
+type PackageIndex struct {
+	names []string // sorted
+}
+
+// ParsePackageIndex reads the package names from an ls-R database (or
+// the output of PackageIndexCommand). Directory entries and other files
+// are ignored.
+func ParsePackageIndex(lsR []byte) *PackageIndex {
+	idx := &PackageIndex{}
+	s := bufio.NewScanner(bytes.NewReader(lsR))
+	for s.Scan() {
+		name := path.Base(strings.TrimSpace(s.Text()))
+		if pkg, ok := strings.CutSuffix(name, ".sty"); ok && pkg != "" {
+			idx.names = append(idx.names, pkg)
+		}
+	}
+	slices.Sort(idx.names)
+	idx.names = slices.Compact(idx.names)
+	return idx
+}
+
+// Has reports whether the package with the given name is available.
+func (idx *PackageIndex) Has(name string) bool {
+	_, found := slices.BinarySearch(idx.names, name)
+	return found
+}
+
+// Names returns the sorted package names.
+func (idx *PackageIndex) Names() []string {
+	return slices.Clone(idx.names)
+}
+
+// Len returns the number of packages.
+func (idx *PackageIndex) Len() int {
+	return len(idx.names)
+}
+
+// UnknownPackages returns the packages required by deps, which are
+// neither a document file, nor listed in idx. Each name is reported only
+// once.
+func (idx *PackageIndex) UnknownPackages(deps []Dependency) []string {
+	var unknown []string
+	for _, dep := range deps {
+		if dep.IsPackage() && dep.Resolved == "" && !idx.Has(dep.Target) && !slices.Contains(unknown, dep.Target) {
+			unknown = append(unknown, dep.Target)
+		}
+	}
+	return unknown
+}
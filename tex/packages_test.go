@@ -0,0 +1,40 @@
+package tex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackageIndex(t *testing.T) {
+	t.Parallel()
+
+	idx := ParsePackageIndex([]byte(`% ls-R -- filename database for kpathsea; do not change this line.
+./:
+ls-R
+tex
+
+./tex/latex/xcolor:
+xcolor.sty
+xcolor.pro
+
+./tex/latex/graphics:
+graphicx.sty
+graphics.sty
+xcolor.sty
+.sty
+`))
+	assert.Equal(t, []string{"graphics", "graphicx", "xcolor"}, idx.Names())
+	assert.Equal(t, 3, idx.Len())
+	assert.True(t, idx.Has("graphicx"))
+	assert.False(t, idx.Has("tikz"))
+
+	assert.Equal(t, []string{"tikz", "other"}, idx.UnknownPackages([]Dependency{
+		{Command: "usepackage", Target: "tikz"},
+		{Command: "usepackage", Target: "xcolor"},
+		{Command: "RequirePackage", Target: "tikz"},
+		{Command: "usepackage", Target: "custom", Resolved: "custom.sty"},
+		{Command: "input", Target: "chapter"},
+		{Command: "RequirePackage", Target: "other"},
+	}))
+}
@@ -0,0 +1,202 @@
+package tex
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// A PostProcessor transforms the compiled PDF document, e.g. to convert
+// it into PDF/A. Post-processors run as steps (see Step) in the same
+// environment as the compiler, hence the tools must be installed there.
+type PostProcessor struct {
+	Name string
+
+	// Cmd returns the command line reading the PDF file in, and writing
+	// the processed PDF file to out.
+	Cmd func(in, out string) []string
+
+	// Files are auxiliary files the command reads. Like secrets, they
+	// are only present in the working directory while the step runs.
+	Files map[string]Secret
+}
+
+// Auxiliary files for the pdfa post-processor.
+const (
+	pdfaDefFile = internalPrefix + "pdfa.ps"
+	pdfaICCFile = internalPrefix + "pdfa.icc"
+)
+
+// pdfaDef is the PostScript prefix file for Ghostscript, declaring the
+// sRGB output intent required by PDF/A (adapted from Ghostscript's
+// PDFA_def.ps).
+const pdfaDef = `%!
+[/_objdef {icc_PDFA} /type /stream /OBJ pdfmark
+[{icc_PDFA} <</N 3>> /PUT pdfmark
+[{icc_PDFA} (` + pdfaICCFile + `) (r) file /PUT pdfmark
+[/_objdef {OutputIntent_PDFA} /type /dict /OBJ pdfmark
+[{OutputIntent_PDFA} <<
+  /Type /OutputIntent
+  /S /GTS_PDFA1
+  /DestOutputProfile {icc_PDFA}
+  /OutputConditionIdentifier (sRGB)
+  /Info (sRGB)
+>> /PUT pdfmark
+[{Catalog} <</OutputIntents [{OutputIntent_PDFA}]>> /PUT pdfmark
+`
+
+// postProcessors lists the supported post-processors in the order they
+// are applied. Linearization comes last, because rewriting a PDF file
+// with Ghostscript discards the linearization.
+var postProcessors = []PostProcessor{{
+	// recompresses images with reduced resolution (150 dpi)
+	Name: "compress",
+	Cmd: func(in, out string) []string {
+		return []string{
+			"gs", "-q", "-dBATCH", "-dNOPAUSE", "-dSAFER",
+			"-sDEVICE=pdfwrite",
+			"-dPDFSETTINGS=/ebook",
+			"-sOutputFile=" + out,
+			in,
+		}
+	},
+}, {
+	// converts to PDF/A-2b, and fails for content which can't be
+	// converted (instead of dropping it)
+	Name: "pdfa",
+	Cmd: func(in, out string) []string {
+		return []string{
+			"gs", "-q", "-dBATCH", "-dNOPAUSE", "-dSAFER",
+			"--permit-file-read=" + pdfaICCFile,
+			"-sDEVICE=pdfwrite",
+			"-dPDFA=2",
+			"-dPDFACompatibilityPolicy=2",
+			"-sColorConversionStrategy=RGB",
+			"-sOutputFile=" + out,
+			pdfaDefFile,
+			in,
+		}
+	},
+	Files: map[string]Secret{
+		pdfaDefFile: pdfaDef,
+		pdfaICCFile: Secret(srgbProfile),
+	},
+}, {
+	// optimizes for web viewing ("fast web view")
+	Name: "linearize",
+	Cmd: func(in, out string) []string {
+		return []string{"qpdf", "--linearize", in, out}
+	},
+}}
+
+// SupportedPostProcessors lists the names of all known post-processors,
+// in the order they are applied.
+func SupportedPostProcessors() (names []string) {
+	for _, p := range postProcessors {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// ParsePostProcess parses a comma separated list of post-processor names.
+// Duplicates are removed, and the result is ordered like
+// SupportedPostProcessors().
+func ParsePostProcess(list string) ([]string, error) {
+	var names []string
+	for name := range strings.SplitSeq(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || slices.Contains(names, name) {
+			continue
+		}
+		if !slices.Contains(SupportedPostProcessors(), name) {
+			return nil, fmt.Errorf("unsupported post-processor: %q", name)
+		}
+		names = append(names, name)
+	}
+
+	var sorted []string
+	for _, p := range postProcessors {
+		if slices.Contains(names, p.Name) {
+			sorted = append(sorted, p.Name)
+		}
+	}
+	return sorted, nil
+}
+
+// WithPostProcess returns a copy of o, which applies the post-processors
+// given as comma separated list (see ParsePostProcess). Post-processing
+// is only supported for PDF output.
+func (o Output) WithPostProcess(list string) (Output, error) {
+	names, err := ParsePostProcess(list)
+	if err != nil {
+		return o, err
+	}
+	if len(names) > 0 && !o.IsPDF() {
+		return o, fmt.Errorf("post-processing is not supported for format %q", o.Format)
+	}
+	o.PostProcess = names
+	return o, nil
+}
+
+// postProcessSteps returns the steps merging other PDF files, applying the
+// selected post-processors and the metadata, the encryption and the
+// signature to the PDF file, and the name of the resulting PDF file. Each
+// step writes a new file, leaving its input untouched.
+func (o Output) postProcessSteps(pdf string) (steps []Step, result string) {
+	result = pdf
+	if o.Merge != nil {
+		step := o.Merge.mergeStep(result)
+		steps = append(steps, step)
+		result = step.Output
+	}
+	metadata := o.Metadata
+	applyMetadata := func() {
+		if metadata != nil {
+			s := metadata.metadataSteps(result)
+			steps = append(steps, s...)
+			result = s[len(s)-1].Output
+			metadata = nil
+		}
+	}
+	for _, p := range postProcessors {
+		if !slices.Contains(o.PostProcess, p.Name) {
+			continue
+		}
+		if p.Name != "compress" {
+			// Ghostscript discards XMP packets when compressing, hence
+			// the metadata is applied afterwards. It's applied before
+			// the PDF/A conversion (which derives its XMP packet from
+			// the document info) and the linearization (which must
+			// come last).
+			applyMetadata()
+		}
+		out := internalPrefix + p.Name + ".pdf"
+		steps = append(steps, Step{
+			Name:    p.Name,
+			Cmd:     p.Cmd(result, out),
+			Input:   result,
+			Output:  out,
+			Secrets: p.Files,
+		})
+		result = out
+	}
+	applyMetadata()
+	if o.Encryption != nil {
+		step := o.Encryption.encryptStep(result, slices.Contains(o.PostProcess, "linearize"))
+		steps = append(steps, step)
+		result = step.Output
+	}
+	if o.Signature != nil {
+		step := o.Signature.signStep(result)
+		steps = append(steps, step)
+		result = step.Output
+	}
+	return steps, result
+}
+
+// ResultFile returns the name of the final PDF file, given the name of
+// the compiled PDF file.
+func (o Output) ResultFile(pdf string) string {
+	_, result := o.postProcessSteps(pdf)
+	return result
+}
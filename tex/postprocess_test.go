@@ -0,0 +1,149 @@
+package tex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePostProcess(t *testing.T) {
+	t.Parallel()
+
+	for list, expected := range map[string][]string{
+		"":                          nil,
+		"linearize":                 {"linearize"},
+		"linearize, pdfa,linearize": {"pdfa", "linearize"},
+		"linearize,compress,pdfa":   {"compress", "pdfa", "linearize"},
+	} {
+		names, err := ParsePostProcess(list)
+		require.NoError(t, err, list)
+		assert.Equal(t, expected, names, list)
+	}
+
+	_, err := ParsePostProcess("pdfa,encrypt")
+	assert.EqualError(t, err, `unsupported post-processor: "encrypt"`)
+}
+
+func TestOutput_WithPostProcess(t *testing.T) {
+	t.Parallel()
+
+	o, err := Output{Format: FormatPDF}.WithPostProcess("linearize,pdfa")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pdfa", "linearize"}, o.PostProcess)
+	assert.Equal(t, "_texd-linearize.pdf", o.ResultFile("main.pdf"))
+
+	steps := o.steps("main.pdf")
+	require.Len(t, steps, 2)
+	assert.Equal(t, "pdfa", steps[0].Name)
+	assert.Equal(t, "main.pdf", steps[0].Input)
+	assert.Equal(t, "_texd-pdfa.pdf", steps[0].Output)
+	assert.Contains(t, steps[0].Cmd, "-dPDFA=2")
+	assert.Contains(t, steps[0].Cmd, "-dPDFACompatibilityPolicy=2")
+	assert.Equal(t, []string{"_texd-pdfa.ps", "main.pdf"}, steps[0].Cmd[len(steps[0].Cmd)-2:])
+	assert.Contains(t, steps[0].Secrets[pdfaDefFile], "(_texd-pdfa.icc) (r) file")
+	assert.Len(t, steps[0].Secrets[pdfaICCFile], len(srgbProfile))
+	assert.Equal(t, Step{
+		Name:   "linearize",
+		Cmd:    []string{"qpdf", "--linearize", "_texd-pdfa.pdf", "_texd-linearize.pdf"},
+		Input:  "_texd-pdfa.pdf",
+		Output: "_texd-linearize.pdf",
+	}, steps[1])
+
+	o, err = Output{}.WithPostProcess("")
+	require.NoError(t, err)
+	assert.Nil(t, o.steps("main.pdf"))
+	assert.Equal(t, "main.pdf", o.ResultFile("main.pdf"))
+
+	_, err = Output{Format: FormatPNG}.WithPostProcess("compress")
+	assert.EqualError(t, err, `post-processing is not supported for format "png"`)
+	_, err = Output{}.WithPostProcess("sign")
+	assert.EqualError(t, err, `unsupported post-processor: "sign"`)
+}
+
+func TestSRGBProfile(t *testing.T) {
+	t.Parallel()
+
+	p := srgbProfile
+	require.Greater(t, len(p), 128)
+	assert.EqualValues(t, len(p), binary.BigEndian.Uint32(p[0:]))
+	assert.Equal(t, "mntr", string(p[12:16]))
+	assert.Equal(t, "RGB ", string(p[16:20]))
+	assert.Equal(t, "XYZ ", string(p[20:24]))
+	assert.Equal(t, "acsp", string(p[36:40]))
+
+	n := int(binary.BigEndian.Uint32(p[128:]))
+	require.Equal(t, 9, n)
+	sigs := make([]string, 0, n)
+	for i := range n {
+		entry := p[132+12*i:]
+		offset, size := binary.BigEndian.Uint32(entry[4:]), binary.BigEndian.Uint32(entry[8:])
+		require.LessOrEqual(t, int(offset+size), len(p))
+		assert.Zero(t, offset%4)
+		sigs = append(sigs, string(entry[:4]))
+	}
+	assert.Equal(t, []string{"desc", "cprt", "wtpt", "rXYZ", "gXYZ", "bXYZ", "rTRC", "gTRC", "bTRC"}, sigs)
+}
+
+// TestPostProcess_pdfaConformance converts a PDF file with Ghostscript,
+// and validates the result with veraPDF. It is skipped, unless both tools
+// are installed.
+func TestPostProcess_pdfaConformance(t *testing.T) {
+	for _, tool := range []string{"gs", "verapdf"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not installed", tool)
+		}
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.pdf"), minimalPDF(), 0o600))
+
+	o, err := Output{Format: FormatPDF}.WithPostProcess("pdfa")
+	require.NoError(t, err)
+	steps := o.steps("main.pdf")
+	require.Len(t, steps, 1)
+	for name, contents := range steps[0].Secrets {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o600))
+	}
+	gs := exec.Command(steps[0].Cmd[0], steps[0].Cmd[1:]...)
+	gs.Dir = dir
+	out, err := gs.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	verapdf := exec.Command("verapdf", "--flavour", "2b", "--format", "text", steps[0].Output)
+	verapdf.Dir = dir
+	out, _ = verapdf.CombinedOutput()
+	assert.Contains(t, string(out), "PASS ", string(out))
+}
+
+// minimalPDF returns a single page PDF file, showing a colored rectangle.
+func minimalPDF() []byte {
+	content := "0.2 0.4 0.8 rg 72 72 451 698 re f"
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Contents 4 0 R /Resources << >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
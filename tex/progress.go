@@ -0,0 +1,96 @@
+package tex
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Progress event types.
+const (
+	ProgressPass    = "pass"    // a compiler pass started
+	ProgressPage    = "page"    // a page was shipped out
+	ProgressWarning = "warning" // a (new) warning was emitted
+)
+
+// A ProgressEvent describes the progress of a running compilation.
+type ProgressEvent struct {
+	Type string `json:"type"`
+
+	// Pass counts the compiler passes (starting at 1), Rule names the
+	// program run by latexmk in this pass (e.g. "xelatex", or "biber").
+	Pass int    `json:"pass,omitempty"`
+	Rule string `json:"rule,omitempty"`
+
+	// Page is the number of pages shipped out in the current pass.
+	Page int `json:"page,omitempty"`
+
+	// Message is the first line of a warning.
+	Message string `json:"message,omitempty"`
+}
+
+var (
+	// latexmk announces each program it runs, Tectonic announces reruns
+	latexmkPassPattern  = regexp.MustCompile(`^(?:Latexmk: applying rule|Run number \d+ of rule) '([^']+)'`)
+	tectonicPassPattern = regexp.MustCompile(`^note: (?:Running|Rerunning) TeX`)
+
+	// TeX prints "[<page>" when shipping out a page, optionally followed
+	// by included files ("{...}" and "<...>")
+	shipoutPattern = regexp.MustCompile(`\[(\d+)(?:[\]{<\s]|$)`)
+
+	warningPattern = regexp.MustCompile(`Warning:|^(?:Overfull|Underfull) \\[hv]box`)
+)
+
+// Progress parses the output of a compiler, and reports its progress.
+// It implements io.Writer, and expects each write to contain complete
+// lines (see exec.WithOutput). Progress is not safe for concurrent use.
+type Progress struct {
+	report   func(ProgressEvent)
+	pass     int
+	page     int
+	warnings map[string]bool // to skip repeated warnings of later passes
+}
+
+// NewProgress returns a Progress, which reports events to the given
+// function.
+func NewProgress(report func(ProgressEvent)) *Progress {
+	return &Progress{report: report, warnings: make(map[string]bool)}
+}
+
+func (p *Progress) Write(b []byte) (int, error) {
+	for line := range bytes.Lines(b) {
+		p.parseLine(strings.TrimRight(string(line), "\r\n"))
+	}
+	return len(b), nil
+}
+
+func (p *Progress) parseLine(line string) {
+	if m := latexmkPassPattern.FindStringSubmatch(line); m != nil {
+		p.startPass(m[1])
+		return
+	}
+	if tectonicPassPattern.MatchString(line) {
+		p.startPass("tectonic")
+		return
+	}
+	if warningPattern.MatchString(line) {
+		if msg := strings.TrimSpace(line); !p.warnings[msg] {
+			p.warnings[msg] = true
+			p.report(ProgressEvent{Type: ProgressWarning, Pass: p.pass, Message: msg})
+		}
+		return
+	}
+	for _, m := range shipoutPattern.FindAllStringSubmatch(line, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > p.page {
+			p.page = n
+			p.report(ProgressEvent{Type: ProgressPage, Pass: p.pass, Page: n})
+		}
+	}
+}
+
+func (p *Progress) startPass(rule string) {
+	p.pass++
+	p.page = 0
+	p.report(ProgressEvent{Type: ProgressPass, Pass: p.pass, Rule: rule})
+}
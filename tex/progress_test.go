@@ -0,0 +1,46 @@
+package tex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgress(t *testing.T) {
+	t.Parallel()
+
+	var events []ProgressEvent
+	p := NewProgress(func(ev ProgressEvent) { events = append(events, ev) })
+	for _, chunk := range []string{
+		"Rc files read:\n  NONE\nLatexmk: This is Latexmk, John Collins, 7 Jan. 2023. Version 4.79.\n",
+		"Latexmk: applying rule 'xelatex'...\n",
+		"(./main.tex [1] [2{/usr/share/texmf/fonts/enc/dvips/base/8r.enc}]\n",
+		"LaTeX Warning: Reference `fig' on page 2 undefined on input line 12.\n",
+		"Overfull \\hbox (15.0pt too wide) in paragraph at lines 3--4\r\n",
+		"[3] (./main.aux) [2022/01/01]\n",
+		"Run number 1 of rule 'biber'\n",
+		"Run number 2 of rule 'xelatex'\n",
+		"[1] [2] [3]\n",
+		"LaTeX Warning: Reference `fig' on page 2 undefined on input line 12.\n",
+		"note: Rerunning TeX because \"main.aux\" changed ...",
+	} {
+		n, err := p.Write([]byte(chunk))
+		assert.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+
+	assert.Equal(t, []ProgressEvent{
+		{Type: ProgressPass, Pass: 1, Rule: "xelatex"},
+		{Type: ProgressPage, Pass: 1, Page: 1},
+		{Type: ProgressPage, Pass: 1, Page: 2},
+		{Type: ProgressWarning, Pass: 1, Message: "LaTeX Warning: Reference `fig' on page 2 undefined on input line 12."},
+		{Type: ProgressWarning, Pass: 1, Message: "Overfull \\hbox (15.0pt too wide) in paragraph at lines 3--4"},
+		{Type: ProgressPage, Pass: 1, Page: 3},
+		{Type: ProgressPass, Pass: 2, Rule: "biber"},
+		{Type: ProgressPass, Pass: 3, Rule: "xelatex"},
+		{Type: ProgressPage, Pass: 3, Page: 1},
+		{Type: ProgressPage, Pass: 3, Page: 2},
+		{Type: ProgressPage, Pass: 3, Page: 3},
+		{Type: ProgressPass, Pass: 4, Rule: "tectonic"},
+	}, events)
+}
@@ -0,0 +1,90 @@
+package tex
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// ParseReproducible parses the value of the reproducible= parameter. It
+// accepts a boolean, or a Unix timestamp used as source date (e.g. the
+// invoice date). For "true", the source date is the Unix epoch.
+func ParseReproducible(s string) (epoch int64, ok bool, err error) {
+	switch s {
+	case "", "0", "false", "no", "off":
+		return 0, false, nil
+	case "1", "true", "yes", "on":
+		return 0, true, nil
+	}
+	epoch, err = strconv.ParseInt(s, 10, 64)
+	if err != nil || epoch < 0 {
+		return 0, false, fmt.Errorf("invalid reproducible value: %q", s)
+	}
+	return epoch, true, nil
+}
+
+// WithReproducible returns a copy of o, which produces reproducible PDF
+// documents: The engines use the given source date (instead of the
+// current time) for creation dates and trailer IDs, and the trailer IDs
+// of the result PDF are derived from its content. Encryption and
+// signatures are inherently not reproducible, and can't be combined.
+func (o Output) WithReproducible(epoch int64) (Output, error) {
+	if o.Encryption != nil || o.Signature != nil {
+		return o, errors.New("reproducible builds can't be combined with encryption or signatures")
+	}
+	o.Reproducible = true
+	o.SourceDateEpoch = epoch
+	return o, nil
+}
+
+// environ returns the environment variables required for reproducible
+// builds. SOURCE_DATE_EPOCH is honoured by all engines (pdfTeX, LuaTeX,
+// XeTeX/xdvipdfmx, Tectonic) and Ghostscript. FORCE_SOURCE_DATE makes
+// the TeX engines use it for \today and \time as well.
+func (o Output) environ() []string {
+	if !o.Reproducible {
+		return nil
+	}
+	return []string{
+		"SOURCE_DATE_EPOCH=" + strconv.FormatInt(o.SourceDateEpoch, 10),
+		"FORCE_SOURCE_DATE=1",
+	}
+}
+
+// trailerIDPattern matches the /ID entry of trailers and cross-reference
+// stream dictionaries. The engines write IDs as hex strings.
+var trailerIDPattern = regexp.MustCompile(`/ID\s*\[\s*<([0-9A-Fa-f]*)>\s*<([0-9A-Fa-f]*)>\s*\]`)
+
+// normalizeTrailerIDs replaces the trailer IDs in pdf with a hash of the
+// remaining content, ignoring the IDs themselves. The IDs keep their
+// length, so byte offsets (e.g. in cross-reference tables) stay valid.
+// Returns false, if pdf has no trailer ID.
+func normalizeTrailerIDs(pdf []byte) bool {
+	matches := trailerIDPattern.FindAllSubmatchIndex(pdf, -1)
+	if len(matches) == 0 {
+		return false
+	}
+
+	// blank out the IDs, then hash
+	for _, m := range matches {
+		for i := 2; i < len(m); i += 2 {
+			copy(pdf[m[i]:m[i+1]], bytes.Repeat([]byte{'0'}, m[i+1]-m[i]))
+		}
+	}
+	sum := sha256.Sum256(pdf)
+	digest := []byte(hex.EncodeToString(sum[:]))
+
+	for _, m := range matches {
+		for i := 2; i < len(m); i += 2 {
+			id := pdf[m[i]:m[i+1]]
+			for j := range id {
+				id[j] = digest[j%len(digest)]
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package tex
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReproducible(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		input string
+		epoch int64
+		ok    bool
+		err   string
+	}{
+		{input: ""},
+		{input: "false"},
+		{input: "0"},
+		{input: "true", ok: true},
+		{input: "1", ok: true},
+		{input: "1700000000", epoch: 1700000000, ok: true},
+		{input: "-1", err: `invalid reproducible value: "-1"`},
+		{input: "maybe", err: `invalid reproducible value: "maybe"`},
+	} {
+		epoch, ok, err := ParseReproducible(tt.input)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err, tt.input)
+			continue
+		}
+		require.NoError(t, err, tt.input)
+		assert.Equal(t, tt.epoch, epoch, tt.input)
+		assert.Equal(t, tt.ok, ok, tt.input)
+	}
+}
+
+func TestOutput_WithReproducible(t *testing.T) {
+	t.Parallel()
+
+	assert.Empty(t, Output{}.environ())
+
+	o, err := Output{}.WithReproducible(1700000000)
+	require.NoError(t, err)
+	assert.True(t, o.Reproducible)
+	assert.Equal(t, []string{"SOURCE_DATE_EPOCH=1700000000", "FORCE_SOURCE_DATE=1"}, o.environ())
+
+	_, err = o.WithEncryption(&Encryption{UserPassword: "secret"})
+	assert.EqualError(t, err, "encryption can't be combined with reproducible builds")
+	_, err = o.WithSignature(SigningKey{Name: "test"}, "")
+	assert.EqualError(t, err, "signatures can't be combined with reproducible builds")
+
+	_, err = Output{Encryption: &Encryption{}}.WithReproducible(0)
+	assert.EqualError(t, err, "reproducible builds can't be combined with encryption or signatures")
+}
+
+func TestNormalizeTrailerIDs(t *testing.T) {
+	t.Parallel()
+
+	const pdf = "%%PDF-1.5\n1 0 obj\n<< >>\nendobj\n" +
+		"trailer\n<< /Size 2 /ID [<%s> <%s>] >>\n%%%%EOF\n"
+	render := func(a, b string) []byte {
+		return []byte(fmt.Sprintf(pdf, a, b))
+	}
+
+	assert.False(t, normalizeTrailerIDs([]byte("%PDF-1.5\n%%EOF\n")))
+
+	first := render("0123456789ABCDEF0123456789ABCDEF", "FEDCBA9876543210FEDCBA9876543210")
+	second := render("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", "BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB")
+	size := len(first)
+	require.True(t, normalizeTrailerIDs(first))
+	require.True(t, normalizeTrailerIDs(second))
+	assert.Len(t, first, size)
+	assert.Equal(t, string(first), string(second))
+	assert.Regexp(t, `/ID \[<[0-9a-f]{32}> <[0-9a-f]{32}>\]`, string(first))
+
+	// different content yields different IDs
+	other := []byte(strings.Replace(string(render("00", "00")), "<< >>", "<< /A 1 >>", 1))
+	same := render("00", "00")
+	require.True(t, normalizeTrailerIDs(other))
+	require.True(t, normalizeTrailerIDs(same))
+	assert.NotEqual(t,
+		trailerIDPattern.FindSubmatch(other)[1],
+		trailerIDPattern.FindSubmatch(same)[1])
+}
@@ -0,0 +1,240 @@
+package tex
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A SigningKey is a server-side key and certificate for signing PDF
+// documents. Clients reference keys by name.
+//
+// The key material is passed to the signing tool (pyHanko) as secret
+// files (see Step.Secrets), hence it is loaded into memory.
+type SigningKey struct {
+	Name string
+
+	// Either Cert and Key (PEM encoded, the key must not be encrypted),
+	// or PKCS12 and Passphrase are present.
+	Cert, Key          Secret
+	PKCS12, Passphrase Secret
+
+	// TSA is the URL of a RFC 3161 time-stamping authority. When present,
+	// signatures include a trusted timestamp (PAdES B-T). Note that the
+	// TSA must be reachable from where the signing tool runs. Without
+	// TSA, only the signing time claimed by the signer (the /M entry of
+	// the signature dictionary, taken from the clock where the signing
+	// tool runs) is recorded (PAdES B-B).
+	TSA string
+
+	// NotAfter is the certificate's expiry date (PEM only).
+	NotAfter time.Time
+}
+
+var signingKeyNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// ParseSigningKey parses a signing key definition and loads the
+// referenced files. The definition has the form "name=params", where
+// params is a URL query string with either cert= and key= (PEM files),
+// or p12= and optionally passfile= (PKCS#12 file, and a file containing
+// its passphrase), plus an optional tsa= URL:
+//
+//	contracts=cert=/etc/texd/sign.crt&key=/etc/texd/sign.key
+//	invoices=p12=/etc/texd/invoices.p12&passfile=/etc/texd/invoices.pass&tsa=http://tsa.example.com
+//
+// PEM certificates and keys are verified to match each other.
+func ParseSigningKey(def string) (SigningKey, error) {
+	name, query, ok := strings.Cut(def, "=")
+	if !ok || !signingKeyNamePattern.MatchString(name) {
+		return SigningKey{}, fmt.Errorf("invalid signing key definition %q: expected name=params", def)
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("invalid signing key %q: %w", name, err)
+	}
+	for key := range params {
+		switch key {
+		case "cert", "key", "p12", "passfile", "tsa":
+		default:
+			return SigningKey{}, fmt.Errorf("invalid signing key %q: unsupported parameter %q", name, key)
+		}
+	}
+
+	key := SigningKey{Name: name, TSA: params.Get("tsa")}
+	if key.TSA != "" {
+		if u, err := url.Parse(key.TSA); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return SigningKey{}, fmt.Errorf("invalid signing key %q: invalid TSA URL %q", name, key.TSA)
+		}
+	}
+
+	switch {
+	case params.Has("p12") && !params.Has("cert") && !params.Has("key"):
+		err = key.loadPKCS12(params.Get("p12"), params.Get("passfile"))
+	case params.Has("cert") && params.Has("key") && !params.Has("p12") && !params.Has("passfile"):
+		err = key.loadPEM(params.Get("cert"), params.Get("key"))
+	default:
+		err = errors.New("expected either cert and key, or p12 parameters")
+	}
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("invalid signing key %q: %w", name, err)
+	}
+	return key, nil
+}
+
+func (k *SigningKey) loadPKCS12(file, passfile string) error {
+	p12, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	k.PKCS12 = Secret(p12)
+	if passfile != "" {
+		pass, err := os.ReadFile(passfile)
+		if err != nil {
+			return err
+		}
+		k.Passphrase = Secret(strings.TrimRight(string(pass), "\r\n"))
+	}
+	return nil
+}
+
+func (k *SigningKey) loadPEM(certFile, keyFile string) error {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return fmt.Errorf("no PEM certificate found in %s", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	block, _ = pem.Decode(keyPEM)
+	if block == nil || !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+		return fmt.Errorf("no PEM private key found in %s", keyFile)
+	}
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		return fmt.Errorf("encrypted private keys are not supported, use a PKCS#12 file instead")
+	}
+	priv, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse private key: %w", err)
+	}
+	pub, ok := priv.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(cert.PublicKey) {
+		return errors.New("private key does not match certificate")
+	}
+
+	k.Cert = Secret(certPEM)
+	k.Key = Secret(keyPEM)
+	k.NotAfter = cert.NotAfter
+	return nil
+}
+
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, errors.New("unsupported key type")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	return x509.ParseECPrivateKey(der)
+}
+
+// signatureField is the name of the signature field added to documents.
+const signatureField = "Signature1"
+
+// A Signature configures the signing of the result PDF.
+type Signature struct {
+	Key SigningKey
+
+	// Box is the position of a visible signature field, as
+	// "PAGE/X1,Y1,X2,Y2" (in PDF points, from the lower left corner).
+	// If empty, the signature is invisible.
+	Box string
+}
+
+var signatureBoxPattern = regexp.MustCompile(`^([1-9][0-9]*)/([0-9]+),([0-9]+),([0-9]+),([0-9]+)$`)
+
+// WithSignature returns a copy of o, which signs the result PDF with the
+// given key, after all other post-processing steps. Signatures are only
+// supported for PDF output, and can't be combined with encryption.
+func (o Output) WithSignature(key SigningKey, box string) (Output, error) {
+	if !o.IsPDF() {
+		return o, fmt.Errorf("signing is not supported for format %q", o.Format)
+	}
+	if o.Encryption != nil {
+		return o, errors.New("signing encrypted documents is not supported")
+	}
+	if o.Reproducible {
+		return o, errors.New("signatures can't be combined with reproducible builds")
+	}
+	if box != "" {
+		m := signatureBoxPattern.FindStringSubmatch(box)
+		if m == nil {
+			return o, fmt.Errorf("invalid signature box %q: expected PAGE/X1,Y1,X2,Y2", box)
+		}
+		x1, _ := strconv.Atoi(m[2])
+		y1, _ := strconv.Atoi(m[3])
+		x2, _ := strconv.Atoi(m[4])
+		y2, _ := strconv.Atoi(m[5])
+		if x1 >= x2 || y1 >= y2 {
+			return o, fmt.Errorf("invalid signature box %q: empty area", box)
+		}
+	}
+	o.Signature = &Signature{Key: key, Box: box}
+	return o, nil
+}
+
+// signStep returns the pyHanko invocation signing the PDF file in. The
+// key material is only written to the working directory while the step
+// runs (see Step.Secrets).
+func (s *Signature) signStep(in string) Step {
+	out := internalPrefix + "sign.pdf"
+
+	field := signatureField
+	if s.Box != "" {
+		field = s.Box + "/" + signatureField
+	}
+	cmd := []string{"pyhanko", "sign", "addsig", "--field", field, "--use-pades"}
+	if s.Key.TSA != "" {
+		cmd = append(cmd, "--timestamp-url", s.Key.TSA)
+	}
+
+	var secrets map[string]Secret
+	if s.Key.PKCS12 != "" {
+		p12, pass := internalPrefix+"sign.p12", internalPrefix+"sign.pass"
+		secrets = map[string]Secret{p12: s.Key.PKCS12, pass: s.Key.Passphrase}
+		cmd = append(cmd, "pkcs12", "--passfile", pass, in, out, p12)
+	} else {
+		cert, key := internalPrefix+"sign.crt", internalPrefix+"sign.key"
+		secrets = map[string]Secret{cert: s.Key.Cert, key: s.Key.Key}
+		cmd = append(cmd, "pemder", "--no-pass", "--cert", cert, "--key", key, in, out)
+	}
+
+	return Step{
+		Name:    "sign",
+		Cmd:     cmd,
+		Input:   in,
+		Output:  out,
+		Secrets: secrets,
+	}
+}
@@ -0,0 +1,175 @@
+package tex
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestKey creates a self-signed certificate and its private key,
+// and returns the PEM file names.
+func writeTestKey(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "texd test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestParseSigningKey(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certFile, keyFile := writeTestKey(t, dir, "a")
+	_, otherKey := writeTestKey(t, dir, "b")
+	p12File, passFile := filepath.Join(dir, "c.p12"), filepath.Join(dir, "c.pass")
+	require.NoError(t, os.WriteFile(p12File, []byte("\x30\x82"), 0o600))
+	require.NoError(t, os.WriteFile(passFile, []byte("geheim\n"), 0o600))
+
+	key, err := ParseSigningKey("contracts=cert=" + certFile + "&key=" + keyFile + "&tsa=http://tsa.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "contracts", key.Name)
+	assert.Equal(t, "http://tsa.example.com", key.TSA)
+	assert.Contains(t, string(key.Cert), "BEGIN CERTIFICATE")
+	assert.Contains(t, string(key.Key), "BEGIN PRIVATE KEY")
+	assert.WithinDuration(t, time.Now().Add(time.Hour), key.NotAfter, time.Minute)
+
+	key, err = ParseSigningKey("invoices=p12=" + p12File + "&passfile=" + passFile)
+	require.NoError(t, err)
+	assert.Equal(t, Secret("\x30\x82"), key.PKCS12)
+	assert.Equal(t, Secret("geheim"), key.Passphrase)
+
+	for def, msg := range map[string]string{
+		"Contracts=cert=a&key=b":                     `invalid signing key definition "Contracts=cert=a&key=b": expected name=params`,
+		"k=cert=" + certFile:                         `invalid signing key "k": expected either cert and key, or p12 parameters`,
+		"k=p12=" + p12File + "&key=" + keyFile:       `invalid signing key "k": expected either cert and key, or p12 parameters`,
+		"k=pin=1234":                                 `invalid signing key "k": unsupported parameter "pin"`,
+		"k=p12=" + p12File + "&tsa=ftp://x":          `invalid signing key "k": invalid TSA URL "ftp://x"`,
+		"k=cert=" + certFile + "&key=" + otherKey:    `invalid signing key "k": private key does not match certificate`,
+		"k=cert=" + keyFile + "&key=" + keyFile:      `invalid signing key "k": no PEM certificate found in ` + keyFile,
+		"k=cert=" + certFile + "&key=" + certFile:    `invalid signing key "k": no PEM private key found in ` + certFile,
+		"k=p12=" + filepath.Join(dir, "missing.p12"): `invalid signing key "k": open ` + filepath.Join(dir, "missing.p12") + `: no such file or directory`,
+	} {
+		_, err := ParseSigningKey(def)
+		assert.EqualError(t, err, msg, def)
+	}
+}
+
+func TestOutput_WithSignature(t *testing.T) {
+	t.Parallel()
+
+	pem := SigningKey{Name: "contracts", Cert: "cert", Key: "key", TSA: "http://tsa.example.com"}
+	o, err := Output{}.WithSignature(pem, "")
+	require.NoError(t, err)
+	assert.Equal(t, "_texd-sign.pdf", o.ResultFile("main.pdf"))
+	assert.Equal(t, []Step{{
+		Name: "sign",
+		Cmd: []string{
+			"pyhanko", "sign", "addsig", "--field", "Signature1", "--use-pades",
+			"--timestamp-url", "http://tsa.example.com",
+			"pemder", "--no-pass", "--cert", "_texd-sign.crt", "--key", "_texd-sign.key",
+			"main.pdf", "_texd-sign.pdf",
+		},
+		Input:   "main.pdf",
+		Output:  "_texd-sign.pdf",
+		Secrets: map[string]Secret{"_texd-sign.crt": "cert", "_texd-sign.key": "key"},
+	}}, o.steps("main.pdf"))
+
+	_, err = o.WithEncryption(&Encryption{})
+	assert.EqualError(t, err, "encrypting signed documents is not supported")
+
+	p12 := SigningKey{Name: "invoices", PKCS12: "p12", Passphrase: "pass"}
+	o, err = Output{PostProcess: []string{"pdfa"}}.WithSignature(p12, "1/50,50,250,100")
+	require.NoError(t, err)
+	steps := o.steps("main.pdf")
+	require.Len(t, steps, 2)
+	assert.Equal(t, []string{
+		"pyhanko", "sign", "addsig", "--field", "1/50,50,250,100/Signature1", "--use-pades",
+		"pkcs12", "--passfile", "_texd-sign.pass", "_texd-pdfa.pdf", "_texd-sign.pdf", "_texd-sign.p12",
+	}, steps[1].Cmd)
+	assert.Equal(t, map[string]Secret{"_texd-sign.p12": "p12", "_texd-sign.pass": "pass"}, steps[1].Secrets)
+
+	for box, msg := range map[string]string{
+		"0/1,1,2,2":     `invalid signature box "0/1,1,2,2": expected PAGE/X1,Y1,X2,Y2`,
+		"1/1,1,2":       `invalid signature box "1/1,1,2": expected PAGE/X1,Y1,X2,Y2`,
+		"1/10,10,10,20": `invalid signature box "1/10,10,10,20": empty area`,
+	} {
+		_, err = Output{}.WithSignature(p12, box)
+		assert.EqualError(t, err, msg, box)
+	}
+
+	_, err = Output{Format: FormatPNG}.WithSignature(p12, "")
+	assert.EqualError(t, err, `signing is not supported for format "png"`)
+	_, err = Output{Encryption: &Encryption{}}.WithSignature(p12, "")
+	assert.EqualError(t, err, "signing encrypted documents is not supported")
+}
+
+// TestSignStep_signingTime signs a PDF file without time-stamping
+// authority, and checks the signature dictionary records the signing
+// time. It is skipped, unless pyHanko is installed.
+func TestSignStep_signingTime(t *testing.T) {
+	if _, err := exec.LookPath("pyhanko"); err != nil {
+		t.Skip("pyhanko not installed")
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := writeTestKey(t, dir, "sign")
+	key, err := ParseSigningKey("test=cert=" + certFile + "&key=" + keyFile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.pdf"), minimalPDF(), 0o600))
+
+	o, err := Output{}.WithSignature(key, "")
+	require.NoError(t, err)
+	steps := o.steps("main.pdf")
+	require.Len(t, steps, 1)
+	assert.NotContains(t, steps[0].Cmd, "--timestamp-url")
+	for name, contents := range steps[0].Secrets {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o600))
+	}
+	start := time.Now().UTC().Truncate(time.Second)
+	cmd := exec.Command(steps[0].Cmd[0], steps[0].Cmd[1:]...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	signed, err := os.ReadFile(filepath.Join(dir, steps[0].Output))
+	require.NoError(t, err)
+	m := regexp.MustCompile(`/M\s*\(D:(\d{14})(?:Z|([-+]\d{2})'(\d{2}))?`).FindSubmatch(signed)
+	require.NotNil(t, m, "signing time (/M) missing")
+	offset := "+0000"
+	if len(m[2]) > 0 {
+		offset = string(m[2]) + string(m[3])
+	}
+	signingTime, err := time.Parse("20060102150405-0700", string(m[1])+offset)
+	require.NoError(t, err)
+	assert.WithinDuration(t, start, signingTime, time.Minute)
+}
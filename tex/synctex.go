@@ -0,0 +1,376 @@
+package tex
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// maxSyncTeXSize limits the size of uncompressed SyncTeX files.
+const maxSyncTeXSize = 128 << 20
+
+// SyncTeX holds the contents of a SyncTeX file, which maps positions in
+// the input files to positions in the output document, and vice versa.
+// See https://github.com/jlaurens/synctex for the file format.
+type SyncTeX struct {
+	inputs  map[int]string // file names by tag
+	root    string         // directory of the main input file
+	records []syncRecord
+
+	unit, magnification float64
+	xOffset, yOffset    float64
+}
+
+// A syncRecord is a box, or a point (kern, glue, math, current) on a page.
+type syncRecord struct {
+	kind                 byte
+	page                 int
+	tag, line            int
+	h, v                 int // in scaled points (times unit)
+	width, height, depth int
+}
+
+func (r syncRecord) isBox() bool {
+	switch r.kind {
+	case '[', '(', 'v', 'h':
+		return true
+	}
+	return false
+}
+
+// A SyncTeXBox is a rectangle on a page of the output document, in PDF
+// points (1/72 inch), measured from the upper left corner of the page.
+// Width and Height are zero for single points.
+type SyncTeXBox struct {
+	Page   int     `json:"page"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// A SyncTeXPosition is a line in an input file. File names are relative
+// to the directory of the main input file, unless the file is located
+// outside the working directory (e.g. a class file from the TeX
+// distribution).
+type SyncTeXPosition struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// ParseSyncTeX parses an uncompressed SyncTeX file.
+func ParseSyncTeX(r io.Reader) (*SyncTeX, error) {
+	s := &SyncTeX{
+		inputs:        make(map[int]string),
+		unit:          1,
+		magnification: 1000,
+	}
+
+	sc := bufio.NewScanner(io.LimitReader(r, maxSyncTeXSize))
+	sc.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	content, page, lineNum := false, 0, 0
+	for sc.Scan() {
+		lineNum++
+		line := sc.Text()
+		if name, ok := strings.CutPrefix(line, "Input:"); ok {
+			if err := s.addInput(name); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			continue
+		}
+		if !content {
+			if err := s.parseHeader(line); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			content = line == "Content:"
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		if line == "Postamble:" {
+			break
+		}
+
+		switch kind := line[0]; kind {
+		case '{':
+			n, err := strconv.Atoi(line[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid page: %w", lineNum, err)
+			}
+			page = n
+		case '}':
+			page = 0
+		case '[', '(', 'v', 'h', 'x', 'k', 'g', '$':
+			rec, err := parseSyncRecord(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			rec.page = page
+			s.records = append(s.records, rec)
+		default:
+			// box ends, byte offsets ("!"), forms, etc.
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if !content {
+		return nil, errors.New("no content found")
+	}
+	return s, nil
+}
+
+func (s *SyncTeX) addInput(def string) error {
+	tag, name, ok := strings.Cut(def, ":")
+	n, err := strconv.Atoi(tag)
+	if !ok || err != nil {
+		return fmt.Errorf("invalid input: %q", def)
+	}
+	if len(s.inputs) == 0 && !strings.Contains(name, "/./") {
+		s.root = path.Dir(path.Clean(name))
+	}
+	s.inputs[n] = name
+	return nil
+}
+
+func (s *SyncTeX) parseHeader(line string) (err error) {
+	key, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return nil
+	}
+	var dst *float64
+	switch key {
+	case "Unit":
+		dst = &s.unit
+	case "Magnification":
+		dst = &s.magnification
+	case "X Offset":
+		dst = &s.xOffset
+	case "Y Offset":
+		dst = &s.yOffset
+	default:
+		return nil
+	}
+	if *dst, err = strconv.ParseFloat(value, 64); err != nil {
+		return fmt.Errorf("invalid %s: %w", strings.ToLower(key), err)
+	}
+	return nil
+}
+
+// syncRecordPattern matches "tag,line[,column]:h,v[:width[,height,depth]]".
+var syncRecordPattern = regexp.MustCompile(`^(\d+),(\d+)(?:,-?\d+)?:(-?\d+),(-?\d+)(?::(-?\d+)(?:,(-?\d+),(-?\d+))?)?$`)
+
+func parseSyncRecord(line string) (rec syncRecord, err error) {
+	m := syncRecordPattern.FindStringSubmatch(line[1:])
+	if m == nil {
+		return rec, fmt.Errorf("invalid record: %q", line)
+	}
+	var n [7]int
+	for i, s := range m[1:] {
+		if s == "" {
+			continue
+		}
+		if n[i], err = strconv.Atoi(s); err != nil {
+			return rec, fmt.Errorf("invalid record: %q", line)
+		}
+	}
+	return syncRecord{
+		kind:   line[0],
+		tag:    n[0],
+		line:   n[1],
+		h:      n[2],
+		v:      n[3],
+		width:  n[4],
+		height: n[5],
+		depth:  n[6],
+	}, nil
+}
+
+// toPoints converts a dimension (in scaled points times unit) into PDF
+// points, honouring the magnification.
+func (s *SyncTeX) toPoints(dim int, offset float64) float64 {
+	sp := (float64(dim)*s.unit + offset) * s.magnification / 1000
+	return math.Round(sp/65536*72/72.27*100) / 100
+}
+
+func (s *SyncTeX) box(r syncRecord) SyncTeXBox {
+	return SyncTeXBox{
+		Page:   r.page,
+		X:      s.toPoints(r.h, s.xOffset),
+		Y:      s.toPoints(r.v-r.height, s.yOffset),
+		Width:  s.toPoints(r.width, 0),
+		Height: s.toPoints(r.height+r.depth, 0),
+	}
+}
+
+// relName returns the name of an input file, relative to the main input
+// file's directory.
+func (s *SyncTeX) relName(name string) string {
+	if i := strings.LastIndex(name, "/./"); i >= 0 {
+		return path.Clean(name[i+3:])
+	}
+	name = path.Clean(name)
+	if s.root != "" && s.root != "/" && strings.HasPrefix(name, s.root+"/") {
+		return strings.TrimPrefix(name, s.root+"/")
+	}
+	return name
+}
+
+// Forward finds the positions in the output document, which correspond
+// to the given line of an input file. If there are no records for the
+// line, the closest line with records is used instead. It returns the
+// line actually used.
+func (s *SyncTeX) Forward(file string, line int) (int, []SyncTeXBox, error) {
+	file = path.Clean(file)
+	tags := make(map[int]bool)
+	for tag, name := range s.inputs {
+		if s.relName(name) == file {
+			tags[tag] = true
+		}
+	}
+	if len(tags) == 0 {
+		return 0, nil, fmt.Errorf("unknown input file: %q", file)
+	}
+
+	best := -1
+	for _, r := range s.records {
+		if r.page > 0 && tags[r.tag] && (best < 0 || closer(r.line, best, line)) {
+			best = r.line
+		}
+	}
+	if best < 0 {
+		return 0, nil, fmt.Errorf("no records for input file: %q", file)
+	}
+
+	// prefer horizontal boxes, which span the line's content
+	var boxes, points []SyncTeXBox
+	for _, r := range s.records {
+		if r.page == 0 || !tags[r.tag] || r.line != best {
+			continue
+		}
+		if r.kind == '(' || r.kind == 'h' {
+			boxes = append(boxes, s.box(r))
+		} else {
+			points = append(points, s.box(r))
+		}
+	}
+	if len(boxes) == 0 {
+		boxes = points
+	}
+	return best, boxes, nil
+}
+
+// closer reports whether a is closer to want than b. Ties are resolved
+// in favour of the following line.
+func closer(a, b, want int) bool {
+	da, db := abs(a-want), abs(b-want)
+	return da < db || da == db && a > b
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Reverse finds the input file and line, which correspond to the given
+// position on a page of the output document (in PDF points, measured
+// from the upper left corner). It prefers the smallest box containing
+// the position, and falls back to the closest record.
+func (s *SyncTeX) Reverse(page int, x, y float64) (SyncTeXPosition, error) {
+	var (
+		found    *syncRecord
+		bestArea = math.Inf(1)
+		bestDist = math.Inf(1)
+		inBox    bool
+	)
+	for i, r := range s.records {
+		if r.page != page || r.line <= 0 {
+			continue
+		}
+		b := s.box(r)
+		if r.isBox() && b.X <= x && x <= b.X+b.Width && b.Y <= y && y <= b.Y+b.Height {
+			if area := b.Width * b.Height; !inBox || area < bestArea {
+				found, bestArea, inBox = &s.records[i], area, true
+			}
+			continue
+		}
+		if inBox {
+			continue
+		}
+		bx, by := s.toPoints(r.h, s.xOffset), s.toPoints(r.v, s.yOffset)
+		if dist := math.Hypot(bx-x, by-y); dist < bestDist {
+			found, bestDist = &s.records[i], dist
+		}
+	}
+	if found == nil {
+		return SyncTeXPosition{}, fmt.Errorf("no records on page %d", page)
+	}
+	return SyncTeXPosition{File: s.relName(s.inputs[found.tag]), Line: found.line}, nil
+}
+
+// jobNamePattern matches working directory names (see SetWorkingDirName),
+// which are request IDs.
+var jobNamePattern = regexp.MustCompile(`^[0-9A-Za-z-]{1,64}$`)
+
+// LoadSyncTeX reads the SyncTeX file of a retained job, identified by the
+// name of its working directory (see Document.SetWorkingDirName).
+func LoadSyncTeX(job string) (*SyncTeX, error) {
+	if !jobNamePattern.MatchString(job) {
+		return nil, InputError("invalid job", nil, KV{"job": job})
+	}
+	dir := jobDir(job)
+	if _, err := texFs.Stat(dir); err != nil {
+		return nil, InputError("unknown job", nil, KV{"job": job})
+	}
+
+	// latexmk places output files next to the main input file
+	var files []string
+	for _, pattern := range []string{"*.synctex.gz", "*/*.synctex.gz"} {
+		matches, err := afero.Glob(texFs, filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, UnknownError("failed to search SyncTeX file", err, nil)
+		}
+		files = append(files, matches...)
+	}
+	switch len(files) {
+	case 0:
+		return nil, InputError("no SyncTeX file found", nil, KV{"job": job})
+	case 1:
+		// ok
+	default:
+		return nil, InputError("multiple SyncTeX files found", nil, KV{"job": job})
+	}
+
+	f, err := texFs.Open(files[0])
+	if err != nil {
+		return nil, UnknownError("failed to open SyncTeX file", err, nil)
+	}
+	defer func() { _ = f.Close() }()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, InputError("invalid SyncTeX file", err, KV{"job": job})
+	}
+	s, err := ParseSyncTeX(zr)
+	if err != nil {
+		return nil, InputError("invalid SyncTeX file", err, KV{"job": job})
+	}
+	return s, nil
+}
+
+// jobDir returns the working directory for the given name.
+func jobDir(name string) string {
+	return filepath.Join(baseJobDir, name)
+}
@@ -0,0 +1,174 @@
+package tex
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSyncTeX = `SyncTeX Version:1
+Input:1:/texd/job/./main.tex
+Input:2:/usr/share/texmf-dist/tex/latex/base/article.cls
+Output:pdf
+Magnification:1000
+Unit:1
+X Offset:0
+Y Offset:0
+Content:
+!200
+Input:3:/texd/job/./chapter/intro.tex
+{1
+[1,3:4736286,4736286:30785863,45644245,0
+(1,3:4736286,10000000:30785863,655360,0
+x1,3:5000000,10000000
+k1,3:6000000,10000000:65536
+)
+(3,7:4736286,20000000:20000000,655360,131072
+g3,7:6000000,20000000
+)
+v3,12:4736286,30000000:1000000,1000000,0
+]
+}1
+{2
+(3,20:4736286,10000000:30785863,655360,0
+)
+}2
+Postamble:
+Count:10
+`
+
+// pt converts scaled points to PDF points.
+func pt(sp int) float64 { return float64(sp) / 65536 * 72 / 72.27 }
+
+func TestParseSyncTeX(t *testing.T) {
+	t.Parallel()
+
+	s, err := ParseSyncTeX(strings.NewReader(testSyncTeX))
+	require.NoError(t, err)
+	assert.Len(t, s.inputs, 3)
+	assert.Len(t, s.records, 8)
+	assert.Equal(t, syncRecord{
+		kind: 'k', page: 1, tag: 1, line: 3, h: 6000000, v: 10000000, width: 65536,
+	}, s.records[3])
+
+	_, err = ParseSyncTeX(strings.NewReader("SyncTeX Version:1\n"))
+	assert.EqualError(t, err, "no content found")
+
+	_, err = ParseSyncTeX(strings.NewReader("Content:\n{1\n(1,a:0,0:0,0,0\n"))
+	assert.EqualError(t, err, `line 3: invalid record: "(1,a:0,0:0,0,0"`)
+
+	_, err = ParseSyncTeX(strings.NewReader("Unit:x\nContent:\n"))
+	assert.ErrorContains(t, err, "line 1: invalid unit")
+}
+
+func TestSyncTeX_Forward(t *testing.T) {
+	t.Parallel()
+
+	s, err := ParseSyncTeX(strings.NewReader(testSyncTeX))
+	require.NoError(t, err)
+
+	line, boxes, err := s.Forward("chapter/intro.tex", 7)
+	require.NoError(t, err)
+	assert.Equal(t, 7, line)
+	require.Len(t, boxes, 1)
+	assert.Equal(t, 1, boxes[0].Page)
+	assert.InDelta(t, 72, boxes[0].X, 0.01)
+	assert.InDelta(t, pt(20000000-655360), boxes[0].Y, 0.01)
+	assert.InDelta(t, pt(20000000), boxes[0].Width, 0.01)
+	assert.InDelta(t, pt(655360+131072), boxes[0].Height, 0.01)
+
+	// closest line
+	line, boxes, err = s.Forward("./chapter/intro.tex", 9)
+	require.NoError(t, err)
+	assert.Equal(t, 7, line)
+	assert.Len(t, boxes, 1)
+
+	line, boxes, err = s.Forward("chapter/intro.tex", 19)
+	require.NoError(t, err)
+	assert.Equal(t, 20, line)
+	require.Len(t, boxes, 1)
+	assert.Equal(t, 2, boxes[0].Page)
+
+	// no hbox, fall back to other records
+	line, boxes, err = s.Forward("chapter/intro.tex", 12)
+	require.NoError(t, err)
+	assert.Equal(t, 12, line)
+	assert.Len(t, boxes, 1)
+
+	_, _, err = s.Forward("missing.tex", 1)
+	assert.EqualError(t, err, `unknown input file: "missing.tex"`)
+	_, _, err = s.Forward("/usr/share/texmf-dist/tex/latex/base/article.cls", 1)
+	assert.EqualError(t, err, `no records for input file: "/usr/share/texmf-dist/tex/latex/base/article.cls"`)
+}
+
+func TestSyncTeX_Reverse(t *testing.T) {
+	t.Parallel()
+
+	s, err := ParseSyncTeX(strings.NewReader(testSyncTeX))
+	require.NoError(t, err)
+
+	// smallest box containing the position
+	pos, err := s.Reverse(1, 100, pt(19800000))
+	require.NoError(t, err)
+	assert.Equal(t, SyncTeXPosition{File: "chapter/intro.tex", Line: 7}, pos)
+
+	pos, err = s.Reverse(1, 80, pt(9800000))
+	require.NoError(t, err)
+	assert.Equal(t, SyncTeXPosition{File: "main.tex", Line: 3}, pos)
+
+	// closest record outside of boxes
+	pos, err = s.Reverse(2, 10, 10)
+	require.NoError(t, err)
+	assert.Equal(t, SyncTeXPosition{File: "chapter/intro.tex", Line: 20}, pos)
+
+	_, err = s.Reverse(3, 10, 10)
+	assert.EqualError(t, err, "no records on page 3")
+}
+
+func TestSyncTeX_relName(t *testing.T) {
+	t.Parallel()
+
+	s, err := ParseSyncTeX(strings.NewReader("Input:1:/texd/main.tex\nInput:2:/texd/sub/a.tex\nContent:\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "main.tex", s.relName(s.inputs[1]))
+	assert.Equal(t, "sub/a.tex", s.relName(s.inputs[2]))
+	assert.Equal(t, "/usr/share/b.sty", s.relName("/usr/share/b.sty"))
+	assert.Equal(t, "c.tex", s.relName("/tmp/x/./c.tex"))
+}
+
+func TestLoadSyncTeX(t *testing.T) {
+	t.Cleanup(func() {
+		baseJobDir = ""
+		texFs = afero.NewOsFs()
+	})
+	baseJobDir = "/jobs"
+	texFs = afero.NewMemMapFs()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(testSyncTeX))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, afero.WriteFile(texFs, "/jobs/01ABC/sub/main.synctex.gz", buf.Bytes(), 0o600))
+	require.NoError(t, afero.WriteFile(texFs, "/jobs/01DEF/main.synctex.gz", []byte("this is not gzipped"), 0o600))
+	require.NoError(t, texFs.MkdirAll("/jobs/01GHI", 0o700))
+
+	s, err := LoadSyncTeX("01ABC")
+	require.NoError(t, err)
+	assert.Len(t, s.records, 8)
+
+	for job, msg := range map[string]string{
+		"../etc": "invalid job",
+		"01XYZ":  "unknown job",
+		"01GHI":  "no SyncTeX file found",
+		"01DEF":  "invalid SyncTeX file: gzip: invalid header",
+	} {
+		_, err := LoadSyncTeX(job)
+		assert.EqualError(t, err, msg, job)
+	}
+}
@@ -0,0 +1,164 @@
+package tex
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// A Tool is a curated latexmk configuration profile, which enables an
+// auxiliary tool (e.g. for bibliographies, indices or glossaries).
+//
+// Clients can't provide latexmkrc files (see ForbiddenFiles), since they
+// are Perl scripts. Instead, the configuration is maintained here and
+// passed to latexmk with -e.
+type Tool struct {
+	Name string
+
+	// Config is latexmk (Perl) configuration code.
+	Config string
+
+	// Conflicts lists tools which can't be combined with this tool.
+	Conflicts []string
+}
+
+// The bibliography tools replace the other tool with a no-op (latexmk's
+// "internal" command syntax), so latexmk can't fall back to it, even when
+// the document produces input for both (e.g. a .bcf and a .aux file with
+// \bibdata). makeindex processes every .idx file, not only the one named
+// after the main input (e.g. additional indices of the imakeidx package).
+var tools = []Tool{{
+	Name: "biber",
+	Config: `$bibtex_use = 2; $biber = 'biber %O %S';` +
+		` $bibtex = 'internal texd_skip %B'; sub texd_skip { return 0; }`,
+	Conflicts: []string{"bibtex"},
+}, {
+	Name: "bibtex",
+	Config: `$bibtex_use = 2; $bibtex = 'bibtex %O %S';` +
+		` $biber = 'internal texd_skip %B'; sub texd_skip { return 0; }`,
+	Conflicts: []string{"biber"},
+}, {
+	Name: "makeindex",
+	Config: `add_cus_dep('idx', 'ind', 0, 'texd_makeindex');` +
+		` sub texd_makeindex { return system('makeindex', '-o', "$_[0].ind", '-t', "$_[0].ilg", "$_[0].idx"); }` +
+		` push @generated_exts, 'idx', 'ind', 'ilg';`,
+}, {
+	Name: "makeglossaries",
+	Config: `add_cus_dep('glo', 'gls', 0, 'makeglossaries');` +
+		` add_cus_dep('acn', 'acr', 0, 'makeglossaries');` +
+		` sub makeglossaries { return system('makeglossaries', $_[0]); }` +
+		` push @generated_exts, 'glo', 'gls', 'glg', 'acn', 'acr', 'alg';`,
+}}
+
+// allowedTools restricts the tools clients may select.
+var allowedTools = SupportedTools()
+
+// SupportedTools lists the names of all known tools.
+func SupportedTools() (names []string) {
+	for _, t := range tools {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// AllowedTools lists the names of tools clients may select.
+func AllowedTools() []string {
+	return slices.Clone(allowedTools)
+}
+
+// SetAllowedTools globally restricts the tools clients may select.
+func SetAllowedTools(names []string) error {
+	for _, name := range names {
+		if _, ok := findTool(name); !ok {
+			return ErrUnsupportedTool(name)
+		}
+	}
+	allowedTools = slices.Clone(names)
+	return nil
+}
+
+type ErrUnsupportedTool string
+
+func (err ErrUnsupportedTool) Error() string {
+	return fmt.Sprintf("unsupported tool: %q", string(err))
+}
+
+func findTool(name string) (Tool, bool) {
+	for _, t := range tools {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Tool{}, false
+}
+
+// ParseTools parses a comma separated list of tool names. Each tool must
+// be allowed (see SetAllowedTools), and must not conflict with another
+// selected tool. Duplicates are removed, and the result is ordered like
+// SupportedTools().
+func ParseTools(list string) ([]string, error) {
+	var names []string
+	for name := range strings.SplitSeq(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || slices.Contains(names, name) {
+			continue
+		}
+		if !slices.Contains(allowedTools, name) {
+			return nil, ErrUnsupportedTool(name)
+		}
+		names = append(names, name)
+	}
+	if err := validateTools(names); err != nil {
+		return nil, err
+	}
+	return sortTools(names), nil
+}
+
+// tools returns the selected tools, including the tool implied by
+// opts.Bib. The tools must be allowed and must not conflict.
+func (opts Options) tools() ([]string, error) {
+	names := slices.Clone(opts.Tools)
+	switch opts.Bib {
+	case "biber", "bibtex":
+		if !slices.Contains(names, opts.Bib) {
+			names = append(names, opts.Bib)
+		}
+	case "none":
+		for _, name := range []string{"biber", "bibtex"} {
+			if slices.Contains(names, name) {
+				return nil, fmt.Errorf("conflicting options: bib=none and tool %q", name)
+			}
+		}
+	}
+	for _, name := range names {
+		if !slices.Contains(allowedTools, name) {
+			return nil, ErrUnsupportedTool(name)
+		}
+	}
+	if err := validateTools(names); err != nil {
+		return nil, err
+	}
+	return sortTools(names), nil
+}
+
+// validateTools ensures the given tools don't conflict with each other.
+func validateTools(names []string) error {
+	for _, name := range names {
+		t, _ := findTool(name)
+		for _, other := range t.Conflicts {
+			if slices.Contains(names, other) {
+				return fmt.Errorf("conflicting tools: %q and %q", name, other)
+			}
+		}
+	}
+	return nil
+}
+
+func sortTools(names []string) (sorted []string) {
+	for _, t := range tools {
+		if slices.Contains(names, t.Name) {
+			sorted = append(sorted, t.Name)
+		}
+	}
+	return sorted
+}
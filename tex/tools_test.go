@@ -0,0 +1,102 @@
+package tex
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTools(t *testing.T) {
+	for list, expected := range map[string][]string{
+		"":                            nil,
+		"biber":                       {"biber"},
+		"makeglossaries, biber,biber": {"biber", "makeglossaries"},
+		",makeindex,":                 {"makeindex"},
+	} {
+		actual, err := ParseTools(list)
+		require.NoError(t, err, list)
+		assert.Equal(t, expected, actual, list)
+	}
+
+	for list, msg := range map[string]string{
+		"biber,bibtex": `conflicting tools: "biber" and "bibtex"`,
+		"perl":         `unsupported tool: "perl"`,
+	} {
+		_, err := ParseTools(list)
+		assert.EqualError(t, err, msg, list)
+	}
+}
+
+func TestSetAllowedTools(t *testing.T) {
+	t.Cleanup(func() { allowedTools = SupportedTools() })
+
+	require.NoError(t, SetAllowedTools([]string{"biber"}))
+	assert.Equal(t, []string{"biber"}, AllowedTools())
+
+	_, err := ParseTools("makeindex")
+	assert.EqualError(t, err, `unsupported tool: "makeindex"`)
+	_, err = Options{Bib: "bibtex"}.tools()
+	assert.EqualError(t, err, `unsupported tool: "bibtex"`)
+
+	assert.EqualError(t, SetAllowedTools([]string{"perl"}), `unsupported tool: "perl"`)
+	assert.Equal(t, []string{"biber"}, AllowedTools()) // unchanged
+}
+
+// latexmkStub mimics the latexmk defaults and helpers used by the tool
+// configurations, and reports which command latexmk would run for each
+// auxiliary tool. Commands with the "internal" prefix call a Perl sub.
+const latexmkStub = `
+our ($bibtex_use, $bibtex, $biber, $makeindex) = (1, 'bibtex %O %S', 'biber %O %S', 'makeindex %O %S');
+our (@cus_deps, @generated_exts);
+sub add_cus_dep { push @cus_deps, "$_[0]>$_[1]:$_[3]"; }
+eval join(' ', @ARGV); die $@ if $@;
+sub cmd {
+	my ($spec) = @_;
+	return "noop" if $spec =~ /^internal (\w+)/ && defined &$1 && &{\&$1}('doc') == 0;
+	return (split / /, $spec)[0];
+}
+print "bibtex_use=$bibtex_use bibtex=", cmd($bibtex), " biber=", cmd($biber),
+	" makeindex=", cmd($makeindex), " deps=", join(',', @cus_deps),
+	" generated=", join(',', @generated_exts), "\n";
+`
+
+func TestToolConfig(t *testing.T) {
+	perl, err := exec.LookPath("perl")
+	if err != nil {
+		t.Skip("perl not available")
+	}
+	run := func(t *testing.T, names ...string) string {
+		t.Helper()
+		args := []string{"-e", latexmkStub, "--"}
+		for _, name := range names {
+			args = append(args, findToolConfig(name))
+		}
+		out, err := exec.Command(perl, args...).CombinedOutput() //nolint:gosec // test input
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+
+	for names, expected := range map[string]string{
+		"":       "bibtex_use=1 bibtex=bibtex biber=biber makeindex=makeindex deps= generated=",
+		"biber":  "bibtex_use=2 bibtex=noop biber=biber makeindex=makeindex deps= generated=",
+		"bibtex": "bibtex_use=2 bibtex=bibtex biber=noop makeindex=makeindex deps= generated=",
+		"makeindex": "bibtex_use=1 bibtex=bibtex biber=biber makeindex=makeindex" +
+			" deps=idx>ind:texd_makeindex generated=idx,ind,ilg",
+		"makeglossaries": "bibtex_use=1 bibtex=bibtex biber=biber makeindex=makeindex" +
+			" deps=glo>gls:makeglossaries,acn>acr:makeglossaries generated=glo,gls,glg,acn,acr,alg",
+		"biber,makeindex,makeglossaries": "bibtex_use=2 bibtex=noop biber=biber makeindex=makeindex" +
+			" deps=idx>ind:texd_makeindex,glo>gls:makeglossaries,acn>acr:makeglossaries" +
+			" generated=idx,ind,ilg,glo,gls,glg,acn,acr,alg",
+	} {
+		t.Run(names, func(t *testing.T) {
+			var list []string
+			if names != "" {
+				list = strings.Split(names, ",")
+			}
+			assert.Equal(t, expected, run(t, list...))
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package tex
+
+import (
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/digineo/xlog"
+	"github.com/spf13/afero"
+)
+
+// workspacePrefix distinguishes the working directories of workspaces
+// from those of regular jobs.
+const workspacePrefix = "workspace-"
+
+// A Workspace is a persistent working directory, in which documents are
+// compiled repeatedly. Contrary to regular jobs, the sources can be
+// updated file by file, and auxiliary files (e.g. main.aux, or latexmk's
+// main.fdb_latexmk) survive compilations, so that latexmk can skip
+// passes when nothing structural has changed.
+//
+// A Workspace is not safe for concurrent use.
+type Workspace struct {
+	id  string
+	doc *document // holds the working directory and the file list
+}
+
+// NewWorkspace creates a new workspace, with a working directory named
+// after id (see SetJobBaseDir).
+func NewWorkspace(log xlog.Logger, id string) (*Workspace, error) {
+	if !jobNamePattern.MatchString(id) {
+		return nil, InputError("invalid workspace", nil, KV{"workspace": id})
+	}
+	doc := &document{
+		fs:            texFs,
+		files:         make(map[string]*File),
+		log:           log,
+		mkWorkDirName: workspacePrefix + id,
+		mkWorkDir:     &sync.Once{},
+	}
+	wd, err := doc.WorkingDirectory()
+	if err != nil {
+		return nil, err
+	}
+	if err = doc.fs.Mkdir(wd, o_rwx); err != nil {
+		return nil, UnknownError("creating working directory failed", err, nil)
+	}
+	return &Workspace{id: id, doc: doc}, nil
+}
+
+// ID returns the workspace's identifier, as given to NewWorkspace.
+func (ws *Workspace) ID() string { return ws.id }
+
+// NewWriter adds a new file to the workspace, or replaces an existing
+// one. The name has the same restrictions as outlined in
+// Document.AddFile. You MUST call Close() on the returned handle.
+func (ws *Workspace) NewWriter(name string) (io.WriteCloser, error) {
+	clean, ok := cleanpath(name)
+	if !ok {
+		return nil, InputError("invalid file name", nil, KV{"filename": name})
+	}
+	return ws.doc.newWriter(clean, true)
+}
+
+// RemoveFile removes a file from the workspace.
+func (ws *Workspace) RemoveFile(name string) error {
+	clean, ok := cleanpath(name)
+	if !ok {
+		return InputError("invalid file name", nil, KV{"filename": name})
+	}
+	if !ws.doc.HasFile(clean) {
+		return InputError("unknown file name", nil, KV{"filename": name})
+	}
+	if err := ws.doc.fs.Remove(path.Join(ws.doc.workdir, clean)); err != nil && !os.IsNotExist(err) {
+		return UnknownError("failed to remove file", err, KV{"filename": name})
+	}
+	delete(ws.doc.files, clean)
+	return nil
+}
+
+// Files lists the names of all files added to the workspace, in
+// lexical order.
+func (ws *Workspace) Files() []string {
+	return slices.Sorted(maps.Keys(ws.doc.files))
+}
+
+// Size returns the total size of all files in the working directory,
+// including auxiliary files created by compilations.
+func (ws *Workspace) Size() (int64, error) {
+	var size int64
+	err := afero.Walk(ws.doc.fs, ws.doc.workdir, func(_ string, info fs.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return err
+	})
+	if err != nil {
+		return 0, UnknownError("failed to determine workspace size", err, nil)
+	}
+	return size, nil
+}
+
+// RemoveAuxFiles removes all files from the working directory, which
+// haven't been added with NewWriter, i.e. auxiliary files and results of
+// previous compilations. The next compilation starts from scratch.
+func (ws *Workspace) RemoveAuxFiles() error {
+	var aux []string
+	err := afero.Walk(ws.doc.fs, ws.doc.workdir, func(name string, info fs.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(ws.doc.workdir, name)
+		if err != nil {
+			return err
+		}
+		if _, ok := ws.doc.files[filepath.ToSlash(rel)]; !ok {
+			aux = append(aux, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return UnknownError("failed to remove auxiliary files", err, nil)
+	}
+	for _, name := range aux {
+		if err = ws.doc.fs.Remove(name); err != nil && !os.IsNotExist(err) {
+			return UnknownError("failed to remove auxiliary files", err, nil)
+		}
+	}
+	return nil
+}
+
+// Document returns a new document for compiling the workspace's files.
+// It shares the workspace's working directory, hence only one document
+// should be compiled at a time. The file list is a snapshot, i.e. later
+// changes to the workspace don't affect the returned document.
+func (ws *Workspace) Document(log xlog.Logger, engine Engine, image string) Document {
+	doc := &document{
+		fs:         ws.doc.fs,
+		workdir:    ws.doc.workdir,
+		files:      maps.Clone(ws.doc.files),
+		log:        log,
+		image:      image,
+		engine:     engine,
+		mkWorkDir:  &sync.Once{},
+		persistent: true,
+	}
+	doc.mkWorkDir.Do(func() {}) // workdir is already present
+	return doc
+}
+
+// Remove removes the working directory and any contents. The workspace
+// must not be used afterwards.
+func (ws *Workspace) Remove() error {
+	return ws.doc.Cleanup()
+}
+
+// removeInternalFiles removes converted and post-processed files (see
+// internalPrefix) from the working directory. Results of a previous
+// compilation would otherwise be mistaken for results of the next one.
+func (doc *document) removeInternalFiles() error {
+	entries, err := afero.ReadDir(doc.fs, doc.workdir)
+	if err != nil {
+		return UnknownError("cleanup failed", err, nil)
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), internalPrefix) {
+			continue
+		}
+		if err = doc.fs.RemoveAll(path.Join(doc.workdir, entry.Name())); err != nil {
+			return UnknownError("cleanup failed", err, nil)
+		}
+	}
+	return nil
+}
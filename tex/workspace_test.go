@@ -0,0 +1,103 @@
+package tex
+
+import (
+	"testing"
+
+	"github.com/digineo/xlog"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspace(t *testing.T) {
+	t.Cleanup(func() {
+		baseJobDir = ""
+		texFs = afero.NewOsFs()
+	})
+	baseJobDir = "/jobs"
+	texFs = afero.NewMemMapFs()
+	require.NoError(t, texFs.Mkdir("/jobs", o_rwx))
+
+	_, err := NewWorkspace(xlog.NewDiscard(), "../x")
+	require.EqualError(t, err, "invalid workspace")
+
+	ws, err := NewWorkspace(xlog.NewDiscard(), "01WS")
+	require.NoError(t, err)
+	assert.Equal(t, "01WS", ws.ID())
+
+	_, err = NewWorkspace(xlog.NewDiscard(), "01WS")
+	require.ErrorContains(t, err, "creating working directory failed")
+
+	write := func(name, contents string) {
+		t.Helper()
+		wc, err := ws.NewWriter(name)
+		require.NoError(t, err)
+		_, err = wc.Write([]byte(contents))
+		require.NoError(t, err)
+		require.NoError(t, wc.Close())
+	}
+	write("main.tex", `\documentclass{article}`)
+	write("./chapter/intro.tex", "hello")
+	write("chapter/intro.tex", "hi") // replaces the previous content
+	assert.Equal(t, []string{"chapter/intro.tex", "main.tex"}, ws.Files())
+
+	contents, err := afero.ReadFile(texFs, "/jobs/workspace-01WS/chapter/intro.tex")
+	require.NoError(t, err)
+	assert.Equal(t, "hi", string(contents))
+
+	_, err = ws.NewWriter("../main.tex")
+	assert.EqualError(t, err, "invalid file name")
+
+	size, err := ws.Size()
+	require.NoError(t, err)
+	assert.EqualValues(t, 25, size)
+
+	// compile
+	doc := ws.Document(xlog.NewDiscard(), DefaultEngine, "")
+	wd, err := doc.WorkingDirectory()
+	require.NoError(t, err)
+	assert.Equal(t, "/jobs/workspace-01WS", wd)
+	main, err := doc.MainInput()
+	require.NoError(t, err)
+	assert.Equal(t, "main.tex", main)
+
+	for _, name := range []string{"main.aux", "main.pdf", "_texd-page-1.png", "_texd-html/main.html"} {
+		require.NoError(t, afero.WriteFile(texFs, "/jobs/workspace-01WS/"+name, nil, o_rw))
+	}
+	require.NoError(t, doc.Cleanup())
+	for name, exists := range map[string]bool{
+		"main.tex":          true,
+		"main.aux":          true,
+		"main.pdf":          true,
+		"_texd-page-1.png":  false,
+		"_texd-html":        false,
+		"chapter/intro.tex": true,
+	} {
+		ok, err := afero.Exists(texFs, "/jobs/workspace-01WS/"+name)
+		require.NoError(t, err)
+		assert.Equal(t, exists, ok, name)
+	}
+
+	require.NoError(t, ws.RemoveAuxFiles())
+	for name, exists := range map[string]bool{
+		"main.tex":          true,
+		"main.aux":          false,
+		"main.pdf":          false,
+		"chapter/intro.tex": true,
+	} {
+		ok, err := afero.Exists(texFs, "/jobs/workspace-01WS/"+name)
+		require.NoError(t, err)
+		assert.Equal(t, exists, ok, name)
+	}
+
+	// the document's file list is a snapshot
+	require.NoError(t, ws.RemoveFile("chapter/intro.tex"))
+	assert.Equal(t, []string{"main.tex"}, ws.Files())
+	assert.True(t, doc.HasFile("chapter/intro.tex"))
+	assert.EqualError(t, ws.RemoveFile("chapter/intro.tex"), "unknown file name")
+
+	require.NoError(t, ws.Remove())
+	ok, err := afero.Exists(texFs, "/jobs/workspace-01WS")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}